@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	sizeDistFixed     = "fixed"
+	sizeDistUniform   = "uniform"
+	sizeDistLognormal = "lognormal"
+
+	contentTypeText   = "text"
+	contentTypeJSON   = "json"
+	contentTypeBinary = "binary"
+
+	// length of string values in generated JSON documents
+	jsonValueLength = 16
+)
+
+// payloadConfig defines the size and content of the generated payloads
+type payloadConfig struct {
+	// Seed makes the generated data reproducible, 0 seeds from current time
+	Seed int64
+	// SizeDist is the distribution of payload sizes: fixed, uniform, or lognormal
+	SizeDist string
+	// Size is the fixed size, and median size in lognormal distribution
+	Size int
+	// MinSize is the lower bound of uniform and lognormal distributions
+	MinSize int
+	// MaxSize is the upper bound of uniform and lognormal distributions
+	MaxSize int
+	// Sigma is the standard deviation of the lognormal distribution
+	Sigma float64
+	// ContentType is the type of generated content: text, json, or binary
+	ContentType string
+}
+
+func (c *payloadConfig) validate() error {
+	switch c.SizeDist {
+	case sizeDistFixed, sizeDistUniform, sizeDistLognormal:
+	default:
+		return errors.Errorf("invalid size distribution (fixed, uniform, lognormal): %s", c.SizeDist)
+	}
+	switch c.ContentType {
+	case contentTypeText, contentTypeJSON, contentTypeBinary:
+	default:
+		return errors.Errorf("invalid content type (text, json, binary): %s", c.ContentType)
+	}
+	if c.Size < 1 || c.MinSize < 1 || c.MaxSize < c.MinSize {
+		return errors.Errorf("invalid payload size (size: %d, min: %d, max: %d)", c.Size, c.MinSize, c.MaxSize)
+	}
+	if c.Sigma < 0 {
+		return errors.Errorf("invalid lognormal sigma: %f", c.Sigma)
+	}
+	return nil
+}
+
+// payloadGenerator generates payloads, it is not safe for concurrent use
+// so each publisher gets its own generator seeded off the configured seed
+type payloadGenerator struct {
+	cfg *payloadConfig
+	rnd *rand.Rand
+}
+
+func newPayloadGenerator(cfg *payloadConfig, index int) *payloadGenerator {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &payloadGenerator{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(seed + int64(index))),
+	}
+}
+
+// id generates UUID from the generator source so it's reproducible too
+func (g *payloadGenerator) id() string {
+	id, err := uuid.NewRandomFromReader(g.rnd)
+	if err != nil {
+		return uuid.New().String()
+	}
+	return id.String()
+}
+
+// size returns the next payload size based on the configured distribution
+func (g *payloadGenerator) size() int {
+	switch g.cfg.SizeDist {
+	case sizeDistUniform:
+		return g.cfg.MinSize + g.rnd.Intn(g.cfg.MaxSize-g.cfg.MinSize+1)
+	case sizeDistLognormal:
+		v := math.Exp(math.Log(float64(g.cfg.Size)) + g.cfg.Sigma*g.rnd.NormFloat64())
+		return clamp(int(math.Round(v)), g.cfg.MinSize, g.cfg.MaxSize)
+	default:
+		return g.cfg.Size
+	}
+}
+
+// data returns the next payload of the configured content type
+func (g *payloadGenerator) data() []byte {
+	size := g.size()
+	switch g.cfg.ContentType {
+	case contentTypeJSON:
+		return g.jsonData(size)
+	case contentTypeBinary:
+		b := make([]byte, size)
+		g.rnd.Read(b)
+		return b
+	default:
+		return g.textData(size)
+	}
+}
+
+func (g *payloadGenerator) textData(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = chars[g.rnd.Intn(len(chars))]
+	}
+	return b
+}
+
+// jsonData generates flat JSON document of alternating string and number fields,
+// the last string field and whitespace fill the document to exactly size bytes
+func (g *payloadGenerator) jsonData(size int) []byte {
+	if size < 2 {
+		// single digit is the smallest JSON document
+		return []byte(strconv.Itoa(g.rnd.Intn(10)))
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; ; i++ {
+		sep := ""
+		if i > 0 {
+			sep = ","
+		}
+		var v string
+		if i%2 == 0 {
+			v = `"` + string(g.textData(jsonValueLength)) + `"`
+		} else {
+			v = strconv.FormatFloat(g.rnd.Float64()*1000, 'f', 2, 64)
+		}
+		room := size - 1 - buf.Len()
+		if field := fmt.Sprintf(`%s"f%d":%s`, sep, i, v); len(field) <= room {
+			buf.WriteString(field)
+			continue
+		}
+		if empty := fmt.Sprintf(`%s"f%d":""`, sep, i); len(empty) <= room {
+			buf.WriteString(empty[:len(empty)-1])
+			buf.Write(g.textData(room - len(empty)))
+			buf.WriteByte('"')
+		}
+		break
+	}
+	buf.WriteString(strings.Repeat(" ", size-1-buf.Len()))
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONDataExactSize(t *testing.T) {
+	g := newPayloadGenerator(&payloadConfig{Seed: 1, ContentType: contentTypeJSON}, 1)
+	for size := 1; size <= 300; size++ {
+		b := g.jsonData(size)
+		if len(b) != size {
+			t.Fatalf("expected %d bytes, got %d: %s", size, len(b), b)
+		}
+		if !json.Valid(b) {
+			t.Fatalf("invalid JSON of size %d: %s", size, b)
+		}
+	}
+}
+
+func TestEventDataEmbedsContent(t *testing.T) {
+	cases := map[string]func(interface{}) bool{
+		contentTypeJSON:   func(v interface{}) bool { _, ok := v.(map[string]interface{}); return ok },
+		contentTypeText:   func(v interface{}) bool { s, ok := v.(string); return ok && len(s) == 64 },
+		contentTypeBinary: func(v interface{}) bool { s, ok := v.(string); return ok && len(s) == 88 },
+	}
+	for contentType, check := range cases {
+		g := newPayloadGenerator(&payloadConfig{Seed: 1, Size: 64, ContentType: contentType}, 1)
+		var r struct {
+			Data interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(getEventData(1, g), &r); err != nil {
+			t.Fatalf("error parsing %s event: %v", contentType, err)
+		}
+		if !check(r.Data) {
+			t.Fatalf("unexpected %s data: %v", contentType, r.Data)
+		}
+	}
+}
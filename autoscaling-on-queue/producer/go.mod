@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/dapr/go-sdk v0.11.0
 	github.com/google/uuid v1.1.2
+	github.com/pkg/errors v0.9.1
 	golang.org/x/net v0.0.0-20200930145003-4acb6c075d10 // indirect
 	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
 	google.golang.org/genproto v0.0.0-20201002142447-3860012362da // indirect
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/signal"
 	"strconv"
@@ -15,13 +14,13 @@ import (
 	"syscall"
 	"time"
 
-	dapr "github.com/dapr/go-sdk/client"
 	daprd "github.com/dapr/go-sdk/service/grpc"
-	"github.com/google/uuid"
 )
 
 const (
 	chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// time the canceled publishes have to return after the drain timeout
+	cancelTimeout = time.Second
 )
 
 var (
@@ -34,8 +33,28 @@ var (
 	publishDelay     = getEnvDurationOrFail("PUBLISHERS_DELAY", "10s")
 	logFrequency     = getEnvDurationOrFail("LOG_FREQ", "3s")
 	publishToConsole = getEnvBoolOrFail("PUBLISH_TO_CONSOLE", "false")
+	shutdownTimeout  = getEnvDurationOrFail("SHUTDOWN_TIMEOUT", "10s")
 
-	client dapr.Client
+	payload = &payloadConfig{
+		Seed:        int64(getEnvIntOrFail("PAYLOAD_SEED", "0")),
+		SizeDist:    getEnvVar("PAYLOAD_SIZE_DIST", sizeDistFixed),
+		Size:        getEnvIntOrFail("PAYLOAD_SIZE", "256"),
+		MinSize:     getEnvIntOrFail("PAYLOAD_MIN_SIZE", "1"),
+		MaxSize:     getEnvIntOrFail("PAYLOAD_MAX_SIZE", "65536"),
+		Sigma:       getEnvFloatOrFail("PAYLOAD_SIZE_SIGMA", "0.5"),
+		ContentType: getEnvVar("PAYLOAD_CONTENT_TYPE", contentTypeText),
+	}
+
+	sinks = &sinkConfig{
+		Names:       getEnvVar("SINK", sinkDapr),
+		PubSubName:  pubSubName,
+		TopicName:   topicName,
+		FilePath:    getEnvVar("SINK_FILE_PATH", "events.jsonl"),
+		HTTPURL:     getEnvVar("SINK_HTTP_URL", ""),
+		HTTPTimeout: getEnvDurationOrFail("SINK_HTTP_TIMEOUT", "5s"),
+	}
+
+	sink Sink
 )
 
 func main() {
@@ -48,6 +67,12 @@ func main() {
 	logger.Printf("publish frequency: %v", publishFrequency)
 	logger.Printf("log frequency: %v", logFrequency)
 	logger.Printf("publish delay: %v", publishDelay)
+	logger.Printf("shutdown timeout: %v", shutdownTimeout)
+	logger.Printf("payload: %+v", *payload)
+
+	if err := payload.validate(); err != nil {
+		log.Fatalf("invalid payload configuration: %v", err)
+	}
 
 	// create Dapr service
 	s, err := daprd.NewService(serviceAddress)
@@ -55,98 +80,196 @@ func main() {
 		log.Fatalf("failed to start the server: %v", err)
 	}
 
-	c, err := dapr.NewClient()
+	// PUBLISH_TO_CONSOLE is kept for backwards compatibility
+	if publishToConsole {
+		sinks.Names = sinkStdout
+	}
+	logger.Printf("sink: %s", sinks.Names)
+
+	k, err := newSink(sinks)
 	if err != nil {
-		log.Fatalf("error creating Dapr client: %v", err)
+		log.Fatalf("error creating sink: %v", err)
 	}
-	client = c
-	defer client.Close()
+	sink = k
 
 	// handle signals
-	stop := make(chan os.Signal)
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-stop
+		logger.Printf("received %v, shutting down...", sig)
+		cancel()
+	}()
 
 	resultCh := make(chan bool, 100)
-	stopCh := make(chan struct{})
+	monitorStopCh := make(chan struct{})
+	monitorDoneCh := make(chan struct{})
 
+	// print results
 	go func() {
-		<-stop
-		close(stopCh)
+		monitor(resultCh, monitorStopCh)
+		close(monitorDoneCh)
 	}()
 
-	// print results
-	go monitor(resultCh, stopCh)
+	// in-flight publishes are drained on shutdown, and canceled only when that times out
+	sendCtx, cancelSend := context.WithCancel(context.Background())
 
 	// start producing
+	var wg sync.WaitGroup
 	for i := 1; i <= numOfPublishers; i++ {
-		go publish(i, resultCh, stopCh)
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			publish(ctx, sendCtx, index, resultCh)
+		}(i)
 	}
 
 	// start the server to handle incoming events
-	if err := s.Start(); err != nil {
-		log.Fatalf("server error: %v", err)
+	serverErrCh := make(chan error, 1)
+	go func() {
+		serverErrCh <- s.Start()
+	}()
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+	case err := <-serverErrCh:
+		logger.Printf("server error: %v", err)
+		exitCode = 1
+		cancel()
+	}
+
+	// stop intake, publishers exit after their in-flight publish completes
+	if err := s.Stop(); err != nil {
+		logger.Printf("error stopping server: %v", err)
+	}
+	if !waitWithTimeout(&wg, shutdownTimeout) {
+		logger.Printf("timeout waiting for in-flight publishes after %v, canceling them", shutdownTimeout)
+		exitCode = 1
+	}
+	// the sink is closed only after all of the publishers stopped using it
+	cancelSend()
+	if !waitWithTimeout(&wg, cancelTimeout) {
+		logger.Printf("timeout waiting for canceled publishes after %v, exiting", cancelTimeout)
+		os.Exit(1)
 	}
 
+	// flush final stats
+	close(monitorStopCh)
+	<-monitorDoneCh
+
+	if err := sink.Close(); err != nil {
+		logger.Printf("error closing sink: %v", err)
+		exitCode = 1
+	}
+	logger.Printf("done, exit code: %d", exitCode)
+	os.Exit(exitCode)
+}
+
+// waitWithTimeout waits for the wait group, returns false if the timeout expired first
+func waitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	doneCh := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func monitor(resultCh <-chan bool, stopCh <-chan struct{}) {
-	var mux sync.Mutex
 	var successCounter int64 = 0
 	var errorCounter int64 = 0
 	startTime := time.Now()
-	tickerCh := time.NewTicker(logFrequency).C
+	ticker := time.NewTicker(logFrequency)
+	defer ticker.Stop()
+
+	count := func(r bool) {
+		if r {
+			successCounter++
+		} else {
+			errorCounter++
+		}
+	}
+	report := func(prefix string) {
+		var avg float64 = 0
+		if successCounter > 0 {
+			avg = float64(successCounter) / time.Since(startTime).Seconds()
+		}
+		logger.Printf("%s%10d published, %3.0f/sec, %3d errors", prefix, successCounter, avg, errorCounter)
+	}
+
 	for {
 		select {
 		case r := <-resultCh:
-			mux.Lock()
-			if r {
-				successCounter++
-			} else {
-				errorCounter++
-			}
-			mux.Unlock()
-		case <-tickerCh:
-			var avg float64 = 0
-			if successCounter > 0 {
-				avg = float64(successCounter) / time.Since(startTime).Seconds()
-			}
-			logger.Printf("%10d published, %3.0f/sec, %3d errors", successCounter, avg, errorCounter)
+			count(r)
+		case <-ticker.C:
+			report("")
 		case <-stopCh:
-			os.Exit(0)
+			// drain results already reported before printing the final stats
+			for {
+				select {
+				case r := <-resultCh:
+					count(r)
+				default:
+					report("final: ")
+					return
+				}
+			}
 		}
 	}
 }
 
-func publish(index int, resultCh chan<- bool, stopCh <-chan struct{}) {
-	delayCh := time.NewTicker(publishDelay).C
-	<-delayCh
+// publish sends events until ctx is done, each send uses sendCtx
+// so that the in-flight one isn't canceled when ctx is
+func publish(ctx, sendCtx context.Context, index int, resultCh chan<- bool) {
+	delay := time.NewTimer(publishDelay)
+	defer delay.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-delay.C:
+	}
 
-	tickerCh := time.NewTicker(publishFrequency).C
+	gen := newPayloadGenerator(payload, index)
+	ticker := time.NewTicker(publishFrequency)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-stopCh:
+		case <-ctx.Done():
 			return
-		case <-tickerCh:
-			d := getEventData(index)
-			if publishToConsole {
-				logger.Printf("%s", d)
-				resultCh <- true
-				continue
-			}
-			resultCh <- client.PublishEvent(context.Background(), pubSubName, topicName, d) == nil
+		case <-ticker.C:
+			d := getEventData(index, gen)
+			resultCh <- sink.Send(sendCtx, d) == nil
 		}
 	}
 }
 
-func getEventData(index int) []byte {
+func getEventData(index int, gen *payloadGenerator) []byte {
+	data := gen.data()
 	r := requestContent{
-		ID:   fmt.Sprintf("p%d-%s", index, uuid.New().String()),
-		Data: []byte(getData(256)),
-		Time: time.Now().UTC().Unix(),
+		ID:          fmt.Sprintf("p%d-%s", index, gen.id()),
+		ContentType: gen.cfg.ContentType,
+		Time:        time.Now().UTC().Unix(),
+	}
+
+	// JSON documents are embedded as-is, text as string, and binary data as base64
+	switch gen.cfg.ContentType {
+	case contentTypeJSON:
+		r.Data = json.RawMessage(data)
+	case contentTypeText:
+		r.Data = string(data)
+	default:
+		r.Data = data
 	}
 
 	// hash the entire message
-	inSha := sha256.Sum256(r.Data)
+	inSha := sha256.Sum256(data)
 	r.Sha = string(inSha[:])
 
 	b, err := json.Marshal(r)
@@ -156,20 +279,12 @@ func getEventData(index int) []byte {
 	return b
 }
 
-func getData(length int) string {
-	seededRand := rand.New(rand.NewSource(time.Now().UnixNano()))
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = chars[seededRand.Intn(len(chars))]
-	}
-	return string(b)
-}
-
 type requestContent struct {
-	ID   string `json:"id"`
-	Data []byte `json:"data"`
-	Sha  string `json:"sha"`
-	Time int64  `json:"time"`
+	ID          string      `json:"id"`
+	Data        interface{} `json:"data"`
+	ContentType string      `json:"content_type"`
+	Sha         string      `json:"sha"`
+	Time        int64       `json:"time"`
 }
 
 func getEnvVar(key, fallbackValue string) string {
@@ -205,3 +320,12 @@ func getEnvBoolOrFail(key, fallbackValue string) bool {
 	}
 	return v
 }
+
+func getEnvFloatOrFail(key, fallbackValue string) float64 {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		logger.Fatalf("invalid float variable: %s - %v", s, err)
+	}
+	return v
+}
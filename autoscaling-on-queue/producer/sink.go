@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	sinkDapr   = "dapr"
+	sinkStdout = "stdout"
+	sinkFile   = "file"
+	sinkNull   = "null"
+	sinkHTTP   = "http"
+
+	// interval in which the events buffered by the file sink are flushed
+	fileFlushInterval = time.Second
+)
+
+// Sink is the destination of the produced events
+type Sink interface {
+	// Send delivers single event to the sink.
+	Send(ctx context.Context, data []byte) error
+	// Close flushes any buffered events and releases the sink resources.
+	Close() error
+}
+
+// sinkConfig defines the sinks and their configuration
+type sinkConfig struct {
+	// Names is the comma separated list of sinks, multiple sinks are teed
+	Names string
+	// PubSubName is the Dapr pub/sub component name used by the dapr sink
+	PubSubName string
+	// TopicName is the Dapr pub/sub topic name used by the dapr sink
+	TopicName string
+	// FilePath is the path of the JSONL file used by the file sink
+	FilePath string
+	// HTTPURL is the URL to which the http sink POSTs events
+	HTTPURL string
+	// HTTPTimeout is the timeout of each http sink request
+	HTTPTimeout time.Duration
+}
+
+// newSink creates sink for each one of the configured names,
+// when more than one sink is configured, all of them get each event
+func newSink(cfg *sinkConfig) (Sink, error) {
+	var sinks []Sink
+	for _, name := range strings.Split(cfg.Names, ",") {
+		s, err := newNamedSink(strings.ToLower(strings.TrimSpace(name)), cfg)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return &teeSink{sinks: sinks}, nil
+}
+
+func newNamedSink(name string, cfg *sinkConfig) (Sink, error) {
+	switch name {
+	case sinkDapr:
+		c, err := dapr.NewClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating Dapr client")
+		}
+		return &daprSink{client: c, pubSubName: cfg.PubSubName, topicName: cfg.TopicName}, nil
+	case sinkStdout:
+		return newWriterSink(os.Stdout, nil, 0), nil
+	case sinkFile:
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error opening sink file: %s", cfg.FilePath)
+		}
+		return newWriterSink(f, f, fileFlushInterval), nil
+	case sinkNull:
+		return &nullSink{}, nil
+	case sinkHTTP:
+		if cfg.HTTPURL == "" {
+			return nil, errors.New("http sink requires URL")
+		}
+		return &httpSink{url: cfg.HTTPURL, client: &http.Client{Timeout: cfg.HTTPTimeout}}, nil
+	default:
+		return nil, errors.Errorf("invalid sink (dapr, stdout, file, null, http): %s", name)
+	}
+}
+
+// closeSinks closes all of the sinks, and returns the first error
+func closeSinks(sinks []Sink) error {
+	var firstErr error
+	for _, s := range sinks {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// daprSink publishes events onto Dapr pub/sub topic
+type daprSink struct {
+	client     dapr.Client
+	pubSubName string
+	topicName  string
+}
+
+func (s *daprSink) Send(ctx context.Context, data []byte) error {
+	return s.client.PublishEvent(ctx, s.pubSubName, s.topicName, data)
+}
+
+func (s *daprSink) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// writerSink writes each event as a single line (JSONL) into stdout or file,
+// flushing after each event, or in flush interval when it's set
+type writerSink struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+
+	interval time.Duration
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newWriterSink(w io.Writer, c io.Closer, interval time.Duration) *writerSink {
+	s := &writerSink{w: bufio.NewWriter(w), c: c, interval: interval}
+	if interval > 0 {
+		s.done, s.stopped = make(chan struct{}), make(chan struct{})
+		go s.flushPeriodically()
+	}
+	return s
+}
+
+func (s *writerSink) flushPeriodically() {
+	defer close(s.stopped)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.mu.Lock()
+			if err := s.w.Flush(); err != nil {
+				logger.Printf("error flushing events: %v", err)
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *writerSink) Send(ctx context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(data); err != nil {
+		return errors.Wrap(err, "error writing event")
+	}
+	if err := s.w.WriteByte('\n'); err != nil {
+		return errors.Wrap(err, "error writing event")
+	}
+	if s.interval == 0 {
+		return errors.Wrap(s.w.Flush(), "error flushing event")
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if s.done != nil {
+		close(s.done)
+		<-s.stopped
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		return errors.Wrap(err, "error flushing events")
+	}
+	if s.c != nil {
+		return s.c.Close()
+	}
+	return nil
+}
+
+// nullSink discards all events, useful to benchmark the producer itself
+type nullSink struct{}
+
+func (s *nullSink) Send(ctx context.Context, data []byte) error {
+	return nil
+}
+
+func (s *nullSink) Close() error {
+	return nil
+}
+
+// httpSink POSTs events directly to URL, bypassing the Dapr sidecar
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "error creating request to: %s", s.url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "error posting to: %s", s.url)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("invalid response from %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// teeSink sends each event to all of its sinks
+type teeSink struct {
+	sinks []Sink
+}
+
+// Send sends the event to all of the sinks, even when some of them fail,
+// and returns the first error along with the number of failed sinks
+func (s *teeSink) Send(ctx context.Context, data []byte) error {
+	var firstErr error
+	var failed int
+	for _, sink := range s.sinks {
+		if err := sink.Send(ctx, data); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if firstErr != nil {
+		return errors.Wrapf(firstErr, "%d of %d sinks failed", failed, len(s.sinks))
+	}
+	return nil
+}
+
+func (s *teeSink) Close() error {
+	return closeSinks(s.sinks)
+}
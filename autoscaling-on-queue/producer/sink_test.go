@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// syncBuffer is buffer safe to read while the sink flushes into it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWriterSinkFlushesEachEvent(t *testing.T) {
+	var buf syncBuffer
+	s := newWriterSink(&buf, nil, 0)
+	if err := s.Send(context.Background(), []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.String(); got != "{\"id\":1}\n" {
+		t.Fatalf("expected event flushed, got: %q", got)
+	}
+}
+
+func TestWriterSinkFlushesPeriodically(t *testing.T) {
+	var buf syncBuffer
+	s := newWriterSink(&buf, nil, 10*time.Millisecond)
+	if err := s.Send(context.Background(), []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for buf.String() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("event not flushed in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Send(context.Background(), []byte(`{"id":2}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.String(); got != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
+
+type failingSink struct {
+	err  error
+	sent int
+}
+
+func (s *failingSink) Send(ctx context.Context, data []byte) error {
+	s.sent++
+	return s.err
+}
+
+func (s *failingSink) Close() error {
+	return s.err
+}
+
+func TestTeeSinkReturnsFirstError(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	sinks := []*failingSink{{err: first}, {}, {err: second}}
+	tee := &teeSink{sinks: []Sink{sinks[0], sinks[1], sinks[2]}}
+
+	err := tee.Send(context.Background(), []byte("{}"))
+	if errors.Cause(err) != first {
+		t.Fatalf("expected first error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 of 3 sinks failed") {
+		t.Fatalf("expected failed sink count, got: %v", err)
+	}
+	for i, s := range sinks {
+		if s.sent != 1 {
+			t.Fatalf("expected sink %d to get the event, sent: %d", i, s.sent)
+		}
+	}
+	if err := tee.Close(); err != first {
+		t.Fatalf("expected first close error, got: %v", err)
+	}
+}
@@ -10,8 +10,10 @@ import (
 
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
+	dapr "github.com/dapr/go-sdk/client"
 	"github.com/dapr/go-sdk/service/common"
 	daprd "github.com/dapr/go-sdk/service/grpc"
 	"github.com/pkg/errors"
@@ -19,6 +21,8 @@ import (
 
 const (
 	primeStateKey = "high-prime"
+	// time the canceled in-flight work has to return after the drain timeout
+	cancelTimeout = time.Second
 )
 
 var (
@@ -29,6 +33,17 @@ var (
 	processDuration = getEnvVar("PROCESS_DURATION", "500ms")
 	pubSubName      = getEnvVar("PUBSUB_NAME", "autoscaling-pubsub")
 	topicName       = getEnvVar("TOPIC_NAME", "metrics")
+	workMode        = getEnvVar("WORK_MODE", workModeSleep)
+	memorySize      = getEnvIntOrFail("MEMORY_SIZE_MB", "16")
+	stateStoreName  = getEnvVar("STATE_STORE_NAME", "autoscaling-state")
+	shutdownTimeout = getEnvDurationOrFail("SHUTDOWN_TIMEOUT", "10s")
+
+	poolSize           = getEnvIntOrFail("WORKER_POOL_SIZE", "10")
+	poolQueueSize      = getEnvIntOrFail("WORKER_QUEUE_SIZE", "10")
+	retryWhenSaturated = getEnvBoolOrFail("RETRY_WHEN_SATURATED", "false")
+	metricsAddress     = getEnvVar("METRICS_ADDRESS", ":8080")
+
+	client dapr.Client
 )
 
 func main() {
@@ -42,34 +57,79 @@ func main() {
 	if err != nil {
 		logger.Fatalf("invalid parameter (PROCESS_DURATION) must be a duration): %s - %v", processDuration, err)
 	}
+	if d < 0 {
+		logger.Fatalf("invalid parameter (PROCESS_DURATION) must not be negative: %s", processDuration)
+	}
+	if memorySize < 0 {
+		logger.Fatalf("invalid parameter (MEMORY_SIZE_MB) must not be negative: %d", memorySize)
+	}
 	reqProcDur = d
 
-	var mux sync.Mutex
-	var successCount int64 = 1
-	var errorCount int64 = 0
+	if !isValidWorkMode(workMode) {
+		logger.Fatalf("invalid parameter (WORK_MODE) must be one of sleep, cpu, memory, or mixed: %s", workMode)
+	}
+	logger.Printf("work mode: %s (%v)", workMode, reqProcDur)
+
+	// high prime is persisted only when the work includes CPU
+	if workMode == workModeCPU || workMode == workModeMixed {
+		c, err := dapr.NewClient()
+		if err != nil {
+			logger.Fatalf("error creating Dapr client: %v", err)
+		}
+		client = c
+		if err := loadHighPrime(context.Background()); err != nil {
+			logger.Fatalf("error loading high prime: %v", err)
+		}
+		logger.Printf("high prime: %d", currentHighPrime())
+	}
+
+	// in-flight work is drained on shutdown, and canceled only when that times out
+	workCtx, cancelWork := context.WithCancel(context.Background())
+
+	// handle signals
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-done
+		logger.Printf("received %v, shutting down...", sig)
+		cancel()
+	}()
+
+	// worker pool
+	pool := newWorkerPool(poolSize, poolQueueSize, processRequest)
+	logger.Printf("worker pool: %d workers, %d queue, retry when saturated: %v",
+		pool.size, cap(pool.queue), retryWhenSaturated)
+
+	// pool metrics
+	metricsMux := http.NewServeMux()
+	metricsMux.HandleFunc("/metrics", pool.metricsHandler)
+	metricsServer := &http.Server{Addr: metricsAddress, Handler: metricsMux}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("error starting metrics server: %v", err)
+		}
+	}()
 
-	resultCh := make(chan bool)
+	// workers count the results themselves, so handlers never wait on the reporting
 	startTime := time.Now()
 
+	report := func(prefix string) {
+		successCount, errorCount := pool.results()
+		var avg float64 = 0
+		if successCount > 0 {
+			avg = float64(successCount) / time.Since(startTime).Seconds()
+		}
+		active, queued, rejected := pool.stats()
+		logger.Printf("%sreceived: %10d, %3d errors - avg %3.0f/sec - active: %3d, queued: %3d, rejected: %d",
+			prefix, successCount, errorCount, avg, active, queued, rejected)
+	}
+
 	go func() {
-		tickerCh := time.NewTicker(5 * time.Second).C
-		for {
-			select {
-			case r := <-resultCh:
-				mux.Lock()
-				if r {
-					successCount++
-				} else {
-					errorCount++
-				}
-				mux.Unlock()
-			case <-tickerCh:
-				var avg float64 = 0
-				if successCount > 0 {
-					avg = float64(successCount) / time.Since(startTime).Seconds()
-				}
-				logger.Printf("received: %10d, %3d errors - avg %3.0f/sec", successCount, errorCount, avg)
-			}
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			report("")
 		}
 	}()
 
@@ -80,38 +140,135 @@ func main() {
 	}
 
 	// subscribe
+	inFlight := &inFlightTracker{}
 	if err := s.AddTopicEventHandler(subscription, func(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
-		if err := processRequest(ctx, e.Data); err != nil {
+		// once draining, hand the message back so it gets redelivered instead of lost
+		if !inFlight.start() {
+			return true, errors.New("service is shutting down")
+		}
+		defer inFlight.done()
+		wctx, wcancel := withCancel(ctx, workCtx)
+		defer wcancel()
+		err = pool.process(wctx, e.Data, retryWhenSaturated)
+		if err == errPoolSaturated {
+			return true, err
+		}
+		if err != nil {
 			logger.Printf("error processing request: %v", err)
-			resultCh <- false
 			return true, errors.Wrap(err, "error processing request")
 		}
-		resultCh <- true
 		return false, nil
 	}); err != nil {
 		logger.Fatalf("error adding topic subscription: %v", err)
 	}
 
-	// handle signals
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
 	// Start
+	serverErrCh := make(chan error, 1)
 	go func() {
-		if err := s.Start(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("error starting service: %v", err)
-		}
+		serverErrCh <- s.Start()
 	}()
 
 	// Finish
-	<-done
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+	case err := <-serverErrCh:
+		if err != nil && err != http.ErrServerClosed {
+			logger.Printf("error starting service: %v", err)
+			exitCode = 1
+		}
+		cancel()
+	}
+
+	// stop intake and drain the in-flight handlers
+	if err := s.Stop(); err != nil {
+		logger.Printf("error stopping service: %v", err)
+	}
+	if !inFlight.drain(shutdownTimeout) {
+		logger.Printf("timeout draining in-flight requests after %v, canceling them", shutdownTimeout)
+		exitCode = 1
+		// canceled work returns its messages to Dapr for redelivery
+		cancelWork()
+		if !inFlight.drain(cancelTimeout) {
+			logger.Printf("timeout waiting for canceled requests after %v", cancelTimeout)
+		}
+	}
+	cancelWork()
+
+	mctx, mcancel := context.WithTimeout(context.Background(), time.Second)
+	if err := metricsServer.Shutdown(mctx); err != nil {
+		logger.Printf("error stopping metrics server: %v", err)
+	}
+	mcancel()
+
+	// flush final stats
+	report("final: ")
+
+	if client != nil {
+		client.Close()
+	}
+	logger.Printf("done, exit code: %d", exitCode)
+	os.Exit(exitCode)
+}
+
+// inFlightTracker tracks the in-flight handlers and prevents new ones once draining
+type inFlightTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// start registers new in-flight handler, returns false when already draining
+func (t *inFlightTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+// done marks previously started handler as completed
+func (t *inFlightTracker) done() {
+	t.wg.Done()
+}
+
+// drain stops new handlers and waits for the in-flight ones, returns false on timeout
+func (t *inFlightTracker) drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	doneCh := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// withCancel returns context derived from ctx which is also canceled when cancelCtx is done
+func withCancel(ctx, cancelCtx context.Context) (context.Context, context.CancelFunc) {
+	c, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-cancelCtx.Done():
+			cancel()
+		case <-c.Done():
+		}
+	}()
+	return c, cancel
 }
 
 // does some computing to keep the process busy organically
 func processRequest(ctx context.Context, in interface{}) error {
-	tickerCh := time.NewTicker(reqProcDur).C
-	<-tickerCh
-	return nil
+	return doWork(ctx, workMode, reqProcDur)
 }
 
 func getEnvVar(key, fallbackValue string) string {
@@ -120,3 +277,30 @@ func getEnvVar(key, fallbackValue string) string {
 	}
 	return fallbackValue
 }
+
+func getEnvIntOrFail(key, fallbackValue string) int {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
+
+func getEnvDurationOrFail(key, fallbackValue string) time.Duration {
+	s := getEnvVar(key, fallbackValue)
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Fatalf("invalid duration variable: %s - %v", s, err)
+	}
+	return v
+}
+
+func getEnvBoolOrFail(key, fallbackValue string) bool {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		logger.Fatalf("invalid bool variable: %s - %v", s, err)
+	}
+	return v
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errPoolSaturated = errors.New("worker pool saturated")
+)
+
+// job is a single unit of work submitted to the pool
+type job struct {
+	ctx   context.Context
+	data  interface{}
+	errCh chan error
+}
+
+// workerPool processes submitted jobs with bounded concurrency and queue
+type workerPool struct {
+	size      int
+	queue     chan *job
+	fn        func(ctx context.Context, in interface{}) error
+	active    int64
+	rejected  int64
+	succeeded int64
+	failed    int64
+}
+
+// newWorkerPool creates and starts a pool of size workers executing fn
+func newWorkerPool(size, queueSize int, fn func(ctx context.Context, in interface{}) error) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &workerPool{
+		size:  size,
+		queue: make(chan *job, queueSize),
+		fn:    fn,
+	}
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for j := range p.queue {
+		atomic.AddInt64(&p.active, 1)
+		err := p.fn(j.ctx, j.data)
+		if err != nil {
+			atomic.AddInt64(&p.failed, 1)
+		} else {
+			atomic.AddInt64(&p.succeeded, 1)
+		}
+		atomic.AddInt64(&p.active, -1)
+		j.errCh <- err
+	}
+}
+
+// process submits data to the pool and waits for its result.
+// When the pool is saturated, it either waits for room in the queue (backpressure)
+// or, when reject is set, returns errPoolSaturated right away.
+func (p *workerPool) process(ctx context.Context, data interface{}, reject bool) error {
+	j := &job{ctx: ctx, data: data, errCh: make(chan error, 1)}
+	if reject {
+		select {
+		case p.queue <- j:
+		default:
+			atomic.AddInt64(&p.rejected, 1)
+			return errPoolSaturated
+		}
+	} else {
+		select {
+		case p.queue <- j:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return <-j.errCh
+}
+
+// stats returns the current concurrency, queue depth and rejection count
+func (p *workerPool) stats() (active, queued, rejected int64) {
+	return atomic.LoadInt64(&p.active), int64(len(p.queue)), atomic.LoadInt64(&p.rejected)
+}
+
+// results returns the number of jobs processed successfully and with error
+func (p *workerPool) results() (succeeded, failed int64) {
+	return atomic.LoadInt64(&p.succeeded), atomic.LoadInt64(&p.failed)
+}
+
+// metricsHandler exports pool stats in Prometheus text format
+func (p *workerPool) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	active, queued, rejected := p.stats()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP subscriber_pool_size Number of workers in the pool.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_size gauge\n")
+	fmt.Fprintf(w, "subscriber_pool_size %d\n", p.size)
+	fmt.Fprintf(w, "# HELP subscriber_pool_active Number of workers currently processing.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_active gauge\n")
+	fmt.Fprintf(w, "subscriber_pool_active %d\n", active)
+	fmt.Fprintf(w, "# HELP subscriber_pool_queue_capacity Capacity of the pool queue.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_queue_capacity gauge\n")
+	fmt.Fprintf(w, "subscriber_pool_queue_capacity %d\n", cap(p.queue))
+	fmt.Fprintf(w, "# HELP subscriber_pool_queue_depth Number of messages waiting for a worker.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_queue_depth gauge\n")
+	fmt.Fprintf(w, "subscriber_pool_queue_depth %d\n", queued)
+	fmt.Fprintf(w, "# HELP subscriber_pool_rejected_total Number of messages rejected when pool was saturated.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_rejected_total counter\n")
+	fmt.Fprintf(w, "subscriber_pool_rejected_total %d\n", rejected)
+	succeeded, failed := p.results()
+	fmt.Fprintf(w, "# HELP subscriber_pool_processed_total Number of messages processed by the workers.\n")
+	fmt.Fprintf(w, "# TYPE subscriber_pool_processed_total counter\n")
+	fmt.Fprintf(w, "subscriber_pool_processed_total{result=\"success\"} %d\n", succeeded)
+	fmt.Fprintf(w, "subscriber_pool_processed_total{result=\"error\"} %d\n", failed)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// blockingPool returns pool of size workers which block until release is closed
+func blockingPool(size, queueSize int) (p *workerPool, started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, size+queueSize+1)
+	release = make(chan struct{})
+	p = newWorkerPool(size, queueSize, func(ctx context.Context, in interface{}) error {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	return p, started, release
+}
+
+func TestPoolProcessReturnsResult(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := newWorkerPool(2, 0, func(ctx context.Context, in interface{}) error {
+		if in.(int)%2 == 0 {
+			return errFailed
+		}
+		return nil
+	})
+
+	for i := 0; i < 10; i++ {
+		err := p.process(context.Background(), i, false)
+		if i%2 == 0 && err != errFailed {
+			t.Fatalf("expected error for %d, got: %v", i, err)
+		}
+		if i%2 == 1 && err != nil {
+			t.Fatalf("unexpected error for %d: %v", i, err)
+		}
+	}
+}
+
+func TestPoolCountsResultsConcurrently(t *testing.T) {
+	const size, jobs = 4, 200
+	p := newWorkerPool(size, size, func(ctx context.Context, in interface{}) error {
+		if in.(int)%4 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.process(context.Background(), i, false)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded, failed := p.results()
+	if succeeded != jobs*3/4 || failed != jobs/4 {
+		t.Fatalf("unexpected results (succeeded:%d, failed:%d)", succeeded, failed)
+	}
+}
+
+func TestPoolBoundsConcurrency(t *testing.T) {
+	const size = 3
+	var mu sync.Mutex
+	var active, max int
+	p := newWorkerPool(size, 10, func(ctx context.Context, in interface{}) error {
+		mu.Lock()
+		active++
+		if active > max {
+			max = active
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := p.process(context.Background(), i, false); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if max > size {
+		t.Fatalf("expected at most %d concurrent jobs, got: %d", size, max)
+	}
+}
+
+func TestPoolRejectsWhenSaturated(t *testing.T) {
+	p, started, release := blockingPool(1, 1)
+	defer close(release)
+
+	// first job occupies the worker, second one the queue
+	go p.process(context.Background(), 1, true)
+	<-started
+	go p.process(context.Background(), 2, true)
+	waitFor(t, func() bool { _, queued, _ := p.stats(); return queued == 1 })
+
+	if err := p.process(context.Background(), 3, true); err != errPoolSaturated {
+		t.Fatalf("expected saturation error, got: %v", err)
+	}
+	active, queued, rejected := p.stats()
+	if active != 1 || queued != 1 || rejected != 1 {
+		t.Fatalf("unexpected stats (active:%d, queued:%d, rejected:%d)", active, queued, rejected)
+	}
+}
+
+func TestPoolWaitsForRoomUntilCanceled(t *testing.T) {
+	p, started, release := blockingPool(1, 0)
+	defer close(release)
+
+	go p.process(context.Background(), 1, false)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.process(ctx, 2, false); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got: %v", err)
+	}
+	if _, _, rejected := p.stats(); rejected != 0 {
+		t.Fatalf("expected no rejections with backpressure, got: %d", rejected)
+	}
+}
+
+func TestPoolCancelsInFlightJob(t *testing.T) {
+	p, started, release := blockingPool(1, 0)
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- p.process(ctx, 1, false) }()
+	<-started
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("expected canceled error, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight job not canceled")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	workModeSleep  = "sleep"
+	workModeCPU    = "cpu"
+	workModeMemory = "memory"
+	workModeMixed  = "mixed"
+
+	// number of prime candidates checked between deadline checks
+	primeCheckBatch = 1000
+	// stride used to touch allocated memory so each page is actually committed
+	memoryPageSize = 4096
+)
+
+var (
+	mixedModes = []string{workModeSleep, workModeCPU, workModeMemory}
+
+	highPrimeMux sync.Mutex
+	highPrime    int64
+	// primeCursor is the next prime candidate not yet handed out to any worker
+	primeCursor int64
+	// saveMux orders the saves of new high primes so that lower one never overwrites higher one
+	saveMux sync.Mutex
+)
+
+// isValidWorkMode checks if the provided mode is one of the supported work modes
+func isValidWorkMode(mode string) bool {
+	switch mode {
+	case workModeSleep, workModeCPU, workModeMemory, workModeMixed:
+		return true
+	default:
+		return false
+	}
+}
+
+// doWork performs the configured kind of work for the provided duration
+func doWork(ctx context.Context, mode string, d time.Duration) error {
+	switch mode {
+	case workModeSleep:
+		return sleepWork(ctx, d)
+	case workModeCPU:
+		return cpuWork(ctx, d)
+	case workModeMemory:
+		return memoryWork(ctx, d)
+	case workModeMixed:
+		// random mode for random duration between 0.5x and 1.5x of the configured one
+		m := mixedModes[rand.Intn(len(mixedModes))]
+		rd := d/2 + time.Duration(rand.Int63n(int64(d)+1))
+		return doWork(ctx, m, rd)
+	default:
+		return errors.Errorf("invalid work mode: %s", mode)
+	}
+}
+
+// sleepWork simply waits for the duration, no resources consumed
+func sleepWork(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// cpuWork searches for primes above the highest one found so far until
+// the duration expires, and persists the new highest prime into state
+func cpuWork(ctx context.Context, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	var max int64
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n := nextPrimeBatch()
+		for i := int64(0); i < primeCheckBatch; i++ {
+			if isPrime(n + i) {
+				max = n + i
+			}
+		}
+	}
+	return saveHighPrime(ctx, max)
+}
+
+// nextPrimeBatch reserves the next batch of prime candidates above the highest prime,
+// so that the concurrent workers never check the same numbers
+func nextPrimeBatch() int64 {
+	highPrimeMux.Lock()
+	defer highPrimeMux.Unlock()
+	if primeCursor <= highPrime {
+		primeCursor = highPrime + 1
+	}
+	n := primeCursor
+	primeCursor += primeCheckBatch
+	return n
+}
+
+// memoryWork allocates and touches memory, and holds on to it for the duration
+func memoryWork(ctx context.Context, d time.Duration) error {
+	b := make([]byte, memorySize*1024*1024)
+	for i := 0; i < len(b); i += memoryPageSize {
+		b[i] = byte(i)
+	}
+	err := sleepWork(ctx, d)
+	runtime.KeepAlive(b)
+	return err
+}
+
+func isPrime(n int64) bool {
+	if n < 2 {
+		return false
+	}
+	if n%2 == 0 {
+		return n == 2
+	}
+	for i := int64(3); i*i <= n; i += 2 {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func currentHighPrime() int64 {
+	highPrimeMux.Lock()
+	defer highPrimeMux.Unlock()
+	return highPrime
+}
+
+// loadHighPrime loads the highest prime persisted by the previous runs,
+// so that the search continues from it and it's not overwritten by lower one
+func loadHighPrime(ctx context.Context) error {
+	item, err := client.GetState(ctx, stateStoreName, primeStateKey)
+	if err != nil {
+		return errors.Wrapf(err, "error loading %s from %s", primeStateKey, stateStoreName)
+	}
+	if item == nil || len(item.Value) == 0 {
+		return nil
+	}
+	p, err := strconv.ParseInt(string(item.Value), 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s value: %s", primeStateKey, item.Value)
+	}
+	highPrimeMux.Lock()
+	defer highPrimeMux.Unlock()
+	if p > highPrime {
+		highPrime = p
+	}
+	return nil
+}
+
+// saveHighPrime persists the prime when it's higher than the highest one found so far.
+// The check doesn't wait for the state store, only the saves of new high primes do.
+func saveHighPrime(ctx context.Context, p int64) error {
+	highPrimeMux.Lock()
+	if p <= highPrime {
+		highPrimeMux.Unlock()
+		return nil
+	}
+	highPrime = p
+	highPrimeMux.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	saveMux.Lock()
+	defer saveMux.Unlock()
+	if p < currentHighPrime() {
+		// higher prime found meanwhile, its own save persists it
+		return nil
+	}
+	data := []byte(strconv.FormatInt(p, 10))
+	if err := client.SaveState(ctx, stateStoreName, primeStateKey, data); err != nil {
+		return errors.Wrapf(err, "error saving %s to %s", primeStateKey, stateStoreName)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/pkg/errors"
+)
+
+// fakeClient keeps state in memory, other client methods are not implemented
+type fakeClient struct {
+	dapr.Client
+	mu      sync.Mutex
+	state   map[string][]byte
+	saves   int
+	saveErr error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{state: map[string][]byte{}}
+}
+
+func (c *fakeClient) GetState(ctx context.Context, store, key string) (*dapr.StateItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &dapr.StateItem{Key: key, Value: c.state[store+"/"+key]}, nil
+}
+
+func (c *fakeClient) SaveState(ctx context.Context, store, key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.saveErr != nil {
+		return c.saveErr
+	}
+	c.saves++
+	c.state[store+"/"+key] = data
+	return nil
+}
+
+func (c *fakeClient) savedPrime(t *testing.T) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v := c.state[stateStoreName+"/"+primeStateKey]
+	if len(v) == 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid saved prime %s: %v", v, err)
+	}
+	return p
+}
+
+// withClient resets the high prime state and sets the client for the duration of the test
+func withClient(t *testing.T, c dapr.Client) {
+	reset := func() {
+		highPrimeMux.Lock()
+		highPrime, primeCursor = 0, 0
+		highPrimeMux.Unlock()
+	}
+	reset()
+	client = c
+	t.Cleanup(func() {
+		reset()
+		client = nil
+	})
+}
+
+func TestDoWork(t *testing.T) {
+	withClient(t, nil)
+	const d = 20 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		mode    string
+		min     time.Duration
+		max     time.Duration
+		wantErr bool
+	}{
+		{name: "sleep", mode: workModeSleep, min: d, max: 10 * d},
+		{name: "cpu", mode: workModeCPU, min: d, max: 10 * d},
+		{name: "memory", mode: workModeMemory, min: d, max: 10 * d},
+		{name: "mixed", mode: workModeMixed, min: d / 2, max: 10 * d},
+		{name: "invalid mode", mode: "nap", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := doWork(context.Background(), tt.mode, d)
+			took := time.Since(start)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for mode %s", tt.mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if took < tt.min || took > tt.max {
+				t.Fatalf("expected work to take between %v and %v, took %v", tt.min, tt.max, took)
+			}
+		})
+	}
+}
+
+func TestDoWorkCanceled(t *testing.T) {
+	withClient(t, nil)
+	for _, mode := range []string{workModeSleep, workModeCPU, workModeMemory, workModeMixed} {
+		t.Run(mode, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := doWork(ctx, mode, time.Minute); err != context.Canceled {
+				t.Fatalf("expected canceled error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestCPUWorkFindsHigherPrimes(t *testing.T) {
+	withClient(t, nil)
+	if err := doWork(context.Background(), workModeCPU, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := currentHighPrime()
+	if !isPrime(first) {
+		t.Fatalf("expected high prime, got: %d", first)
+	}
+	if err := doWork(context.Background(), workModeCPU, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second := currentHighPrime(); second <= first {
+		t.Fatalf("expected prime higher than %d, got: %d", first, second)
+	}
+}
+
+func TestNextPrimeBatchDoesNotOverlap(t *testing.T) {
+	withClient(t, nil)
+	const workers, batches = 8, 100
+
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < batches; i++ {
+				n := nextPrimeBatch()
+				mu.Lock()
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != workers*batches {
+		t.Fatalf("expected %d distinct batches, got: %d", workers*batches, len(seen))
+	}
+	for n := range seen {
+		if (n-1)%primeCheckBatch != 0 {
+			t.Fatalf("expected batch to start at multiple of %d after 1, got: %d", primeCheckBatch, n)
+		}
+	}
+}
+
+func TestNextPrimeBatchStartsAboveHighPrime(t *testing.T) {
+	withClient(t, nil)
+	nextPrimeBatch()
+	highPrimeMux.Lock()
+	highPrime = 1000003
+	highPrimeMux.Unlock()
+	if n := nextPrimeBatch(); n != 1000004 {
+		t.Fatalf("expected batch to start after high prime, got: %d", n)
+	}
+}
+
+func TestHighPrimePersistence(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    string
+		saves     []int64
+		wantHigh  int64
+		wantSaved int64
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "empty state", saves: []int64{7, 13}, wantHigh: 13, wantSaved: 13, wantCount: 2},
+		{name: "continues from stored", stored: "101", saves: []int64{103}, wantHigh: 103, wantSaved: 103, wantCount: 1},
+		{name: "lower not saved", stored: "101", saves: []int64{97, 0}, wantHigh: 101, wantSaved: 101},
+		{name: "invalid stored", stored: "prime", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient()
+			if tt.stored != "" {
+				c.state[stateStoreName+"/"+primeStateKey] = []byte(tt.stored)
+			}
+			withClient(t, c)
+
+			err := loadHighPrime(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error loading %s", tt.stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error loading: %v", err)
+			}
+			for _, p := range tt.saves {
+				if err := saveHighPrime(context.Background(), p); err != nil {
+					t.Fatalf("unexpected error saving %d: %v", p, err)
+				}
+			}
+			if got := currentHighPrime(); got != tt.wantHigh {
+				t.Fatalf("expected high prime %d, got: %d", tt.wantHigh, got)
+			}
+			if got := c.savedPrime(t); got != tt.wantSaved {
+				t.Fatalf("expected saved prime %d, got: %d", tt.wantSaved, got)
+			}
+			if c.saves != tt.wantCount {
+				t.Fatalf("expected %d saves, got: %d", tt.wantCount, c.saves)
+			}
+		})
+	}
+}
+
+func TestSaveHighPrimeError(t *testing.T) {
+	c := newFakeClient()
+	c.saveErr = errors.New("store unavailable")
+	withClient(t, c)
+	if err := saveHighPrime(context.Background(), 11); err == nil {
+		t.Fatal("expected error when state store fails")
+	}
+}
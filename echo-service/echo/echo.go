@@ -0,0 +1,422 @@
+// Package echo provides the echo service invocation handlers shared by the echo
+// services, served over HTTP, gRPC, or both at once.
+package echo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	modeEcho    = "echo"
+	modeReverse = "reverse"
+	modeUpper   = "uppercase"
+	modePretty  = "pretty"
+	modeConvert = "convert"
+	modeHash    = "hash"
+
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatYAML = "yaml"
+
+	// prefix of the metadata keys used as options when not set in query string
+	metadataPrefix = "echo-"
+	// root element of XML converted from content without single top level key
+	defaultXMLRoot = "echo"
+	// element of each item of list converted to XML
+	xmlItem = "item"
+)
+
+var (
+	contentTypes = map[string]string{
+		formatJSON: "application/json",
+		formatXML:  "application/xml",
+		formatYAML: "application/x-yaml",
+	}
+
+	hashes = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// echoOptions selects the transformation of the echoed content
+type echoOptions struct {
+	// Mode is the transformation: echo, reverse, uppercase, pretty, convert, or hash.
+	Mode string
+	// From is the format of the content to convert, defaults to one based on content type.
+	From string
+	// To is the format to convert the content into: json, xml, or yaml.
+	To string
+	// Algo is the hash algorithm: md5, sha1, sha256 (default), or sha512.
+	Algo string
+	// Delay is the delay before the response.
+	Delay time.Duration
+	// Status is the HTTP status (400-599) of the injected error, 0 means no error.
+	Status int
+}
+
+// injectedError is the error requested using the status option or injected by the fault profile,
+// it's returned with its status over HTTP, and with the corresponding code over gRPC
+type injectedError struct {
+	status int
+}
+
+func (e *injectedError) Error() string {
+	return fmt.Sprintf("injected error: %d %s", e.status, http.StatusText(e.status))
+}
+
+// HTTPStatus returns the status of the HTTP response
+func (e *injectedError) HTTPStatus() int {
+	return e.status
+}
+
+// GRPCStatus returns the gRPC status with the code corresponding to the HTTP status
+func (e *injectedError) GRPCStatus() *status.Status {
+	return status.New(grpcCode(e.status), e.Error())
+}
+
+// parseOptions reads options from the query string or, when not set there,
+// from the echo- prefixed gRPC metadata or HTTP headers (e.g. echo-mode)
+func parseOptions(ctx context.Context, in *common.InvocationEvent) (*echoOptions, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v, ok := in.QueryString[key]; ok {
+			return strings.TrimSpace(v)
+		}
+		if v := md.Get(metadataPrefix + key); len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+
+	o := &echoOptions{
+		Mode: strings.ToLower(get("mode")),
+		From: strings.ToLower(get("from")),
+		To:   strings.ToLower(get("to")),
+		Algo: strings.ToLower(get("algo")),
+	}
+	if o.Mode == "" {
+		o.Mode = modeEcho
+	}
+	if v := get("delay"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, errors.Errorf("invalid delay: %s", v)
+		}
+		o.Delay = d
+	}
+	if v := get("status"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil || s < http.StatusBadRequest || s > 599 {
+			return nil, errors.Errorf("invalid status: %s", v)
+		}
+		o.Status = s
+	}
+	return o, nil
+}
+
+// echo applies the delay, the error, and the transformation selected by options
+func echo(ctx context.Context, o *echoOptions, in *common.InvocationEvent) (*common.Content, error) {
+	if err := sleep(ctx, o.Delay); err != nil {
+		return nil, err
+	}
+	if o.Status != 0 {
+		return nil, &injectedError{status: o.Status}
+	}
+
+	out := &common.Content{ContentType: in.ContentType, Data: in.Data}
+	switch o.Mode {
+	case modeEcho:
+	case modeReverse:
+		out.Data = reverse(in.Data)
+	case modeUpper:
+		out.Data = bytes.ToUpper(in.Data)
+	case modePretty:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, in.Data, "", "  "); err != nil {
+			return nil, errors.Wrap(err, "error formatting JSON")
+		}
+		out.Data = buf.Bytes()
+	case modeConvert:
+		from := o.From
+		if from == "" {
+			from = formatOf(in.ContentType)
+		}
+		b, err := convert(in.Data, from, o.To)
+		if err != nil {
+			return nil, err
+		}
+		out.Data, out.ContentType = b, contentTypes[o.To]
+	case modeHash:
+		algo := o.Algo
+		if algo == "" {
+			algo = "sha256"
+		}
+		fn, ok := hashes[algo]
+		if !ok {
+			return nil, errors.Errorf("invalid hash algorithm (md5, sha1, sha256, sha512): %s", algo)
+		}
+		h := fn()
+		h.Write(in.Data)
+		out.Data, out.ContentType = []byte(hex.EncodeToString(h.Sum(nil))), "text/plain"
+	default:
+		return nil, errors.Errorf("invalid mode (echo, reverse, uppercase, pretty, convert, hash): %s", o.Mode)
+	}
+	return out, nil
+}
+
+// reverse reverses UTF-8 text by runes, and any other content by bytes
+func reverse(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	if !utf8.Valid(b) {
+		for i := len(b) - 1; i >= 0; i-- {
+			out = append(out, b[i])
+		}
+		return out
+	}
+	for len(b) > 0 {
+		r, size := utf8.DecodeLastRune(b)
+		out = append(out, string(r)...)
+		b = b[:len(b)-size]
+	}
+	return out
+}
+
+// formatOf returns the format of the content type
+func formatOf(contentType string) string {
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(ct, "json"):
+		return formatJSON
+	case strings.Contains(ct, "xml"):
+		return formatXML
+	case strings.Contains(ct, "yaml"):
+		return formatYAML
+	default:
+		return ""
+	}
+}
+
+// convert converts the content between json, xml, and yaml formats
+func convert(data []byte, from, to string) ([]byte, error) {
+	if _, ok := contentTypes[to]; !ok {
+		return nil, errors.Errorf("invalid target format (json, xml, yaml): %s", to)
+	}
+
+	var v interface{}
+	switch from {
+	case formatJSON:
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, errors.Wrap(err, "error parsing JSON")
+		}
+	case formatYAML:
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, errors.Wrap(err, "error parsing YAML")
+		}
+		v = normalize(v)
+	case formatXML:
+		x, err := parseXML(data)
+		if err != nil {
+			return nil, err
+		}
+		v = x
+	default:
+		return nil, errors.Errorf("invalid source format (json, xml, yaml), set it using content type or from: %s", from)
+	}
+
+	switch to {
+	case formatJSON:
+		return json.Marshal(v)
+	case formatYAML:
+		return yaml.Marshal(v)
+	default:
+		return marshalXML(v)
+	}
+}
+
+// normalize converts the YAML maps into JSON compatible ones
+func normalize(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, mv := range tv {
+			m[fmt.Sprint(k)] = normalize(mv)
+		}
+		return m
+	case []interface{}:
+		for i, lv := range tv {
+			tv[i] = normalize(lv)
+		}
+		return tv
+	default:
+		return v
+	}
+}
+
+// parseXML parses XML into map with the root element name as its only key,
+// repeated elements become lists, and attributes are ignored
+func parseXML(data []byte) (map[string]interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing XML")
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			v, err := parseElement(d)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{se.Name.Local: v}, nil
+		}
+	}
+}
+
+func parseElement(d *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var children map[string]interface{}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing XML")
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			v, err := parseElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]interface{})
+			}
+			name := tt.Name.Local
+			switch ev := children[name].(type) {
+			case nil:
+				children[name] = v
+			case []interface{}:
+				children[name] = append(ev, v)
+			default:
+				children[name] = []interface{}{ev, v}
+			}
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return strings.TrimSpace(text.String()), nil
+		}
+	}
+}
+
+// marshalXML writes the value as XML under single root element, map with single key
+// (which is not a list) is used as the root element, anything else goes under the echo root
+func marshalXML(v interface{}) ([]byte, error) {
+	root, content := defaultXMLRoot, v
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		for k, mv := range m {
+			if _, list := mv.([]interface{}); !list {
+				root, content = k, mv
+			}
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := writeSingle(&buf, root, content); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeElement writes the value as element, lists as repeated elements of the same name
+func writeElement(w io.Writer, name string, v interface{}) error {
+	if l, ok := v.([]interface{}); ok {
+		for _, lv := range l {
+			if err := writeSingle(w, name, lv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeSingle(w, name, v)
+}
+
+// writeSingle writes the value as single element, items of list value become item elements
+func writeSingle(w io.Writer, name string, v interface{}) error {
+	if !isXMLName(name) {
+		return errors.Errorf("key is not valid XML element name: %s", name)
+	}
+	fmt.Fprintf(w, "<%s>", name)
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := writeElement(w, k, tv[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, lv := range tv {
+			if err := writeSingle(w, xmlItem, lv); err != nil {
+				return err
+			}
+		}
+	case nil:
+	case float64:
+		if err := xml.EscapeText(w, []byte(strconv.FormatFloat(tv, 'f', -1, 64))); err != nil {
+			return errors.Wrapf(err, "error writing XML element: %s", name)
+		}
+	default:
+		if err := xml.EscapeText(w, []byte(fmt.Sprint(tv))); err != nil {
+			return errors.Wrapf(err, "error writing XML element: %s", name)
+		}
+	}
+	fmt.Fprintf(w, "</%s>", name)
+	return nil
+}
+
+// isXMLName returns true when the name is valid non-qualified XML name (NCName)
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
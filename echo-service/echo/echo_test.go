@@ -0,0 +1,87 @@
+package echo
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dapr/go-sdk/service/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConvertToXMLUsesSingleRoot(t *testing.T) {
+	list := []struct {
+		in, want string
+	}{
+		{`{"reading":{"temp":21.5}}`, `<reading><temp>21.5</temp></reading>`},
+		{`{"temp":21.5,"room":"kitchen"}`, `<echo><room>kitchen</room><temp>21.5</temp></echo>`},
+		{`[1,2]`, `<echo><item>1</item><item>2</item></echo>`},
+		{`{"temp":[1,2]}`, `<echo><temp>1</temp><temp>2</temp></echo>`},
+		{`{"temp":[[1,2],3]}`, `<echo><temp><item>1</item><item>2</item></temp><temp>3</temp></echo>`},
+		{`"ping"`, `<echo>ping</echo>`},
+	}
+	for _, c := range list {
+		b, err := convert([]byte(c.in), formatJSON, formatXML)
+		if err != nil {
+			t.Fatalf("error converting %s: %v", c.in, err)
+		}
+		if got := strings.TrimPrefix(string(b), xml.Header); got != c.want {
+			t.Errorf("expected %s converted to %s, got: %s", c.in, c.want, got)
+		}
+	}
+}
+
+func TestConvertToXMLRejectsInvalidElementNames(t *testing.T) {
+	for _, in := range []string{`{"1st":1}`, `{"a b":1,"c":2}`, `{"reading":{"<x>":1}}`, `{"":1}`} {
+		if _, err := convert([]byte(in), formatJSON, formatXML); err == nil {
+			t.Errorf("expected error converting %s", in)
+		}
+	}
+}
+
+func TestConvertXMLRoundTrip(t *testing.T) {
+	b, err := convert([]byte(`[{"id":"1"},{"id":"2"}]`), formatJSON, formatXML)
+	if err != nil {
+		t.Fatalf("error converting to XML: %v", err)
+	}
+	b, err = convert(b, formatXML, formatJSON)
+	if err != nil {
+		t.Fatalf("error converting from XML: %v", err)
+	}
+	if want := `{"echo":{"item":[{"id":"1"},{"id":"2"}]}}`; string(b) != want {
+		t.Fatalf("expected %s, got: %s", want, b)
+	}
+}
+
+func TestParseOptionsRejectsNonErrorStatus(t *testing.T) {
+	for _, s := range []string{"200", "302", "399", "600", "x"} {
+		in := &common.InvocationEvent{QueryString: map[string]string{"status": s}}
+		if _, err := parseOptions(context.Background(), in); err == nil {
+			t.Errorf("expected error for status %s", s)
+		}
+	}
+	in := &common.InvocationEvent{QueryString: map[string]string{"status": "400"}}
+	if o, err := parseOptions(context.Background(), in); err != nil || o.Status != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got: %v", err)
+	}
+}
+
+func TestInjectedErrorMapsToGRPCCode(t *testing.T) {
+	list := map[int]codes.Code{
+		http.StatusBadRequest:         codes.InvalidArgument,
+		http.StatusNotFound:           codes.NotFound,
+		http.StatusTooManyRequests:    codes.ResourceExhausted,
+		http.StatusServiceUnavailable: codes.Unavailable,
+		http.StatusGatewayTimeout:     codes.DeadlineExceeded,
+		http.StatusTeapot:             codes.Unknown,
+	}
+	for s, want := range list {
+		err := &injectedError{status: s}
+		if got := status.Code(err); got != want {
+			t.Errorf("expected %d mapped to %s, got: %s", s, want, got)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package echo
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	latencyNone        = ""
+	latencyFixed       = "fixed"
+	latencyUniform     = "uniform"
+	latencyNormal      = "normal"
+	latencyExponential = "exponential"
+
+	defaultFaultStatus  = http.StatusInternalServerError
+	defaultFaultTimeout = 30 * time.Second
+)
+
+// FaultProfile defines the faults injected into echo invocations
+type FaultProfile struct {
+	// ErrorRate is the percentage (0-100) of invocations which fail with ErrorStatus.
+	ErrorRate   float64 `json:"error_rate"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	// LatencyDist is the distribution of added latency: fixed, uniform, normal, or exponential.
+	LatencyDist string `json:"latency_dist,omitempty"`
+	// LatencyMean is the fixed latency, or the mean of normal and exponential distributions.
+	LatencyMean string `json:"latency_mean,omitempty"`
+	// LatencyStddev is the standard deviation of normal distribution.
+	LatencyStddev string `json:"latency_stddev,omitempty"`
+	// LatencyMin and LatencyMax bound the uniform distribution, and clamp the others when set.
+	LatencyMin string `json:"latency_min,omitempty"`
+	LatencyMax string `json:"latency_max,omitempty"`
+	// TimeoutRate is the percentage (0-100) of invocations which hang for Timeout and then fail.
+	TimeoutRate float64 `json:"timeout_rate"`
+	Timeout     string  `json:"timeout,omitempty"`
+
+	mean, stddev, min, max, timeout time.Duration
+}
+
+// init validates the profile, sets its defaults, and parses its durations
+func (p *FaultProfile) init() error {
+	if p.ErrorRate < 0 || p.ErrorRate > 100 || p.TimeoutRate < 0 || p.TimeoutRate > 100 {
+		return errors.Errorf("invalid error (%v) or timeout (%v) rate, expected 0-100", p.ErrorRate, p.TimeoutRate)
+	}
+	if p.ErrorStatus == 0 {
+		p.ErrorStatus = defaultFaultStatus
+	}
+	if p.ErrorStatus < http.StatusBadRequest || p.ErrorStatus > 599 {
+		return errors.Errorf("invalid error status: %d", p.ErrorStatus)
+	}
+	p.LatencyDist = strings.ToLower(p.LatencyDist)
+	switch p.LatencyDist {
+	case latencyNone, latencyFixed, latencyUniform, latencyNormal, latencyExponential:
+	default:
+		return errors.Errorf("invalid latency distribution (fixed, uniform, normal, exponential): %s", p.LatencyDist)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"latency mean", p.LatencyMean, &p.mean},
+		{"latency stddev", p.LatencyStddev, &p.stddev},
+		{"latency min", p.LatencyMin, &p.min},
+		{"latency max", p.LatencyMax, &p.max},
+		{"timeout", p.Timeout, &p.timeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+		*d.to = v
+	}
+	if p.max > 0 && p.max < p.min {
+		return errors.Errorf("invalid latency range: %v-%v", p.min, p.max)
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultFaultTimeout
+	}
+	return nil
+}
+
+// latency returns the next latency from the profile distribution
+func (p *FaultProfile) latency(rnd *rand.Rand) time.Duration {
+	var d float64
+	switch p.LatencyDist {
+	case latencyFixed:
+		d = float64(p.mean)
+	case latencyUniform:
+		d = float64(p.min) + rnd.Float64()*float64(p.max-p.min)
+	case latencyNormal:
+		d = float64(p.mean) + rnd.NormFloat64()*float64(p.stddev)
+	case latencyExponential:
+		d = rnd.ExpFloat64() * float64(p.mean)
+	default:
+		return 0
+	}
+	d = math.Max(d, float64(p.min))
+	if p.max > 0 {
+		d = math.Min(d, float64(p.max))
+	}
+	return time.Duration(d)
+}
+
+// faultInjector applies the current fault profile, the profile can be replaced at runtime
+type faultInjector struct {
+	mu      sync.Mutex
+	profile *FaultProfile
+	rnd     *rand.Rand
+}
+
+func newFaultInjector(p *FaultProfile) (*faultInjector, error) {
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	return &faultInjector{profile: p, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// get returns the current profile
+func (f *faultInjector) get() *FaultProfile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.profile
+}
+
+// set replaces the current profile
+func (f *faultInjector) set(p *FaultProfile) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.profile = p
+	return nil
+}
+
+// apply delays the invocation and decides whether it times out or fails
+func (f *faultInjector) apply(ctx context.Context) error {
+	f.mu.Lock()
+	p := f.profile
+	delay := p.latency(f.rnd)
+	timeout := p.TimeoutRate > 0 && f.rnd.Float64()*100 < p.TimeoutRate
+	fail := p.ErrorRate > 0 && f.rnd.Float64()*100 < p.ErrorRate
+	f.mu.Unlock()
+
+	if timeout {
+		delay += p.timeout
+	}
+	if err := sleep(ctx, delay); err != nil {
+		return err
+	}
+	if timeout {
+		return &injectedError{status: http.StatusGatewayTimeout}
+	}
+	if fail {
+		return &injectedError{status: p.ErrorStatus}
+	}
+	return nil
+}
+
+// faultHandler returns the current fault profile, replaces it with the posted one,
+// or, on DELETE, clears it
+func (s *Service) faultHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	switch {
+	case strings.EqualFold(in.Verb, http.MethodDelete):
+		if err := s.faults.set(&FaultProfile{}); err != nil {
+			return nil, err
+		}
+		logger.Printf("Fault profile cleared")
+	case len(in.Data) > 0:
+		var p FaultProfile
+		if err := json.Unmarshal(in.Data, &p); err != nil {
+			return nil, errors.Wrap(err, "error parsing fault profile")
+		}
+		if err := s.faults.set(&p); err != nil {
+			return nil, err
+		}
+		logger.Printf("Fault profile set: %s", in.Data)
+	}
+
+	b, err := json.Marshal(s.faults.get())
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing fault profile")
+	}
+	return &common.Content{ContentType: "application/json", Data: b}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
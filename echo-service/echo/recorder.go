@@ -0,0 +1,198 @@
+package echo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+const redactedValue = "[redacted]"
+
+// redactedMetadata are the credential headers which are never exposed in the recorded requests
+var redactedMetadata = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"dapr-api-token":      true,
+}
+
+// recordedRequest is single recorded invocation
+type recordedRequest struct {
+	Time        string            `json:"time"`
+	Transport   string            `json:"transport"`
+	Method      string            `json:"method"`
+	Verb        string            `json:"verb,omitempty"`
+	QueryString map[string]string `json:"query_string,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	// Metadata is the gRPC metadata or HTTP headers, with lower case keys and redacted credentials
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Body is the invocation data, base64 encoded when it's not UTF-8 text
+	Body         string `json:"body"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+
+	time time.Time
+}
+
+// recorder keeps the most recent invocations in memory
+type recorder struct {
+	mu    sync.Mutex
+	size  int
+	items []*recordedRequest
+}
+
+func newRecorder(size int) *recorder {
+	return &recorder{size: size}
+}
+
+// wrap records each invocation of the method over transport before handling it with fn
+func (r *recorder) wrap(transport, method string, fn invocationHandler) invocationHandler {
+	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		r.record(ctx, transport, method, in)
+		return fn(ctx, in)
+	}
+}
+
+func (r *recorder) record(ctx context.Context, transport, method string, in *common.InvocationEvent) {
+	if r.size < 1 {
+		return
+	}
+	now := time.Now()
+	req := &recordedRequest{
+		Time:        now.UTC().Format(time.RFC3339Nano),
+		Transport:   transport,
+		Method:      method,
+		Verb:        in.Verb,
+		QueryString: in.QueryString,
+		ContentType: in.ContentType,
+		time:        now,
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md) > 0 {
+		req.Metadata = make(map[string]string, len(md))
+		for k, v := range md {
+			if redactedMetadata[strings.ToLower(k)] {
+				req.Metadata[k] = redactedValue
+				continue
+			}
+			req.Metadata[k] = strings.Join(v, ",")
+		}
+	}
+	if utf8.Valid(in.Data) {
+		req.Body = string(in.Data)
+	} else {
+		req.Body, req.BodyEncoding = base64.StdEncoding.EncodeToString(in.Data), "base64"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) >= r.size {
+		r.items = r.items[len(r.items)-r.size+1:]
+	}
+	r.items = append(r.items, req)
+}
+
+// requestFilter selects recorded invocations, empty fields match all
+type requestFilter struct {
+	Transport   string
+	Method      string
+	Verb        string
+	ContentType string
+	Contains    string
+	Since       time.Time
+	Limit       int
+}
+
+// parseRequestFilter parses the filter from query string (transport, method, verb,
+// content_type, contains, since as RFC 3339 time or duration before now, and limit)
+func parseRequestFilter(q map[string]string) (*requestFilter, error) {
+	f := &requestFilter{
+		Transport:   q["transport"],
+		Method:      q["method"],
+		Verb:        q["verb"],
+		ContentType: q["content_type"],
+		Contains:    q["contains"],
+	}
+	if v := q["since"]; v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			f.Since = t
+		} else {
+			return nil, errors.Errorf("invalid since, expected RFC 3339 time or duration: %s", v)
+		}
+	}
+	if v := q["limit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid limit: %s", v)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+func (f *requestFilter) matches(req *recordedRequest) bool {
+	return (f.Transport == "" || strings.EqualFold(f.Transport, req.Transport)) &&
+		(f.Method == "" || strings.EqualFold(f.Method, req.Method)) &&
+		(f.Verb == "" || strings.EqualFold(f.Verb, req.Verb)) &&
+		(f.ContentType == "" || strings.Contains(strings.ToLower(req.ContentType), strings.ToLower(f.ContentType))) &&
+		(f.Contains == "" || (req.BodyEncoding == "" && strings.Contains(req.Body, f.Contains))) &&
+		(f.Since.IsZero() || !req.time.Before(f.Since))
+}
+
+// list returns the recorded invocations matching the filter from the oldest,
+// with limit, only the most recent ones
+func (r *recorder) list(f *requestFilter) []*recordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*recordedRequest, 0)
+	for _, req := range r.items {
+		if f.matches(req) {
+			list = append(list, req)
+		}
+	}
+	if f.Limit > 0 && len(list) > f.Limit {
+		list = list[len(list)-f.Limit:]
+	}
+	return list
+}
+
+// reset clears all of the recorded invocations
+func (r *recorder) reset() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.items)
+	r.items = nil
+	return n
+}
+
+// requestsHandler returns the recorded invocations matching the query string filter
+func (s *Service) requestsHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	f, err := parseRequestFilter(in.QueryString)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(s.requests.list(f))
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing requests")
+	}
+	return &common.Content{ContentType: "application/json", Data: b}, nil
+}
+
+// resetHandler clears the recorded invocations
+func (s *Service) resetHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	n := s.requests.reset()
+	logger.Printf("Cleared %d recorded requests", n)
+	return &common.Content{
+		ContentType: "application/json",
+		Data:        []byte(`{"cleared":` + strconv.Itoa(n) + `}`),
+	}, nil
+}
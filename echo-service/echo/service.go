@@ -0,0 +1,307 @@
+package echo
+
+import (
+	"context"
+	"log"
+	"net"
+	nethttp "net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	pb "github.com/dapr/go-sdk/dapr/proto/runtime/v1"
+	"github.com/dapr/go-sdk/service/common"
+	grpc "github.com/dapr/go-sdk/service/grpc"
+	http "github.com/dapr/go-sdk/service/http"
+	"github.com/pkg/errors"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// ProtocolHTTP serves the handlers over HTTP only
+	ProtocolHTTP = "http"
+	// ProtocolGRPC serves the handlers over gRPC only
+	ProtocolGRPC = "grpc"
+	// ProtocolBoth serves the same handlers over HTTP and gRPC at once
+	ProtocolBoth = "both"
+)
+
+var (
+	logger = log.New(os.Stdout, "", 0)
+)
+
+// invocationHandler is the signature of the service invocation handlers
+type invocationHandler func(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error)
+
+// Config is the echo service configuration
+type Config struct {
+	// Protocol is the transport of the service: http, grpc, or both.
+	Protocol string
+	// HTTPAddress and GRPCAddress are the addresses of the servers of each transport.
+	HTTPAddress string
+	GRPCAddress string
+	// RecordSize is the number of recent invocations kept in memory, 0 disables recording.
+	RecordSize int
+	// Faults is the initial fault profile.
+	Faults *FaultProfile
+}
+
+// ConfigFromEnv returns the configuration defined using environment variables,
+// with protocol and addresses as defaults of PROTOCOL, HTTP_ADDRESS, and GRPC_ADDRESS.
+// ADDRESS, when set, overrides the address of the single protocol.
+func ConfigFromEnv(protocol, httpAddress, grpcAddress string) *Config {
+	c := &Config{
+		Protocol:    strings.ToLower(getEnvVar("PROTOCOL", protocol)),
+		HTTPAddress: getEnvVar("HTTP_ADDRESS", httpAddress),
+		GRPCAddress: getEnvVar("GRPC_ADDRESS", grpcAddress),
+		RecordSize:  getEnvIntOrFail("RECORD_SIZE", "100"),
+		Faults: &FaultProfile{
+			ErrorRate:     getEnvFloatOrFail("FAULT_ERROR_RATE", "0"),
+			ErrorStatus:   getEnvIntOrFail("FAULT_ERROR_STATUS", "500"),
+			LatencyDist:   getEnvVar("FAULT_LATENCY_DIST", ""),
+			LatencyMean:   getEnvVar("FAULT_LATENCY_MEAN", ""),
+			LatencyStddev: getEnvVar("FAULT_LATENCY_STDDEV", ""),
+			LatencyMin:    getEnvVar("FAULT_LATENCY_MIN", ""),
+			LatencyMax:    getEnvVar("FAULT_LATENCY_MAX", ""),
+			TimeoutRate:   getEnvFloatOrFail("FAULT_TIMEOUT_RATE", "0"),
+			Timeout:       getEnvVar("FAULT_TIMEOUT", "30s"),
+		},
+	}
+	if address, ok := os.LookupEnv("ADDRESS"); ok {
+		switch c.Protocol {
+		case ProtocolHTTP:
+			c.HTTPAddress = strings.TrimSpace(address)
+		case ProtocolGRPC:
+			c.GRPCAddress = strings.TrimSpace(address)
+		}
+	}
+	return c
+}
+
+// server is the Dapr service of single transport, the SDK service only registers
+// the handlers, and the server serves them with the handler error statuses
+type server struct {
+	common.Service
+	protocol string
+	listener net.Listener
+	serve    func(lis net.Listener) error
+	stop     func() error
+}
+
+// newHTTPServer creates the HTTP server which responds with the status of the handler errors
+func newHTTPServer(address string) (*server, error) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening at %s", address)
+	}
+	mux := nethttp.NewServeMux()
+	// the echo service has no subscriptions, the SDK registers this handler only when it serves the mux
+	mux.HandleFunc("/dapr/subscribe", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	})
+	hs := &nethttp.Server{Handler: withHTTPStatus(withHeaderMetadata(mux))}
+	return &server{
+		Service:  http.NewServiceWithMux(address, mux),
+		protocol: ProtocolHTTP,
+		listener: lis,
+		serve:    hs.Serve,
+		stop: func() error {
+			err := hs.Close()
+			lis.Close() // in case it was never served
+			return err
+		},
+	}, nil
+}
+
+// withHeaderMetadata passes the HTTP request headers to the handlers as incoming metadata
+// with lower case keys, same as the gRPC metadata, so that both transports are handled the same way
+func withHeaderMetadata(h nethttp.Handler) nethttp.Handler {
+	return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		md := make(metadata.MD, len(r.Header))
+		for k, v := range r.Header {
+			md[strings.ToLower(k)] = v
+		}
+		h.ServeHTTP(w, r.WithContext(metadata.NewIncomingContext(r.Context(), md)))
+	})
+}
+
+// newGRPCServer creates the gRPC server which returns the handler errors with their gRPC status
+func newGRPCServer(address string) (*server, error) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening at %s", address)
+	}
+	svc := grpc.NewServiceWithListener(lis)
+	cb, ok := svc.(pb.AppCallbackServer)
+	if !ok {
+		return nil, errors.Errorf("gRPC service is not app callback server: %T", svc)
+	}
+	gs := ggrpc.NewServer(ggrpc.UnaryInterceptor(grpcStatusInterceptor))
+	pb.RegisterAppCallbackServer(gs, cb)
+	return &server{
+		Service:  svc,
+		protocol: ProtocolGRPC,
+		listener: lis,
+		serve:    gs.Serve,
+		stop: func() error {
+			gs.Stop()
+			lis.Close() // in case it was never served
+			return nil
+		},
+	}, nil
+}
+
+// Start serves the handlers, blocks until the server stops
+func (s *server) Start() error {
+	err := s.serve(s.listener)
+	if err == nethttp.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stop stops the server
+func (s *server) Stop() error {
+	return s.stop()
+}
+
+// address returns the address the server listens at
+func (s *server) address() string {
+	return s.listener.Addr().String()
+}
+
+// Service serves the echo handlers over the configured transports,
+// all of them share the same fault injector and recorded invocations
+type Service struct {
+	faults   *faultInjector
+	requests *recorder
+	servers  []*server
+}
+
+// NewService creates the service and registers its handlers with the server of each transport
+func NewService(c *Config) (*Service, error) {
+	if c == nil {
+		return nil, errors.New("config required")
+	}
+	faults, err := newFaultInjector(c.Faults)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid fault profile")
+	}
+	s := &Service{faults: faults, requests: newRecorder(c.RecordSize)}
+
+	switch c.Protocol {
+	case ProtocolHTTP, ProtocolGRPC, ProtocolBoth:
+	default:
+		return nil, errors.Errorf("invalid protocol (http, grpc, both): %s", c.Protocol)
+	}
+	if c.Protocol == ProtocolHTTP || c.Protocol == ProtocolBoth {
+		hs, err := newHTTPServer(c.HTTPAddress)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating HTTP server")
+		}
+		s.servers = append(s.servers, hs)
+	}
+	if c.Protocol == ProtocolGRPC || c.Protocol == ProtocolBoth {
+		gs, err := newGRPCServer(c.GRPCAddress)
+		if err != nil {
+			s.Stop()
+			return nil, errors.Wrap(err, "error creating gRPC server")
+		}
+		s.servers = append(s.servers, gs)
+	}
+
+	for _, srv := range s.servers {
+		if err := s.register(srv); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// register adds the handlers to the server, recording the echo and fault invocations
+func (s *Service) register(srv *server) error {
+	handlers := map[string]invocationHandler{
+		"echo":      s.requests.wrap(srv.protocol, "echo", s.echoHandler),
+		"fault":     s.requests.wrap(srv.protocol, "fault", s.faultHandler),
+		"_requests": s.requestsHandler,
+		"_reset":    s.resetHandler,
+	}
+	for name, fn := range handlers {
+		if err := srv.AddServiceInvocationHandler(name, withHTTPResponse(fn)); err != nil {
+			return errors.Wrapf(err, "error adding %s handler to %s server", name, srv.protocol)
+		}
+	}
+	return nil
+}
+
+// Start starts the servers of all transports and blocks until one of them stops,
+// the others are then stopped as well
+func (s *Service) Start() error {
+	errs := make(chan error, len(s.servers))
+	for _, srv := range s.servers {
+		go func(srv *server) {
+			logger.Printf("starting %s server at %s...", srv.protocol, srv.address())
+			errs <- errors.Wrapf(srv.Start(), "%s server error", srv.protocol)
+		}(srv)
+	}
+	err := <-errs
+	if stopErr := s.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// Stop stops the servers of all transports
+func (s *Service) Stop() error {
+	var err error
+	for _, srv := range s.servers {
+		if e := srv.Stop(); e != nil && err == nil {
+			err = errors.Wrapf(e, "error stopping %s server", srv.protocol)
+		}
+	}
+	return err
+}
+
+func (s *Service) echoHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	logger.Printf(
+		"Invocation (ContentType:%s, Verb:%s, QueryString:%s, Data:%s)",
+		in.ContentType, in.Verb, in.QueryString, string(in.Data),
+	)
+
+	if err := s.faults.apply(ctx); err != nil {
+		return nil, err
+	}
+
+	o, err := parseOptions(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return echo(ctx, o, in)
+}
+
+func getEnvVar(key, fallbackValue string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(val)
+	}
+	return fallbackValue
+}
+
+func getEnvIntOrFail(key, fallbackValue string) int {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
+
+func getEnvFloatOrFail(key, fallbackValue string) float64 {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
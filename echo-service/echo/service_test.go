@@ -0,0 +1,261 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cpb "github.com/dapr/go-sdk/dapr/proto/common/v1"
+	pb "github.com/dapr/go-sdk/dapr/proto/runtime/v1"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testClient invokes the service started on random ports over both transports
+type testClient struct {
+	s       *Service
+	httpURL string
+	grpc    pb.AppCallbackClient
+}
+
+// invocation is the invocation sent over both transports
+type invocation struct {
+	method      string
+	verb        string
+	query       map[string]string
+	headers     map[string]string
+	contentType string
+	data        string
+}
+
+// response is the response of either transport, with status and code of both
+type response struct {
+	status      int
+	code        codes.Code
+	contentType string
+	data        string
+}
+
+func startTestService(t *testing.T, faults *FaultProfile) *testClient {
+	t.Helper()
+	if faults == nil {
+		faults = &FaultProfile{}
+	}
+	s, err := NewService(&Config{
+		Protocol:    ProtocolBoth,
+		HTTPAddress: "127.0.0.1:0",
+		GRPCAddress: "127.0.0.1:0",
+		RecordSize:  10,
+		Faults:      faults,
+	})
+	if err != nil {
+		t.Fatalf("error creating service: %v", err)
+	}
+	go s.Start()
+	t.Cleanup(func() { s.Stop() })
+
+	c := &testClient{s: s}
+	for _, srv := range s.servers {
+		switch srv.protocol {
+		case ProtocolHTTP:
+			c.httpURL = "http://" + srv.address()
+		case ProtocolGRPC:
+			conn, err := grpc.Dial(srv.address(), grpc.WithInsecure())
+			if err != nil {
+				t.Fatalf("error connecting to gRPC server: %v", err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			c.grpc = pb.NewAppCallbackClient(conn)
+		}
+	}
+	return c
+}
+
+func (c *testClient) invokeHTTP(t *testing.T, in *invocation) *response {
+	t.Helper()
+	q := url.Values{}
+	for k, v := range in.query {
+		q.Set(k, v)
+	}
+	verb := in.verb
+	if verb == "" {
+		verb = http.MethodPost
+	}
+	req, err := http.NewRequest(verb, c.httpURL+"/"+in.method+"?"+q.Encode(), bytes.NewReader([]byte(in.data)))
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", in.contentType)
+	for k, v := range in.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error invoking %s over HTTP: %v", in.method, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+	r := &response{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), data: string(b)}
+	if resp.StatusCode >= http.StatusBadRequest {
+		r.code, r.contentType, r.data = grpcCode(resp.StatusCode), "", ""
+	}
+	return r
+}
+
+func (c *testClient) invokeGRPC(t *testing.T, in *invocation) *response {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if len(in.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(in.headers))
+	}
+	verb := cpb.HTTPExtension_POST
+	if v, ok := cpb.HTTPExtension_Verb_value[in.verb]; ok {
+		verb = cpb.HTTPExtension_Verb(v)
+	}
+	out, err := c.grpc.OnInvoke(ctx, &cpb.InvokeRequest{
+		Method:        in.method,
+		Data:          &any.Any{Value: []byte(in.data)},
+		ContentType:   in.contentType,
+		HttpExtension: &cpb.HTTPExtension{Verb: verb, Querystring: in.query},
+	})
+	if err != nil {
+		return &response{code: status.Code(err)}
+	}
+	return &response{code: codes.OK, contentType: out.ContentType, data: string(out.Data.GetValue())}
+}
+
+func TestRequestedStatusIsReturnedOverBothTransports(t *testing.T) {
+	c := startTestService(t, nil)
+	in := &invocation{method: "echo", query: map[string]string{"status": "503"}, contentType: "text/plain", data: "ping"}
+	if r := c.invokeHTTP(t, in); r.status != http.StatusServiceUnavailable {
+		t.Fatalf("expected HTTP status 503, got: %d", r.status)
+	}
+	if r := c.invokeGRPC(t, in); r.code != codes.Unavailable {
+		t.Fatalf("expected gRPC code Unavailable, got: %s", r.code)
+	}
+}
+
+func TestInjectedFaultsAreReturnedWithStatusOverBothTransports(t *testing.T) {
+	list := []struct {
+		profile *FaultProfile
+		status  int
+		code    codes.Code
+	}{
+		{&FaultProfile{ErrorRate: 100, ErrorStatus: http.StatusTooManyRequests}, http.StatusTooManyRequests, codes.ResourceExhausted},
+		{&FaultProfile{ErrorRate: 100}, http.StatusInternalServerError, codes.Internal},
+		{&FaultProfile{TimeoutRate: 100, Timeout: "10ms"}, http.StatusGatewayTimeout, codes.DeadlineExceeded},
+	}
+	for _, f := range list {
+		c := startTestService(t, f.profile)
+		in := &invocation{method: "echo", contentType: "text/plain", data: "ping"}
+		if r := c.invokeHTTP(t, in); r.status != f.status {
+			t.Errorf("expected HTTP status %d, got: %d", f.status, r.status)
+		}
+		if r := c.invokeGRPC(t, in); r.code != f.code {
+			t.Errorf("expected gRPC code %s, got: %s", f.code, r.code)
+		}
+	}
+}
+
+func TestOptionsAndMetadataAreReadFromHeadersOverBothTransports(t *testing.T) {
+	c := startTestService(t, nil)
+	in := &invocation{
+		method:      "echo",
+		headers:     map[string]string{"echo-mode": "reverse", "x-test": "1"},
+		contentType: "text/plain",
+		data:        "ping",
+	}
+	if r := c.invokeHTTP(t, in); r.data != "gnip" {
+		t.Fatalf("expected reversed data over HTTP, got: %s", r.data)
+	}
+	if r := c.invokeGRPC(t, in); r.data != "gnip" {
+		t.Fatalf("expected reversed data over gRPC, got: %s", r.data)
+	}
+
+	list := c.s.requests.list(&requestFilter{})
+	if len(list) != 2 {
+		t.Fatalf("expected 2 recorded requests, got: %d", len(list))
+	}
+	for _, req := range list {
+		if req.Metadata["echo-mode"] != "reverse" || req.Metadata["x-test"] != "1" {
+			t.Errorf("expected headers in %s request metadata, got: %v", req.Transport, req.Metadata)
+		}
+	}
+}
+
+func TestCredentialHeadersAreRedactedInRecordedRequests(t *testing.T) {
+	c := startTestService(t, nil)
+	secrets := map[string]string{
+		"authorization":       "Bearer secret",
+		"proxy-authorization": "Basic secret",
+		"cookie":              "session=secret",
+		"dapr-api-token":      "secret",
+	}
+	in := &invocation{method: "echo", headers: map[string]string{"x-test": "1"}, contentType: "text/plain", data: "ping"}
+	for k, v := range secrets {
+		in.headers[k] = v
+	}
+	c.invokeHTTP(t, in)
+	c.invokeGRPC(t, in)
+
+	list := c.s.requests.list(&requestFilter{})
+	if len(list) != 2 {
+		t.Fatalf("expected 2 recorded requests, got: %d", len(list))
+	}
+	for _, req := range list {
+		for k := range secrets {
+			if v := req.Metadata[k]; v != redactedValue {
+				t.Errorf("expected %s redacted in %s request metadata, got: %s", k, req.Transport, v)
+			}
+		}
+		if req.Metadata["x-test"] != "1" {
+			t.Errorf("expected other headers in %s request metadata, got: %v", req.Transport, req.Metadata)
+		}
+	}
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("error serializing recorded requests: %v", err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Fatalf("expected no credentials in recorded requests, got: %s", b)
+	}
+}
+
+func TestTransportsReturnSameResults(t *testing.T) {
+	c := startTestService(t, nil)
+	data := `{"message":"ping","count":2}`
+	list := []*invocation{
+		{method: "echo", contentType: "application/json", data: data},
+		{method: "echo", query: map[string]string{"mode": "reverse"}, contentType: "text/plain", data: "héllo"},
+		{method: "echo", query: map[string]string{"mode": "uppercase"}, contentType: "text/plain", data: "ping"},
+		{method: "echo", query: map[string]string{"mode": "pretty"}, contentType: "application/json", data: data},
+		{method: "echo", query: map[string]string{"mode": "convert", "to": "yaml"}, contentType: "application/json", data: data},
+		{method: "echo", query: map[string]string{"mode": "convert", "to": "xml"}, contentType: "application/json", data: `[1,2]`},
+		{method: "echo", query: map[string]string{"mode": "hash", "algo": "md5"}, contentType: "text/plain", data: "ping"},
+		{method: "echo", query: map[string]string{"status": "404"}, contentType: "text/plain", data: "ping"},
+		{method: "echo", query: map[string]string{"status": "504", "delay": "5ms"}, contentType: "text/plain", data: "ping"},
+		{method: "fault", contentType: "application/json", data: `{"error_rate":0,"latency_dist":"fixed","latency_mean":"1ms"}`},
+		{method: "fault", verb: http.MethodGet},
+		{method: "fault", verb: http.MethodDelete},
+	}
+	for _, in := range list {
+		hr, gr := c.invokeHTTP(t, in), c.invokeGRPC(t, in)
+		if hr.code != gr.code || hr.contentType != gr.contentType || hr.data != gr.data {
+			t.Errorf("%s %v: expected same results, got HTTP: %+v, gRPC: %+v", in.method, in.query, hr, gr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package echo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCodes maps the HTTP statuses to gRPC codes, others are unknown
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	499:                            codes.Canceled, // client closed request
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	if c, ok := grpcCodes[httpStatus]; ok {
+		return c
+	}
+	return codes.Unknown
+}
+
+// httpStatusError is the error with HTTP status (e.g. injectedError)
+type httpStatusError interface {
+	HTTPStatus() int
+}
+
+// grpcStatusError is the error with gRPC status (e.g. injectedError)
+type grpcStatusError interface {
+	GRPCStatus() *status.Status
+}
+
+type responseKey struct{}
+
+// httpResponse is passed through the request context from the handlers to the response writer
+type httpResponse struct {
+	// status is the status of the handler error, 0 when there is none
+	status int
+	header http.Header
+}
+
+// statusWriter replaces the internal error status, which the SDK writes for all handler errors,
+// with the status of the handler error
+type statusWriter struct {
+	http.ResponseWriter
+	resp *httpResponse
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && w.resp.status != 0 {
+		code = w.resp.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// withHTTPStatus passes the response through the request context to the response writer
+func withHTTPStatus(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &httpResponse{header: w.Header()}
+		ctx := context.WithValue(r.Context(), responseKey{}, resp)
+		h.ServeHTTP(&statusWriter{ResponseWriter: w, resp: resp}, r.WithContext(ctx))
+	})
+}
+
+// withHTTPResponse sets the status of the handler error, and the content type of its output
+// which the SDK sets only after writing the data, for the HTTP response writer,
+// over gRPC, the context has no response and the handler is used as is
+func withHTTPResponse(fn invocationHandler) invocationHandler {
+	return func(ctx context.Context, in *common.InvocationEvent) (*common.Content, error) {
+		out, err := fn(ctx, in)
+		resp, ok := ctx.Value(responseKey{}).(*httpResponse)
+		if !ok {
+			return out, err
+		}
+		if e, ok := errors.Cause(err).(httpStatusError); ok {
+			resp.status = e.HTTPStatus()
+		}
+		if err == nil && out != nil && out.ContentType != "" {
+			resp.header.Set("Content-Type", out.ContentType)
+		}
+		return out, err
+	}
+}
+
+// grpcStatusInterceptor returns the handler errors with gRPC status using their code,
+// instead of unknown code the SDK wrapped errors would get
+func grpcStatusInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if e, ok := errors.Cause(err).(grpcStatusError); ok {
+		return nil, e.GRPCStatus().Err()
+	}
+	return resp, err
+}
@@ -0,0 +1,11 @@
+module github.com/mchmarny/dapr-demos/echo-service
+
+go 1.15
+
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/golang/protobuf v1.4.2
+	github.com/pkg/errors v0.9.1
+	google.golang.org/grpc v1.32.0
+	gopkg.in/yaml.v2 v2.3.0
+)
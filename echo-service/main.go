@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+
+	"github.com/mchmarny/dapr-demos/echo-service/echo"
+)
+
+func main() {
+	// create the service serving both transports unless set otherwise using PROTOCOL
+	s, err := echo.NewService(echo.ConfigFromEnv(echo.ProtocolBoth, ":8080", ":60002"))
+	if err != nil {
+		log.Fatalf("failed to create the service: %v", err)
+	}
+
+	// start the servers to handle incoming invocations
+	if err := s.Start(); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
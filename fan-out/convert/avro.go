@@ -0,0 +1,136 @@
+package convert
+
+import (
+	"bytes"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AvroSchema is the Avro schema of the source event
+	AvroSchema = `{
+	"type": "record",
+	"name": "RoomReading",
+	"namespace": "fanout.v1",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "temperature", "type": "double"},
+		{"name": "humidity", "type": "double"},
+		{"name": "time", "type": "long"}
+	]
+}`
+
+	// AvroSchemaEmbedded writes Avro object container file with the schema in its header
+	AvroSchemaEmbedded = "embedded"
+	// AvroSchemaReferenced writes Avro single object encoding referencing the schema by its fingerprint
+	AvroSchemaReferenced = "referenced"
+)
+
+var (
+	avroCodec = mustAvroCodec()
+)
+
+func mustAvroCodec() *goavro.Codec {
+	c, err := goavro.NewCodec(AvroSchema)
+	if err != nil {
+		panic(errors.Wrap(err, "invalid Avro schema"))
+	}
+	return c
+}
+
+// NewAvroConverter creates Avro converter with either embedded or referenced schema
+func NewAvroConverter(schema string) (Converter, error) {
+	switch schema {
+	case "", AvroSchemaEmbedded:
+		return &converterFunc{
+			format:      "avro",
+			contentType: "application/avro",
+			fn:          toAvroOCF,
+		}, nil
+	case AvroSchemaReferenced:
+		return &converterFunc{
+			format:      "avro",
+			contentType: "avro/binary",
+			fn: func(e *SourceEvent) ([]byte, error) {
+				return avroCodec.SingleFromNative(nil, toAvroNative(e))
+			},
+		}, nil
+	default:
+		return nil, errors.Errorf("invalid Avro schema mode: %s (supported: %s, %s)",
+			schema, AvroSchemaEmbedded, AvroSchemaReferenced)
+	}
+}
+
+// FromAvro decodes Avro content, in either object container file
+// or single object encoding, into source events
+func FromAvro(b []byte) ([]*SourceEvent, error) {
+	if len(b) > 1 && b[0] == 0xC3 && b[1] == 0x01 {
+		n, _, err := avroCodec.NativeFromSingle(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding Avro single object")
+		}
+		e, err := fromAvroNative(n)
+		if err != nil {
+			return nil, err
+		}
+		return []*SourceEvent{e}, nil
+	}
+
+	r, err := goavro.NewOCFReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading Avro container")
+	}
+	var list []*SourceEvent
+	for r.Scan() {
+		n, err := r.Read()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading Avro record")
+		}
+		e, err := fromAvroNative(n)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, r.Err()
+}
+
+func toAvroOCF(e *SourceEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Codec: avroCodec})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Avro container writer")
+	}
+	if err := w.Append([]interface{}{toAvroNative(e)}); err != nil {
+		return nil, errors.Wrap(err, "error writing Avro record")
+	}
+	return buf.Bytes(), nil
+}
+
+func toAvroNative(e *SourceEvent) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          e.ID,
+		"temperature": e.Temperature,
+		"humidity":    e.Humidity,
+		"time":        e.Time,
+	}
+}
+
+func fromAvroNative(n interface{}) (*SourceEvent, error) {
+	m, ok := n.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid Avro record type: %T", n)
+	}
+	e := &SourceEvent{}
+	e.ID, _ = m["id"].(string)
+	e.Temperature, _ = m["temperature"].(float64)
+	e.Humidity, _ = m["humidity"].(float64)
+	e.Time, _ = m["time"].(int64)
+	return e, nil
+}
+
+func init() {
+	c, _ := NewAvroConverter(AvroSchemaEmbedded)
+	Register(c)
+}
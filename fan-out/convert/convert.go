@@ -0,0 +1,183 @@
+// Package convert provides the source event type and its conversions
+// into the target formats shared by all of the fan-out converters.
+package convert
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SourceEvent represents the input event
+type SourceEvent struct {
+	ID          string  `json:"id"`
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+	Time        int64   `json:"time"`
+}
+
+// Converter converts source events into specific target format
+type Converter interface {
+	// Format returns the name of the target format (e.g. json).
+	Format() string
+	// ContentType returns the MIME type of the converted content.
+	ContentType() string
+	// Convert converts the source event into the target format.
+	Convert(e *SourceEvent) ([]byte, error)
+}
+
+var (
+	mu         sync.RWMutex
+	converters = make(map[string]Converter)
+)
+
+// Register adds the converter to the registry under its format name.
+// Registering converter for already registered format replaces the previous one.
+func Register(c Converter) {
+	mu.Lock()
+	defer mu.Unlock()
+	converters[strings.ToLower(c.Format())] = c
+}
+
+// Get returns the registered converter for the format (case insensitive)
+func Get(format string) (Converter, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := converters[strings.ToLower(strings.TrimSpace(format))]
+	if !ok {
+		return nil, errors.Errorf("invalid target format: %s (supported: %s)",
+			format, strings.Join(formats(), ", "))
+	}
+	return c, nil
+}
+
+// Formats returns sorted names of all registered formats
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return formats()
+}
+
+func formats() []string {
+	list := make([]string, 0, len(converters))
+	for f := range converters {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Parse parses JSON content into source event
+func Parse(data []byte) (*SourceEvent, error) {
+	var e SourceEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, errors.Wrap(err, "error parsing input content")
+	}
+	return &e, nil
+}
+
+// converterFunc is a converter backed by simple functions,
+// records are converted by rfn or, when not set, decoded into source event
+type converterFunc struct {
+	format      string
+	contentType string
+	fn          func(e *SourceEvent) ([]byte, error)
+	rfn         func(r *Record) ([]byte, error)
+}
+
+func (c *converterFunc) Format() string {
+	return c.format
+}
+
+func (c *converterFunc) ContentType() string {
+	return c.contentType
+}
+
+func (c *converterFunc) Convert(e *SourceEvent) ([]byte, error) {
+	if e == nil {
+		return nil, errors.New("nil source event")
+	}
+	return c.fn(e)
+}
+
+func (c *converterFunc) ConvertRecord(r *Record) ([]byte, error) {
+	if r == nil {
+		return nil, errors.New("nil record")
+	}
+	if c.rfn == nil {
+		e, err := r.toEvent()
+		if err != nil {
+			return nil, err
+		}
+		return c.fn(e)
+	}
+	return c.rfn(r)
+}
+
+// Config holds the options of the configurable converters
+type Config struct {
+	// XMLRoot is the name of the XML root element.
+	XMLRoot string
+	// XMLNamespaces is the comma separated list of XML namespaces (see ParseXMLNamespaces).
+	XMLNamespaces string
+	// XMLElementPrefix is the declared namespace prefix of the XML field elements.
+	XMLElementPrefix string
+	// CSVHeader adds header row to CSV content.
+	CSVHeader bool
+	// CSVColumns is the comma separated list of CSV columns (see ParseCSVColumns).
+	CSVColumns string
+	// AvroSchema is either embedded or referenced Avro schema mode.
+	AvroSchema string
+}
+
+// Configure replaces the registered configurable converters with ones using the config
+func Configure(cfg *Config) error {
+	if cfg == nil {
+		return errors.New("nil config")
+	}
+
+	ns, prefixes, err := ParseXMLNamespaces(cfg.XMLNamespaces)
+	if err != nil {
+		return errors.Wrap(err, "invalid XML namespaces")
+	}
+	x, err := NewXMLConverter(XMLOptions{
+		Root:          cfg.XMLRoot,
+		Namespace:     ns,
+		Prefixes:      prefixes,
+		ElementPrefix: cfg.XMLElementPrefix,
+	})
+	if err != nil {
+		return err
+	}
+	Register(x)
+
+	cols, err := ParseCSVColumns(cfg.CSVColumns)
+	if err != nil {
+		return errors.Wrap(err, "invalid CSV columns")
+	}
+	c, err := NewCSVConverter(CSVOptions{Header: cfg.CSVHeader, Columns: cols})
+	if err != nil {
+		return err
+	}
+	Register(c)
+
+	a, err := NewAvroConverter(cfg.AvroSchema)
+	if err != nil {
+		return err
+	}
+	Register(a)
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	list := make([]string, 0, len(m))
+	for k := range m {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,119 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CSVColumn maps single CSV column to source event field
+type CSVColumn struct {
+	// Name is the column name used in the header row.
+	Name string
+	// Field is the source event field in that column.
+	Field string
+}
+
+// CSVOptions configures the CSV converter
+type CSVOptions struct {
+	// Header adds header row with the column names.
+	Header bool
+	// Columns defines the columns and their order, defaults to all fields.
+	Columns []CSVColumn
+}
+
+// NewCSVConverter creates RFC 4180 compliant CSV converter. Column fields refer to
+// the source event fields, or the record fields when the input is mapped.
+func NewCSVConverter(opts CSVOptions) (Converter, error) {
+	for _, c := range opts.Columns {
+		if c.Name == "" || c.Field == "" {
+			return nil, errors.Errorf("invalid CSV column (name: %s, field: %s)", c.Name, c.Field)
+		}
+	}
+	return &converterFunc{
+		format:      "csv",
+		contentType: "text/csv",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return toCSV(columnsOrDefault(opts.Columns, fieldNames), func(name string) (string, error) {
+				return fieldValue(e, name)
+			}, opts.Header)
+		},
+		rfn: func(r *Record) ([]byte, error) {
+			return toCSV(columnsOrDefault(opts.Columns, r.Names()), r.textValue, opts.Header)
+		},
+	}, nil
+}
+
+// columnsOrDefault returns the configured columns or one column for each field
+func columnsOrDefault(cols []CSVColumn, names []string) []CSVColumn {
+	if len(cols) > 0 {
+		return cols
+	}
+	list := make([]CSVColumn, len(names))
+	for i, n := range names {
+		list[i] = CSVColumn{Name: n, Field: n}
+	}
+	return list
+}
+
+// ParseCSVColumns parses comma separated list of columns where each one is
+// either a field name or name:field pair (e.g. "sensor:id,temperature")
+func ParseCSVColumns(s string) ([]CSVColumn, error) {
+	var list []CSVColumn
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		c := CSVColumn{Name: item, Field: item}
+		if i := strings.Index(item, ":"); i >= 0 {
+			c.Name, c.Field = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		if c.Name == "" || c.Field == "" {
+			return nil, errors.Errorf("invalid CSV column: %s", item)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+func toCSV(cols []CSVColumn, value func(name string) (string, error), header bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.UseCRLF = true
+
+	if header {
+		row := make([]string, len(cols))
+		for i, c := range cols {
+			row[i] = c.Name
+		}
+		if err := w.Write(row); err != nil {
+			return nil, errors.Wrap(err, "error writing CSV header")
+		}
+	}
+
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		v, err := value(c.Field)
+		if err != nil {
+			return nil, err
+		}
+		row[i] = v
+	}
+	if err := w.Write(row); err != nil {
+		return nil, errors.Wrap(err, "error writing CSV record")
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, errors.Wrap(err, "error flushing CSV writer")
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	c, _ := NewCSVConverter(CSVOptions{})
+	Register(c)
+}
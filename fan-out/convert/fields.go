@@ -0,0 +1,40 @@
+package convert
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FieldID is the name of the source event ID field
+	FieldID = "id"
+	// FieldTemperature is the name of the source event temperature field
+	FieldTemperature = "temperature"
+	// FieldHumidity is the name of the source event humidity field
+	FieldHumidity = "humidity"
+	// FieldTime is the name of the source event time field
+	FieldTime = "time"
+)
+
+var (
+	// fieldNames is the default order of source event fields
+	fieldNames = []string{FieldID, FieldTemperature, FieldHumidity, FieldTime}
+)
+
+// fieldValue returns text representation of the named source event field
+func fieldValue(e *SourceEvent, name string) (string, error) {
+	switch name {
+	case FieldID:
+		return e.ID, nil
+	case FieldTemperature:
+		return strconv.FormatFloat(e.Temperature, 'f', -1, 64), nil
+	case FieldHumidity:
+		return strconv.FormatFloat(e.Humidity, 'f', -1, 64), nil
+	case FieldTime:
+		// kept as Unix epoch, the mapping can format it differently
+		return strconv.FormatInt(e.Time, 10), nil
+	default:
+		return "", errors.Errorf("invalid field: %s", name)
+	}
+}
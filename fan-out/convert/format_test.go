@@ -0,0 +1,198 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mchmarny/dapr-demos/fan-out/convert/pb"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// decoders decode the converted content back into source event
+var decoders = map[string]func(b []byte) (*SourceEvent, error){
+	"json": func(b []byte) (*SourceEvent, error) {
+		return Parse(b)
+	},
+	"ndjson": func(b []byte) (*SourceEvent, error) {
+		return Parse(bytes.TrimSuffix(b, []byte("\n")))
+	},
+	"msgpack": func(b []byte) (*SourceEvent, error) {
+		var e SourceEvent
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetCustomStructTag("json")
+		return &e, dec.Decode(&e)
+	},
+	"avro": func(b []byte) (*SourceEvent, error) {
+		list, err := FromAvro(b)
+		if err != nil || len(list) != 1 {
+			return nil, err
+		}
+		return list[0], nil
+	},
+	"protobuf": func(b []byte) (*SourceEvent, error) {
+		var r pb.RoomReading
+		if err := proto.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		return FromRoomReading(&r), nil
+	},
+}
+
+// recordDecoders decode the content converted from record back into map
+var recordDecoders = map[string]func(b []byte) (map[string]interface{}, error){
+	"json": func(b []byte) (m map[string]interface{}, err error) {
+		return m, json.Unmarshal(b, &m)
+	},
+	"ndjson": func(b []byte) (m map[string]interface{}, err error) {
+		return m, json.Unmarshal(bytes.TrimSuffix(b, []byte("\n")), &m)
+	},
+	"msgpack": func(b []byte) (m map[string]interface{}, err error) {
+		return m, msgpack.Unmarshal(b, &m)
+	},
+}
+
+func testConverters(t *testing.T) map[string]Converter {
+	t.Helper()
+	list := make(map[string]Converter)
+	for _, f := range []string{"json", "ndjson", "msgpack", "protobuf"} {
+		c, err := Get(f)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		list[f] = c
+	}
+	for _, mode := range []string{AvroSchemaEmbedded, AvroSchemaReferenced} {
+		c, err := NewAvroConverter(mode)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		list["avro-"+mode] = c
+	}
+	return list
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	want := &SourceEvent{ID: "d1-1", Temperature: 21.5, Humidity: 40.25, Time: 1600000000}
+	input, _ := json.Marshal(want)
+
+	for name, c := range testConverters(t) {
+		t.Run(name, func(t *testing.T) {
+			b, err := ConvertData(c, nil, input)
+			if err != nil {
+				t.Fatalf("error converting: %v", err)
+			}
+			got, err := decoders[c.Format()](b)
+			if err != nil {
+				t.Fatalf("error decoding: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestMappedFormatRoundTrip(t *testing.T) {
+	m, err := ParseMapping([]byte(`
+fields:
+- name: id
+  from: device.id
+- name: temperature
+  from: temp
+- name: humidity
+  from: rh
+- name: time
+  from: ts
+  time_unit: ms
+  time_format: RFC3339
+`))
+	if err != nil {
+		t.Fatalf("invalid mapping: %v", err)
+	}
+	input := []byte(`{"device":{"id":"d1"},"temp":21.5,"rh":40,"ts":1600000000123}`)
+	want := &SourceEvent{ID: "d1", Temperature: 21.5, Humidity: 40, Time: 1600000000}
+	// formats of any shape keep the record as mapped
+	wantRecord := map[string]interface{}{"id": "d1", "temperature": 21.5, "humidity": 40.0, "time": "2020-09-13T12:26:40Z"}
+
+	for name, c := range testConverters(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := CheckMapping(c, m); err != nil {
+				t.Fatalf("unexpected mapping error: %v", err)
+			}
+			b, err := ConvertData(c, m, input)
+			if err != nil {
+				t.Fatalf("error converting: %v", err)
+			}
+			if decode, ok := recordDecoders[c.Format()]; ok {
+				got, err := decode(b)
+				if err != nil {
+					t.Fatalf("error decoding: %v", err)
+				}
+				if !reflect.DeepEqual(got, wantRecord) {
+					t.Fatalf("expected %v, got %v", wantRecord, got)
+				}
+				return
+			}
+			got, err := decoders[c.Format()](b)
+			if err != nil {
+				t.Fatalf("error decoding: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestSchemaBoundFormatsRejectMapping(t *testing.T) {
+	cases := []struct {
+		name    string
+		mapping string
+		input   string
+		// time in milliseconds can only be detected in the mapping
+		checkOnly bool
+	}{
+		{
+			name:    "extra field",
+			mapping: "fields: [{name: id}, {name: temperature}, {name: humidity}, {name: time}, {name: dewPoint, compute: dew_point, args: [temperature, humidity]}]",
+			input:   `{"id":"d1","temperature":21.5,"humidity":40,"time":1600000000}`,
+		},
+		{
+			name:    "renamed field",
+			mapping: "fields: [{name: id}, {name: temp, from: temperature}, {name: humidity}, {name: time}]",
+			input:   `{"id":"d1","temperature":21.5,"humidity":40,"time":1600000000}`,
+		},
+		{
+			name:      "time in milliseconds",
+			mapping:   "fields: [{name: id}, {name: temperature}, {name: humidity}, {name: time, time_format: unix_ms}]",
+			input:     `{"id":"d1","temperature":21.5,"humidity":40,"time":1600000000}`,
+			checkOnly: true,
+		},
+		{
+			name:    "passthrough",
+			mapping: "passthrough: true",
+			input:   `{"id":"d1","temperature":21.5,"humidity":40,"time":1600000000,"fw":"1.2"}`,
+		},
+	}
+	for _, tc := range cases {
+		m, err := ParseMapping([]byte(tc.mapping))
+		if err != nil {
+			t.Fatalf("%s: invalid mapping: %v", tc.name, err)
+		}
+		for name, c := range testConverters(t) {
+			schemaBound := c.Format() == "avro" || c.Format() == "protobuf"
+			if err := CheckMapping(c, m); (err != nil) != schemaBound {
+				t.Fatalf("%s (%s): unexpected mapping check result: %v", tc.name, name, err)
+			}
+			if tc.checkOnly {
+				continue
+			}
+			if _, err := ConvertData(c, m, []byte(tc.input)); (err != nil) != schemaBound {
+				t.Fatalf("%s (%s): unexpected conversion result: %v", tc.name, name, err)
+			}
+		}
+	}
+}
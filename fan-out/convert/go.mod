@@ -0,0 +1,13 @@
+module github.com/mchmarny/dapr-demos/fan-out/convert
+
+go 1.15
+
+require (
+	github.com/golang/protobuf v1.4.2
+	github.com/linkedin/goavro/v2 v2.10.0
+	github.com/pkg/errors v0.9.1
+	github.com/vmihailenco/msgpack/v5 v5.0.0
+	github.com/xeipuuv/gojsonschema v1.2.0
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.3.0
+)
@@ -0,0 +1,18 @@
+package convert
+
+import (
+	"encoding/json"
+)
+
+func init() {
+	Register(&converterFunc{
+		format:      "json",
+		contentType: "application/json",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return json.Marshal(e)
+		},
+		rfn: func(r *Record) ([]byte, error) {
+			return r.MarshalJSON()
+		},
+	})
+}
@@ -0,0 +1,297 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	timeUnitSeconds      = "s"
+	timeUnitMilliseconds = "ms"
+
+	timeFormatUnix      = "unix"
+	timeFormatUnixMilli = "unix_ms"
+)
+
+var (
+	// computeFuncs are the functions available to compute new fields
+	computeFuncs = map[string]struct {
+		args int
+		fn   func(args ...float64) (float64, error)
+	}{
+		"celsius_to_fahrenheit": {1, func(a ...float64) (float64, error) { return a[0]*9/5 + 32, nil }},
+		"fahrenheit_to_celsius": {1, func(a ...float64) (float64, error) { return (a[0] - 32) * 5 / 9, nil }},
+		"dew_point":             {2, dewPoint},
+	}
+
+	// timeLayouts are the named output time formats
+	timeLayouts = map[string]string{
+		"RFC3339":     time.RFC3339,
+		"RFC3339Nano": time.RFC3339Nano,
+		"RFC1123":     time.RFC1123,
+		"RFC822":      time.RFC822,
+		"Kitchen":     time.Kitchen,
+	}
+)
+
+// Mapping defines declarative transformation of input events of any shape into records
+type Mapping struct {
+	// Passthrough copies the input fields not consumed by any of the mapped fields.
+	Passthrough bool `yaml:"passthrough"`
+	// Drop lists the input fields never copied to the output.
+	Drop []string `yaml:"drop"`
+	// Fields defines the output fields in their order.
+	Fields []FieldMapping `yaml:"fields"`
+	// Schema is the path of the JSON Schema of the input events, relative to the mapping file,
+	// used to validate them instead of the source event schema.
+	Schema string `yaml:"schema"`
+}
+
+// FieldMapping defines single output field
+type FieldMapping struct {
+	// Name is the name of the output field.
+	Name string `yaml:"name"`
+	// From is the path of the input field (e.g. sensor.temp), defaults to Name.
+	From string `yaml:"from"`
+	// Compute is the name of the function used to compute the value from Args.
+	Compute string `yaml:"compute"`
+	// Args are the paths of the input fields passed to the Compute function.
+	Args []string `yaml:"args"`
+	// Default is the value used when the input field is missing or null.
+	Default interface{} `yaml:"default"`
+	// TimeFormat formats the value as time: unix, unix_ms, RFC3339, or Go layout.
+	TimeFormat string `yaml:"time_format"`
+	// TimeUnit is the unit of the numeric input time: s (default) or ms.
+	TimeUnit string `yaml:"time_unit"`
+	// Round rounds numeric value to the number of decimal places.
+	Round *int `yaml:"round"`
+}
+
+// LoadMapping loads mapping from YAML file
+func LoadMapping(path string) (*Mapping, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading mapping file: %s", path)
+	}
+	m, err := ParseMapping(b)
+	if err != nil {
+		return nil, err
+	}
+	if m.Schema != "" && !filepath.IsAbs(m.Schema) {
+		m.Schema = filepath.Join(filepath.Dir(path), m.Schema)
+	}
+	return m, nil
+}
+
+// ParseMapping parses and validates YAML mapping
+func ParseMapping(b []byte) (*Mapping, error) {
+	var m Mapping
+	if err := yaml.UnmarshalStrict(b, &m); err != nil {
+		return nil, errors.Wrap(err, "error parsing mapping")
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	for i := range m.Fields {
+		m.Fields[i].Default = normalizeYAML(m.Fields[i].Default)
+	}
+	return &m, nil
+}
+
+// normalizeYAML converts the YAML maps (map[interface{}]interface{}) in the value
+// into the JSON ones (map[string]interface{}) so they can be marshaled like the input
+func normalizeYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, mv := range t {
+			m[fmt.Sprint(k)] = normalizeYAML(mv)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, lv := range t {
+			list[i] = normalizeYAML(lv)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+func (m *Mapping) validate() error {
+	if len(m.Fields) == 0 && !m.Passthrough {
+		return errors.New("mapping requires fields or passthrough")
+	}
+	for i, f := range m.Fields {
+		if f.Name == "" {
+			return errors.Errorf("field %d: name required", i)
+		}
+		if f.Compute != "" {
+			c, ok := computeFuncs[f.Compute]
+			if !ok {
+				return errors.Errorf("field %s: invalid compute function: %s", f.Name, f.Compute)
+			}
+			if len(f.Args) != c.args {
+				return errors.Errorf("field %s: %s requires %d args, got %d", f.Name, f.Compute, c.args, len(f.Args))
+			}
+		}
+		switch f.TimeUnit {
+		case "", timeUnitSeconds, timeUnitMilliseconds:
+		default:
+			return errors.Errorf("field %s: invalid time unit: %s", f.Name, f.TimeUnit)
+		}
+		if f.Round != nil && *f.Round < 0 {
+			return errors.Errorf("field %s: invalid round: %d", f.Name, *f.Round)
+		}
+	}
+	return nil
+}
+
+// Apply transforms the input event into record
+func (m *Mapping) Apply(in map[string]interface{}) (*Record, error) {
+	r := &Record{}
+	consumed := make(map[string]bool)
+	for _, f := range m.Fields {
+		v, err := f.value(in, consumed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", f.Name)
+		}
+		r.Set(f.Name, v)
+	}
+
+	if m.Passthrough {
+		for _, d := range m.Drop {
+			consumed[d] = true
+		}
+		keys := make([]string, 0, len(in))
+		for k := range in {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, ok := r.Get(k); ok || consumed[k] {
+				continue
+			}
+			r.Set(k, in[k])
+		}
+	}
+
+	return r, nil
+}
+
+func (f *FieldMapping) value(in map[string]interface{}, consumed map[string]bool) (interface{}, error) {
+	var v interface{}
+	if f.Compute != "" {
+		args := make([]float64, len(f.Args))
+		for i, a := range f.Args {
+			av, ok := Lookup(in, a)
+			if !ok || av == nil {
+				return f.Default, nil
+			}
+			n, ok := av.(float64)
+			if !ok {
+				return nil, errors.Errorf("invalid %s argument type: %T", a, av)
+			}
+			args[i] = n
+		}
+		cv, err := computeFuncs[f.Compute].fn(args...)
+		if err != nil {
+			return nil, errors.Wrap(err, f.Compute)
+		}
+		v = cv
+	} else {
+		from := f.From
+		if from == "" {
+			from = f.Name
+		}
+		consumed[strings.SplitN(from, ".", 2)[0]] = true
+		v, _ = Lookup(in, from)
+	}
+
+	if v == nil {
+		return f.Default, nil
+	}
+	if f.TimeFormat != "" {
+		return f.formatTime(v)
+	}
+	if f.Round != nil {
+		if n, ok := v.(float64); ok {
+			p := math.Pow(10, float64(*f.Round))
+			v = math.Round(n*p) / p
+		}
+	}
+	return v, nil
+}
+
+// formatTime parses numeric (Unix epoch) or RFC3339 input time and formats it
+func (f *FieldMapping) formatTime(v interface{}) (interface{}, error) {
+	var t time.Time
+	switch tv := v.(type) {
+	case float64:
+		if f.TimeUnit == timeUnitMilliseconds {
+			t = time.Unix(0, int64(tv)*int64(time.Millisecond))
+		} else {
+			t = time.Unix(int64(tv), 0)
+		}
+	case string:
+		pt, err := time.Parse(time.RFC3339, tv)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid time: %s", tv)
+		}
+		t = pt
+	default:
+		return nil, errors.Errorf("invalid time type: %T", v)
+	}
+	t = t.UTC()
+
+	switch f.TimeFormat {
+	case timeFormatUnix:
+		return t.Unix(), nil
+	case timeFormatUnixMilli:
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+	if layout, ok := timeLayouts[f.TimeFormat]; ok {
+		return t.Format(layout), nil
+	}
+	return t.Format(f.TimeFormat), nil
+}
+
+// Lookup returns value from nested maps using dot separated path (e.g. sensor.temp)
+func Lookup(in map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = in
+	for _, p := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// dewPoint calculates dew point from temperature (C) and relative humidity (%)
+// using the Magnus formula, which is defined only for positive humidity up to 100%
+// and temperatures above -243.12C
+func dewPoint(a ...float64) (float64, error) {
+	const b, c = 17.62, 243.12
+	t, rh := a[0], a[1]
+	if rh <= 0 || rh > 100 || math.IsNaN(rh) {
+		return 0, errors.Errorf("relative humidity out of range (0-100]: %v", rh)
+	}
+	if t <= -c || math.IsNaN(t) {
+		return 0, errors.Errorf("temperature out of range: %v", t)
+	}
+	g := math.Log(rh/100) + b*t/(c+t)
+	return c * g / (b - g), nil
+}
@@ -0,0 +1,71 @@
+package convert
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDewPoint(t *testing.T) {
+	cases := []struct {
+		t, rh float64
+		want  float64
+		err   bool
+	}{
+		{t: 20, rh: 100, want: 20},
+		{t: 21.5, rh: 40, want: 7.32},
+		{t: 20, rh: 0, err: true},
+		{t: 20, rh: -5, err: true},
+		{t: 20, rh: 101, err: true},
+		{t: -243.12, rh: 50, err: true},
+		{t: math.NaN(), rh: 50, err: true},
+	}
+	for _, c := range cases {
+		v, err := dewPoint(c.t, c.rh)
+		if c.err {
+			if err == nil {
+				t.Fatalf("expected error for t:%v rh:%v, got: %v", c.t, c.rh, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for t:%v rh:%v: %v", c.t, c.rh, err)
+		}
+		if math.Abs(v-c.want) > 0.01 {
+			t.Fatalf("expected %v for t:%v rh:%v, got: %v", c.want, c.t, c.rh, v)
+		}
+	}
+}
+
+func TestMappingComputeError(t *testing.T) {
+	m, err := ParseMapping([]byte("fields: [{name: dewPoint, compute: dew_point, args: [temp, rh]}]"))
+	if err != nil {
+		t.Fatalf("invalid mapping: %v", err)
+	}
+	if _, err := m.Apply(map[string]interface{}{"temp": 20.0, "rh": 0.0}); err == nil {
+		t.Fatal("expected error for zero humidity")
+	}
+}
+
+func TestMappingNormalizesDefaults(t *testing.T) {
+	m, err := ParseMapping([]byte(`
+fields:
+- name: device
+  default:
+    id: unknown
+    tags: [{name: a, 1: b}]
+`))
+	if err != nil {
+		t.Fatalf("invalid mapping: %v", err)
+	}
+	r, err := m.Apply(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := r.MarshalJSON()
+	if err != nil {
+		t.Fatalf("error marshaling default: %v", err)
+	}
+	if want := `{"device":{"id":"unknown","tags":[{"1":"b","name":"a"}]}}`; string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+}
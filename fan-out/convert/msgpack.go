@@ -0,0 +1,47 @@
+package convert
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackEncode encodes value using its JSON tags as msgpack keys
+func msgpackEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackEncodeRecord encodes record as msgpack map preserving the field order
+func msgpackEncodeRecord(r *Record) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.EncodeMapLen(len(r.Fields)); err != nil {
+		return nil, err
+	}
+	for _, f := range r.Fields {
+		if err := enc.EncodeString(f.Name); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(f.Value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	Register(&converterFunc{
+		format:      "msgpack",
+		contentType: "application/msgpack",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return msgpackEncode(e)
+		},
+		rfn: msgpackEncodeRecord,
+	})
+}
@@ -0,0 +1,25 @@
+package convert
+
+import (
+	"encoding/json"
+)
+
+func init() {
+	Register(&converterFunc{
+		format:      "ndjson",
+		contentType: "application/x-ndjson",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return toNDJSON(json.Marshal(e))
+		},
+		rfn: func(r *Record) ([]byte, error) {
+			return toNDJSON(r.MarshalJSON())
+		},
+	})
+}
+
+func toNDJSON(b []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,183 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        v3.13.0
+// source: room_reading.proto
+
+package pb
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// RoomReading represents single temperature and humidity reading in a room
+type RoomReading struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// ID of the reading
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Temperature in the room
+	Temperature float64 `protobuf:"fixed64,2,opt,name=temperature,proto3" json:"temperature,omitempty"`
+	// Relative humidity in the room
+	Humidity float64 `protobuf:"fixed64,3,opt,name=humidity,proto3" json:"humidity,omitempty"`
+	// Time of the reading as Unix epoch seconds
+	Time int64 `protobuf:"varint,4,opt,name=time,proto3" json:"time,omitempty"`
+}
+
+func (x *RoomReading) Reset() {
+	*x = RoomReading{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_room_reading_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RoomReading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomReading) ProtoMessage() {}
+
+func (x *RoomReading) ProtoReflect() protoreflect.Message {
+	mi := &file_room_reading_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomReading.ProtoReflect.Descriptor instead.
+func (*RoomReading) Descriptor() ([]byte, []int) {
+	return file_room_reading_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RoomReading) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RoomReading) GetTemperature() float64 {
+	if x != nil {
+		return x.Temperature
+	}
+	return 0
+}
+
+func (x *RoomReading) GetHumidity() float64 {
+	if x != nil {
+		return x.Humidity
+	}
+	return 0
+}
+
+func (x *RoomReading) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+var File_room_reading_proto protoreflect.FileDescriptor
+
+var file_room_reading_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x72, 0x6f, 0x6f, 0x6d, 0x5f, 0x72, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x66, 0x61, 0x6e, 0x6f, 0x75, 0x74, 0x2e, 0x76, 0x31, 0x22,
+	0x6f, 0x0a, 0x0b, 0x52, 0x6f, 0x6f, 0x6d, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x0e,
+	0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x20,
+	0x0a, 0x0b, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x0b, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x68, 0x75, 0x6d, 0x69, 0x64, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x08, 0x68, 0x75, 0x6d, 0x69, 0x64, 0x69, 0x74, 0x79, 0x12, 0x12, 0x0a, 0x04,
+	0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65,
+	0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d,
+	0x63, 0x68, 0x6d, 0x61, 0x72, 0x6e, 0x79, 0x2f, 0x64, 0x61, 0x70, 0x72, 0x2d, 0x64, 0x65, 0x6d,
+	0x6f, 0x73, 0x2f, 0x66, 0x61, 0x6e, 0x2d, 0x6f, 0x75, 0x74, 0x2f, 0x63, 0x6f, 0x6e, 0x76, 0x65,
+	0x72, 0x74, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_room_reading_proto_rawDescOnce sync.Once
+	file_room_reading_proto_rawDescData = file_room_reading_proto_rawDesc
+)
+
+func file_room_reading_proto_rawDescGZIP() []byte {
+	file_room_reading_proto_rawDescOnce.Do(func() {
+		file_room_reading_proto_rawDescData = protoimpl.X.CompressGZIP(file_room_reading_proto_rawDescData)
+	})
+	return file_room_reading_proto_rawDescData
+}
+
+var file_room_reading_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_room_reading_proto_goTypes = []interface{}{
+	(*RoomReading)(nil), // 0: fanout.v1.RoomReading
+}
+var file_room_reading_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_room_reading_proto_init() }
+func file_room_reading_proto_init() {
+	if File_room_reading_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_room_reading_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RoomReading); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_room_reading_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_room_reading_proto_goTypes,
+		DependencyIndexes: file_room_reading_proto_depIdxs,
+		MessageInfos:      file_room_reading_proto_msgTypes,
+	}.Build()
+	File_room_reading_proto = out.File
+	file_room_reading_proto_rawDesc = nil
+	file_room_reading_proto_goTypes = nil
+	file_room_reading_proto_depIdxs = nil
+}
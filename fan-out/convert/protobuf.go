@@ -0,0 +1,36 @@
+package convert
+
+import (
+	"github.com/mchmarny/dapr-demos/fan-out/convert/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// ToRoomReading converts source event into its protobuf message
+func ToRoomReading(e *SourceEvent) *pb.RoomReading {
+	return &pb.RoomReading{
+		Id:          e.ID,
+		Temperature: e.Temperature,
+		Humidity:    e.Humidity,
+		Time:        e.Time,
+	}
+}
+
+// FromRoomReading converts protobuf message into source event
+func FromRoomReading(r *pb.RoomReading) *SourceEvent {
+	return &SourceEvent{
+		ID:          r.GetId(),
+		Temperature: r.GetTemperature(),
+		Humidity:    r.GetHumidity(),
+		Time:        r.GetTime(),
+	}
+}
+
+func init() {
+	Register(&converterFunc{
+		format:      "protobuf",
+		contentType: "application/x-protobuf",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return proto.Marshal(ToRoomReading(e))
+		},
+	})
+}
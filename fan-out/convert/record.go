@@ -0,0 +1,264 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Field is single named value of a record
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Record is an ordered list of fields, the result of mapping input events of any shape
+type Record struct {
+	Fields []Field
+}
+
+// RecordConverter is implemented by converters which can convert records of any shape
+type RecordConverter interface {
+	// ConvertRecord converts the record into the target format.
+	ConvertRecord(r *Record) ([]byte, error)
+}
+
+// Get returns the value of the named field
+func (r *Record) Get(name string) (interface{}, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value of the named field, or appends it if not already set
+func (r *Record) Set(name string, v interface{}) {
+	for i, f := range r.Fields {
+		if f.Name == name {
+			r.Fields[i].Value = v
+			return
+		}
+	}
+	r.Fields = append(r.Fields, Field{Name: name, Value: v})
+}
+
+// Names returns the names of all record fields in their order
+func (r *Record) Names() []string {
+	list := make([]string, len(r.Fields))
+	for i, f := range r.Fields {
+		list[i] = f.Name
+	}
+	return list
+}
+
+// MarshalJSON marshals record into JSON object preserving the field order
+func (r *Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling field: %s", f.Name)
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toEvent converts the record into source event for the converters bound to its schema
+// (e.g. avro, protobuf), the record must have all of the source event fields and no other
+func (r *Record) toEvent() (*SourceEvent, error) {
+	e := &SourceEvent{}
+	set := make(map[string]bool)
+	for _, f := range r.Fields {
+		var ok bool
+		switch f.Name {
+		case FieldID:
+			e.ID, ok = f.Value.(string)
+		case FieldTemperature:
+			e.Temperature, ok = toFloat(f.Value)
+		case FieldHumidity:
+			e.Humidity, ok = toFloat(f.Value)
+		case FieldTime:
+			e.Time, ok = toEpoch(f.Value)
+		default:
+			return nil, errors.Errorf("field %s is not in the room reading schema", f.Name)
+		}
+		if !ok {
+			return nil, errors.Errorf("invalid %s value for room reading schema: %v (%T)", f.Name, f.Value, f.Value)
+		}
+		set[f.Name] = true
+	}
+	for _, n := range fieldNames {
+		if !set[n] {
+			return nil, errors.Errorf("field %s required by room reading schema", n)
+		}
+	}
+	return e, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// toEpoch returns the Unix epoch in seconds of numeric or RFC 3339 time
+func toEpoch(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return t, true
+	case int:
+		return int64(t), true
+	case float64:
+		return int64(t), t == math.Trunc(t)
+	case string:
+		pt, err := time.Parse(time.RFC3339Nano, t)
+		return pt.Unix(), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// CheckMapping returns error when the converter bound to the source event schema
+// can't represent the records produced by the mapping
+func CheckMapping(c Converter, m *Mapping) error {
+	if m == nil || !schemaBound(c) {
+		return nil
+	}
+	if m.Passthrough {
+		return errors.Errorf("%s format can't represent passthrough fields", c.Format())
+	}
+	set := make(map[string]bool)
+	for _, f := range m.Fields {
+		if !isField(f.Name) {
+			return errors.Errorf("%s format can't represent field %s, only: %s",
+				c.Format(), f.Name, strings.Join(fieldNames, ", "))
+		}
+		if f.Name == FieldTime {
+			switch f.TimeFormat {
+			case "", timeFormatUnix, "RFC3339", "RFC3339Nano":
+			default:
+				return errors.Errorf("%s format requires time in seconds, got time format: %s", c.Format(), f.TimeFormat)
+			}
+		}
+		set[f.Name] = true
+	}
+	for _, n := range fieldNames {
+		if !set[n] {
+			return errors.Errorf("%s format requires field %s", c.Format(), n)
+		}
+	}
+	return nil
+}
+
+// schemaBound returns true when the converter supports only the source event fields
+func schemaBound(c Converter) bool {
+	if cf, ok := c.(*converterFunc); ok {
+		return cf.rfn == nil
+	}
+	_, ok := c.(RecordConverter)
+	return !ok
+}
+
+func isField(name string) bool {
+	for _, n := range fieldNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// textValue returns text representation of the record field value
+func (r *Record) textValue(name string) (string, error) {
+	v, ok := r.Get(name)
+	if !ok {
+		return "", errors.Errorf("invalid field: %s", name)
+	}
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case time.Time:
+		return t.Format(time.RFC3339), nil
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return "", errors.Wrapf(err, "error marshaling field: %s", name)
+		}
+		return string(b), nil
+	}
+}
+
+// ConvertRecord converts record using the converter. Converters bound to the source
+// event schema (e.g. protobuf) get the record converted into source event first.
+func ConvertRecord(c Converter, r *Record) ([]byte, error) {
+	if r == nil {
+		return nil, errors.New("nil record")
+	}
+	if rc, ok := c.(RecordConverter); ok {
+		return rc.ConvertRecord(r)
+	}
+	e, err := r.toEvent()
+	if err != nil {
+		return nil, err
+	}
+	return c.Convert(e)
+}
+
+// ConvertData converts JSON data using the converter. Without mapping, the data is
+// parsed as source event. With mapping, the data can be of any shape and it's
+// first transformed by that mapping into a record.
+func ConvertData(c Converter, m *Mapping, data []byte) ([]byte, error) {
+	if m == nil {
+		e, err := Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return c.Convert(e)
+	}
+
+	var in map[string]interface{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, errors.Wrap(err, "error parsing input content")
+	}
+	r, err := m.Apply(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping input content")
+	}
+	return ConvertRecord(c, r)
+}
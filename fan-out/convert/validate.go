@@ -0,0 +1,176 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// ValidationOff disables validation of the input events
+	ValidationOff = "off"
+	// ValidationLenient counts and reports invalid events but still converts them
+	ValidationLenient = "lenient"
+	// ValidationStrict rejects invalid events
+	ValidationStrict = "strict"
+
+	// reasonInvalidJSON is the reason of input content which is not JSON at all
+	reasonInvalidJSON = "invalid_json"
+	// errorAdditionalProperty is the type of the unknown field violation, allowed in lenient mode
+	errorAdditionalProperty = "additional_property_not_allowed"
+)
+
+// SourceEventSchema is the JSON Schema of the source event, the optional room
+// is the name of the device set by the simulated producer (queue-event-producer)
+const SourceEventSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "SourceEvent",
+  "type": "object",
+  "required": ["id", "temperature", "humidity", "time"],
+  "additionalProperties": false,
+  "properties": {
+    "id": {"type": "string", "minLength": 1},
+    "temperature": {"type": "number", "minimum": -90, "maximum": 150},
+    "humidity": {"type": "number", "minimum": 0, "maximum": 100},
+    "time": {"type": "integer", "exclusiveMinimum": 0},
+    "room": {"type": "string", "minLength": 1}
+  }
+}`
+
+// ValidationError is returned for input content which doesn't match the schema
+type ValidationError struct {
+	// Reasons are the violations in <field>:<type> form (e.g. humidity:number_lte, id:required).
+	Reasons []string
+	// Details are the human readable descriptions of the violations.
+	Details []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid input content: " + strings.Join(e.Details, "; ")
+}
+
+// Validator validates input content against JSON Schema and counts the failures per reason
+type Validator struct {
+	mode   string
+	schema *gojsonschema.Schema
+
+	mu     sync.Mutex
+	valid  int64
+	counts map[string]int64
+}
+
+// LoadValidator creates validator in mode using the schema from file,
+// the source event schema is used when path is empty
+func LoadValidator(path, mode string) (*Validator, error) {
+	if path == "" {
+		return NewValidator([]byte(SourceEventSchema), mode)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading schema file: %s", path)
+	}
+	return NewValidator(b, mode)
+}
+
+// NewValidator creates validator in mode (strict or lenient) using the schema,
+// in lenient mode the fields not defined in the schema are always allowed
+func NewValidator(schema []byte, mode string) (*Validator, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case ValidationStrict, ValidationLenient:
+	default:
+		return nil, errors.Errorf("invalid validation mode (strict, lenient): %s", mode)
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing schema")
+	}
+	return &Validator{mode: mode, schema: s, counts: make(map[string]int64)}, nil
+}
+
+// Strict returns true when the invalid content should be rejected
+func (v *Validator) Strict() bool {
+	return v.mode == ValidationStrict
+}
+
+// Validate validates the content, returns ValidationError when it doesn't match the schema
+func (v *Validator) Validate(data []byte) error {
+	res, err := v.schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		verr := &ValidationError{Reasons: []string{reasonInvalidJSON}, Details: []string{err.Error()}}
+		v.count(verr.Reasons)
+		return verr
+	}
+	if res.Valid() {
+		v.count(nil)
+		return nil
+	}
+
+	verr := &ValidationError{}
+	for _, re := range res.Errors() {
+		if re.Type() == errorAdditionalProperty && !v.Strict() {
+			continue
+		}
+		field := re.Field()
+		if p, ok := re.Details()["property"]; ok {
+			field = fmt.Sprintf("%v", p)
+		}
+		verr.Reasons = append(verr.Reasons, field+":"+re.Type())
+		verr.Details = append(verr.Details, re.String())
+	}
+	if len(verr.Reasons) == 0 {
+		v.count(nil)
+		return nil
+	}
+	v.count(verr.Reasons)
+	return verr
+}
+
+func (v *Validator) count(reasons []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(reasons) == 0 {
+		v.valid++
+		return
+	}
+	for _, r := range reasons {
+		v.counts[r]++
+	}
+}
+
+// Counts returns the number of valid events and the number of failures per reason
+func (v *Validator) Counts() (valid int64, failures map[string]int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	failures = make(map[string]int64, len(v.counts))
+	for r, n := range v.counts {
+		failures[r] = n
+	}
+	return v.valid, failures
+}
+
+// MetricsHandler exports validation counts in Prometheus text format
+func (v *Validator) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	valid, failures := v.Counts()
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP converter_validation_valid_total Number of input events which passed validation.\n")
+	fmt.Fprintf(w, "# TYPE converter_validation_valid_total counter\n")
+	fmt.Fprintf(w, "converter_validation_valid_total %d\n", valid)
+	fmt.Fprintf(w, "# HELP converter_validation_failures_total Number of validation failures per reason.\n")
+	fmt.Fprintf(w, "# TYPE converter_validation_failures_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "converter_validation_failures_total{reason=%q} %d\n", reason, failures[reason])
+	}
+}
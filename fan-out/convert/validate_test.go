@@ -0,0 +1,58 @@
+package convert
+
+import (
+	"testing"
+)
+
+func TestValidateSourceEvent(t *testing.T) {
+	list := []struct {
+		name    string
+		data    string
+		strict  bool
+		lenient bool
+	}{
+		{"valid", `{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`, true, true},
+		{"producer room", `{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000,"room":"kitchen"}`, true, true},
+		{"unknown field", `{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000,"fw":"1.2"}`, false, true},
+		{"out of range", `{"id":"d1-1","temperature":21.5,"humidity":140,"time":1600000000}`, false, false},
+		{"missing field", `{"id":"d1-1","temperature":21.5,"humidity":40}`, false, false},
+		{"not json", `not json`, false, false},
+	}
+	for _, mode := range []string{ValidationStrict, ValidationLenient} {
+		v, err := LoadValidator("", mode)
+		if err != nil {
+			t.Fatalf("error creating %s validator: %v", mode, err)
+		}
+		for _, c := range list {
+			want := c.lenient
+			if v.Strict() {
+				want = c.strict
+			}
+			if err := v.Validate([]byte(c.data)); (err == nil) != want {
+				t.Errorf("%s %s: expected valid %v, got: %v", mode, c.name, want, err)
+			}
+		}
+	}
+}
+
+func TestValidateMappedEventWithMappingSchema(t *testing.T) {
+	m, err := LoadMapping("mapping.yaml")
+	if err != nil {
+		t.Fatalf("error loading mapping: %v", err)
+	}
+	if m.Schema != "mapping-schema.json" {
+		t.Fatalf("expected schema relative to mapping file, got: %s", m.Schema)
+	}
+	v, err := LoadValidator(m.Schema, ValidationStrict)
+	if err != nil {
+		t.Fatalf("error creating validator: %v", err)
+	}
+	if err := v.Validate([]byte(`{"device":{"id":"d1"},"temp":21.5,"rh":40,"ts":1600000000123,"fw":"1.2"}`)); err != nil {
+		t.Fatalf("expected valid mapped event, got: %v", err)
+	}
+	err = v.Validate([]byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Reasons) == 0 {
+		t.Fatalf("expected source event to fail mapping schema, got: %v", err)
+	}
+}
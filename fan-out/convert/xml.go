@@ -0,0 +1,155 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultXMLRoot = "roomReading"
+)
+
+// XMLOptions configures the XML converter
+type XMLOptions struct {
+	// Root is the name of the root element, defaults to roomReading.
+	// It can be qualified by one of the declared prefixes (e.g. dapr:roomReading).
+	Root string
+	// Namespace is the default namespace of the document (xmlns).
+	Namespace string
+	// Prefixes maps namespace prefixes to their URIs (xmlns:prefix).
+	Prefixes map[string]string
+	// ElementPrefix is the declared prefix which qualifies the field elements.
+	ElementPrefix string
+}
+
+// NewXMLConverter creates XML converter which outputs the source event (or record)
+// as a root element with one child element per field
+func NewXMLConverter(opts XMLOptions) (Converter, error) {
+	if opts.Root == "" {
+		opts.Root = defaultXMLRoot
+	}
+	for p, uri := range opts.Prefixes {
+		if !isXMLName(p) || strings.EqualFold(p, "xml") || strings.EqualFold(p, "xmlns") {
+			return nil, errors.Errorf("invalid XML namespace prefix: %s", p)
+		}
+		if uri == "" {
+			return nil, errors.Errorf("XML namespace prefix %s requires URI", p)
+		}
+	}
+	root := opts.Root
+	if i := strings.Index(root, ":"); i >= 0 {
+		if _, ok := opts.Prefixes[root[:i]]; !ok {
+			return nil, errors.Errorf("undeclared XML root element prefix: %s", root[:i])
+		}
+		root = root[i+1:]
+	}
+	if !isXMLName(root) {
+		return nil, errors.Errorf("invalid XML root element: %s", opts.Root)
+	}
+	if _, ok := opts.Prefixes[opts.ElementPrefix]; opts.ElementPrefix != "" && !ok {
+		return nil, errors.Errorf("undeclared XML element prefix: %s", opts.ElementPrefix)
+	}
+	return &converterFunc{
+		format:      "xml",
+		contentType: "application/xml",
+		fn: func(e *SourceEvent) ([]byte, error) {
+			return toXML(fieldNames, func(name string) (string, error) {
+				return fieldValue(e, name)
+			}, &opts)
+		},
+		rfn: func(r *Record) ([]byte, error) {
+			return toXML(r.Names(), r.textValue, &opts)
+		},
+	}, nil
+}
+
+// ParseXMLNamespaces parses comma separated list of namespaces, where the entry
+// without prefix is the default namespace (e.g. "urn:a,b=urn:b")
+func ParseXMLNamespaces(s string) (ns string, prefixes map[string]string, err error) {
+	prefixes = make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.Index(item, "=")
+		if i < 0 {
+			if ns != "" {
+				return "", nil, errors.Errorf("multiple default namespaces: %s, %s", ns, item)
+			}
+			ns = item
+			continue
+		}
+		p, uri := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		if p == "" || uri == "" {
+			return "", nil, errors.Errorf("invalid namespace: %s", item)
+		}
+		prefixes[p] = uri
+	}
+	return ns, prefixes, nil
+}
+
+func toXML(names []string, value func(name string) (string, error), opts *XMLOptions) ([]byte, error) {
+	root := xml.StartElement{Name: xml.Name{Local: opts.Root}}
+	if opts.Namespace != "" {
+		root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: opts.Namespace})
+	}
+	for _, p := range sortedKeys(opts.Prefixes) {
+		root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:" + p}, Value: opts.Prefixes[p]})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := enc.EncodeToken(root); err != nil {
+		return nil, errors.Wrap(err, "error encoding root element")
+	}
+	for _, f := range names {
+		if !isXMLName(f) {
+			return nil, errors.Errorf("field %s is not valid XML element name", f)
+		}
+		v, err := value(f)
+		if err != nil {
+			return nil, err
+		}
+		name := f
+		if opts.ElementPrefix != "" {
+			name = opts.ElementPrefix + ":" + f
+		}
+		if err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return nil, errors.Wrapf(err, "error encoding %s element", f)
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return nil, errors.Wrap(err, "error encoding root element end")
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, errors.Wrap(err, "error flushing XML encoder")
+	}
+	return buf.Bytes(), nil
+}
+
+// isXMLName returns true when the name is valid non-qualified XML name (NCName)
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	c, _ := NewXMLConverter(XMLOptions{})
+	Register(c)
+}
@@ -0,0 +1,67 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXMLConverter(t *testing.T) {
+	e := &SourceEvent{ID: "d1-1", Temperature: 21.5, Humidity: 40, Time: 1600000000}
+	cases := []struct {
+		name string
+		opts XMLOptions
+		want string
+	}{
+		{
+			name: "default",
+			want: `<roomReading><id>d1-1</id><temperature>21.5</temperature><humidity>40</humidity><time>1600000000</time></roomReading>`,
+		},
+		{
+			name: "prefixed",
+			opts: XMLOptions{
+				Root:          "d:reading",
+				Namespace:     "urn:demo",
+				Prefixes:      map[string]string{"d": "urn:dapr"},
+				ElementPrefix: "d",
+			},
+			want: `<d:reading xmlns="urn:demo" xmlns:d="urn:dapr"><d:id>d1-1</d:id><d:temperature>21.5</d:temperature>` +
+				`<d:humidity>40</d:humidity><d:time>1600000000</d:time></d:reading>`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			x, err := NewXMLConverter(c.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := x.Convert(e)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.TrimPrefix(string(b), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"); got != c.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestXMLConverterRejectsInvalidNames(t *testing.T) {
+	invalid := []XMLOptions{
+		{Root: "1reading"},
+		{Root: "d:reading"},
+		{Root: "reading", ElementPrefix: "d"},
+		{Prefixes: map[string]string{"x y": "urn:a"}},
+		{Prefixes: map[string]string{"xmlns": "urn:a"}},
+	}
+	for _, opts := range invalid {
+		if _, err := NewXMLConverter(opts); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+
+	x, _ := NewXMLConverter(XMLOptions{})
+	r := &Record{Fields: []Field{{Name: "id", Value: "d1"}, {Name: "bad name", Value: 1}}}
+	if _, err := ConvertRecord(x, r); err == nil {
+		t.Fatal("expected error for invalid field name")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
+	"github.com/pkg/errors"
+)
+
+var (
+	logger         = log.New(os.Stdout, "", 0)
+	serviceAddress = getEnvVar("ADDRESS", ":60016")
+
+	deadLetterPubSubName = getEnvVar("DEAD_LETTER_PUBSUB_NAME", "fanout-source-pubsub")
+	deadLetterTopicName  = getEnvVar("DEAD_LETTER_TOPIC_NAME", "events-deadletter")
+
+	stateStoreName = getEnvVar("STATE_STORE_NAME", "fanout-replay-store")
+	stateKey       = getEnvVar("STATE_KEY", "deadletters")
+
+	// max number of replays of each dead letter before it's parked
+	maxAttempts = getEnvIntOrFail("REPLAY_MAX_ATTEMPTS", "3")
+
+	replays *replayer
+)
+
+func main() {
+	// same targets and mapping as the converter which dead-lettered the events,
+	// without targets file the events are replayed to the destinations recorded in them
+	cfg := target.HandlerConfigFromEnv()
+	if err := convert.Configure(cfg.Format); err != nil {
+		log.Fatalf("invalid format configuration: %v", err)
+	}
+	var mapping *convert.Mapping
+	if cfg.MappingFile != "" {
+		m, err := convert.LoadMapping(cfg.MappingFile)
+		if err != nil {
+			log.Fatalf("invalid mapping: %v", err)
+		}
+		mapping = m
+	}
+
+	// create Dapr service
+	s, err := daprd.NewService(serviceAddress)
+	if err != nil {
+		log.Fatalf("failed to start the server: %v", err)
+	}
+
+	client, err := dapr.NewClient()
+	if err != nil {
+		log.Fatalf("failed to create Dapr client: %v", err)
+	}
+	defer client.Close()
+
+	sender := target.NewDaprSender(client, cfg.DaprHTTPPort)
+	var d *target.Dispatcher
+	if cfg.TargetsFile != "" {
+		tc, err := target.LoadConfig(cfg.TargetsFile)
+		if err != nil {
+			log.Fatalf("invalid targets: %v", err)
+		}
+		if d, err = target.NewDispatcher(tc, sender, mapping); err != nil {
+			log.Fatalf("error creating dispatcher: %v", err)
+		}
+	} else if d, err = target.NewRedeliverer(sender, mapping); err != nil {
+		log.Fatalf("error creating dispatcher: %v", err)
+	}
+	replays = &replayer{
+		store:       newStore(client, stateStoreName, stateKey),
+		targets:     d,
+		maxAttempts: maxAttempts,
+	}
+
+	// dead letters are only stored, they are replayed when the operator invokes the replay method
+	sub := &common.Subscription{
+		PubsubName: deadLetterPubSubName,
+		Topic:      deadLetterTopicName,
+	}
+	if err := s.AddTopicEventHandler(sub, deadLetterHandler); err != nil {
+		log.Fatalf("error adding topic handler: %v", err)
+	}
+	if err := s.AddServiceInvocationHandler("replay", replayHandler); err != nil {
+		log.Fatalf("error adding replay handler: %v", err)
+	}
+	if err := s.AddServiceInvocationHandler("deadletters", listHandler); err != nil {
+		log.Fatalf("error adding list handler: %v", err)
+	}
+
+	// start the server to handle incoming events
+	if err := s.Start(); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
+
+func deadLetterHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
+	d, ok := e.Data.([]byte)
+	if !ok {
+		return false, errors.Errorf("invalid event data type: %T", e.Data)
+	}
+
+	var dl target.DeadLetter
+	if err := json.Unmarshal(d, &dl); err != nil {
+		return false, errors.Wrap(err, "error parsing dead letter")
+	}
+
+	if err := replays.store.add(ctx, &dl); err != nil {
+		return true, err
+	}
+	logger.Printf("Stored - ID:%s, target:%s, error:%s", dl.ID, dl.Target, dl.Error)
+	return false, nil
+}
+
+// replayHandler replays the stored dead letters selected by the optional request
+func replayHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	req := &replayRequest{}
+	if in != nil && len(in.Data) > 0 {
+		if err := json.Unmarshal(in.Data, req); err != nil {
+			return nil, errors.Wrap(err, "error parsing replay request")
+		}
+	}
+	res, err := replays.replay(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error replaying dead letters")
+	}
+	return jsonContent(res)
+}
+
+// listHandler returns all of the stored dead letters
+func listHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
+	list, err := replays.list(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing dead letters")
+	}
+	return jsonContent(list)
+}
+
+func jsonContent(v interface{}) (*common.Content, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing response")
+	}
+	return &common.Content{Data: b, ContentType: "application/json"}, nil
+}
+
+func getEnvVar(key, fallbackValue string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(val)
+	}
+	return fallbackValue
+}
+
+func getEnvIntOrFail(key, fallbackValue string) int {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
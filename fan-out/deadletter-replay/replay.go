@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mchmarny/dapr-demos/fan-out/target"
+	"github.com/pkg/errors"
+)
+
+// deliverer delivers the dead-lettered event to its failed target
+type deliverer interface {
+	Redeliver(ctx context.Context, dl *target.DeadLetter) (*target.Result, error)
+}
+
+// replayRequest selects the dead letters to replay, all of them when empty
+type replayRequest struct {
+	// Target replays only the dead letters of this target.
+	Target string `json:"target"`
+	// IDs replays only the dead letters of these events.
+	IDs []string `json:"ids"`
+	// Limit is the max number of dead letters replayed, 0 for no limit.
+	Limit int `json:"limit"`
+}
+
+func (r *replayRequest) matches(dl *target.DeadLetter) bool {
+	if r.Target != "" && dl.Target != r.Target {
+		return false
+	}
+	if len(r.IDs) == 0 {
+		return true
+	}
+	for _, id := range r.IDs {
+		if id == dl.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// replayResult counts the outcomes of single replay
+type replayResult struct {
+	// Replayed were delivered and removed from the store.
+	Replayed int `json:"replayed"`
+	// Failed failed again and stay in the store for the next replay.
+	Failed int `json:"failed"`
+	// Parked failed the max number of attempts and won't be replayed again.
+	Parked int `json:"parked"`
+	// Skipped didn't match the request or were already parked.
+	Skipped int `json:"skipped"`
+}
+
+// replayer delivers the stored dead letters to their failed targets,
+// one replay at a time so that the same dead letter is never delivered twice concurrently
+type replayer struct {
+	mu          sync.Mutex
+	store       *store
+	targets     deliverer
+	maxAttempts int
+}
+
+// replay delivers each stored dead letter matching the request only to the target
+// recorded in it. Each attempt is saved before the delivery so that it's counted even
+// when the replayer crashes, and the dead letters which exceed the max attempts are parked.
+func (r *replayer) replay(ctx context.Context, req *replayRequest) (*replayResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, err := r.store.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &replayResult{}
+	for _, key := range keys {
+		if req.Limit > 0 && res.Replayed+res.Failed+res.Parked >= req.Limit {
+			break
+		}
+		if err := r.replayEntry(ctx, key, req, res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// replayEntry replays single stored dead letter and counts its outcome in res. The entry
+// is locked from its read until its last save or removal, so that the same event
+// dead-lettered again meanwhile isn't overwritten, it's added after the replay instead.
+func (r *replayer) replayEntry(ctx context.Context, key string, req *replayRequest, res *replayResult) error {
+	defer r.store.lock(key)()
+
+	e, err := r.store.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if e == nil || e.Parked || !req.matches(e.DeadLetter) {
+		res.Skipped++
+		return nil
+	}
+
+	e.Replays++
+	if err := r.store.save(ctx, key, e); err != nil {
+		return err
+	}
+
+	dl := e.DeadLetter
+	if err := r.deliver(ctx, dl); err != nil {
+		e.LastError = err.Error()
+		if e.Replays >= r.maxAttempts {
+			e.Parked = true
+			res.Parked++
+			logger.Printf("Parked - ID:%s, target:%s, replays:%d, error:%v", dl.ID, dl.Target, e.Replays, err)
+		} else {
+			res.Failed++
+			logger.Printf("Failed - ID:%s, target:%s, replays:%d, error:%v", dl.ID, dl.Target, e.Replays, err)
+		}
+		return r.store.save(ctx, key, e)
+	}
+
+	if err := r.store.remove(ctx, key); err != nil {
+		return err
+	}
+	res.Replayed++
+	logger.Printf("Replayed - ID:%s, target:%s, replays:%d", dl.ID, dl.Target, e.Replays)
+	return nil
+}
+
+// list returns all of the stored dead letters, including the parked ones
+func (r *replayer) list(ctx context.Context) ([]*entry, error) {
+	keys, err := r.store.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*entry, 0, len(keys))
+	for _, key := range keys {
+		e, err := r.store.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+// deliver sends the dead-lettered event to its failed target
+func (r *replayer) deliver(ctx context.Context, dl *target.DeadLetter) error {
+	if dl.Target == "" {
+		return errors.New("dead letter has no target (e.g. event could not be converted)")
+	}
+	res, err := r.targets.Redeliver(ctx, dl)
+	if err != nil {
+		return err
+	}
+	if res.Skipped {
+		return errors.New("event does not match target filter")
+	}
+	return res.Err
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
+	"github.com/pkg/errors"
+)
+
+// memState is in-memory state store
+type memState struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (m *memState) GetState(ctx context.Context, store, key string) (*dapr.StateItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &dapr.StateItem{Key: key, Value: m.items[key]}, nil
+}
+
+func (m *memState) SaveState(ctx context.Context, store, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = data
+	return nil
+}
+
+func (m *memState) DeleteState(ctx context.Context, store, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+// recordingDeliverer counts the deliveries to each target and fails the ones in fail
+type recordingDeliverer struct {
+	sent map[string]int
+	fail map[string]bool
+}
+
+func (d *recordingDeliverer) Redeliver(ctx context.Context, dl *target.DeadLetter) (*target.Result, error) {
+	d.sent[dl.Target]++
+	r := &target.Result{Target: dl.Target, Attempts: 1}
+	if d.fail[dl.Target] {
+		r.Err = errors.New("target down")
+	}
+	return r, nil
+}
+
+func testReplayer(state *memState, d *recordingDeliverer) *replayer {
+	return &replayer{store: newStore(state, "test", "index"), targets: d, maxAttempts: 2}
+}
+
+func TestReplayDeliversOnlyToFailedTarget(t *testing.T) {
+	ctx := context.Background()
+	state := &memState{items: map[string][]byte{}}
+	d := &recordingDeliverer{sent: map[string]int{}, fail: map[string]bool{}}
+	r := testReplayer(state, d)
+
+	for _, dl := range []*target.DeadLetter{
+		{ID: "1", Target: "a", Data: []byte(`{}`)},
+		{ID: "1", Target: "b", Data: []byte(`{}`)},
+		{ID: "2", Target: "b", Data: []byte(`{}`)},
+	} {
+		if err := r.store.add(ctx, dl); err != nil {
+			t.Fatalf("error adding dead letter: %v", err)
+		}
+	}
+
+	res, err := r.replay(ctx, &replayRequest{Target: "b"})
+	if err != nil {
+		t.Fatalf("error replaying: %v", err)
+	}
+	if res.Replayed != 2 || res.Skipped != 1 {
+		t.Fatalf("expected 2 replayed and 1 skipped, got: %+v", res)
+	}
+	if d.sent["a"] != 0 || d.sent["b"] != 2 {
+		t.Fatalf("expected only target b deliveries, got: %v", d.sent)
+	}
+
+	list, err := r.list(ctx)
+	if err != nil {
+		t.Fatalf("error listing: %v", err)
+	}
+	if len(list) != 1 || list[0].DeadLetter.Target != "a" {
+		t.Fatalf("expected only dead letter of target a left, got: %d", len(list))
+	}
+}
+
+func TestReplayParksAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	state := &memState{items: map[string][]byte{}}
+	d := &recordingDeliverer{sent: map[string]int{}, fail: map[string]bool{"a": true}}
+	r := testReplayer(state, d)
+
+	if err := r.store.add(ctx, &target.DeadLetter{ID: "1", Target: "a", Data: []byte(`{}`)}); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+
+	res, err := r.replay(ctx, &replayRequest{})
+	if err != nil || res.Failed != 1 {
+		t.Fatalf("expected failed replay, got: %+v, %v", res, err)
+	}
+
+	// attempts are kept in the state store so the new replayer continues counting
+	r = testReplayer(state, d)
+	if res, err = r.replay(ctx, &replayRequest{}); err != nil || res.Parked != 1 {
+		t.Fatalf("expected parked replay, got: %+v, %v", res, err)
+	}
+	if res, err = r.replay(ctx, &replayRequest{}); err != nil || res.Skipped != 1 {
+		t.Fatalf("expected parked dead letter to be skipped, got: %+v, %v", res, err)
+	}
+	if d.sent["a"] != 2 {
+		t.Fatalf("expected 2 deliveries, got: %d", d.sent["a"])
+	}
+
+	// dead-lettering the event again doesn't reset the parked state
+	if err := r.store.add(ctx, &target.DeadLetter{ID: "1", Target: "a", Data: []byte(`{}`)}); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+	list, err := r.list(ctx)
+	if err != nil || len(list) != 1 || !list[0].Parked || list[0].Replays != 2 {
+		t.Fatalf("expected single parked dead letter, got: %+v, %v", list, err)
+	}
+}
+
+func TestReplayParksDeadLetterWithoutTarget(t *testing.T) {
+	ctx := context.Background()
+	state := &memState{items: map[string][]byte{}}
+	d := &recordingDeliverer{sent: map[string]int{}, fail: map[string]bool{}}
+	r := &replayer{store: newStore(state, "test", "index"), targets: d, maxAttempts: 1}
+
+	if err := r.store.add(ctx, &target.DeadLetter{ID: "1", Data: []byte(`not json`)}); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+	res, err := r.replay(ctx, &replayRequest{})
+	if err != nil || res.Parked != 1 {
+		t.Fatalf("expected parked dead letter, got: %+v, %v", res, err)
+	}
+	if len(d.sent) != 0 {
+		t.Fatalf("expected no deliveries, got: %v", d.sent)
+	}
+}
+
+func TestEntryKeyIsUnambiguous(t *testing.T) {
+	a := entryKey(&target.DeadLetter{ID: "a/b", Target: "c"})
+	b := entryKey(&target.DeadLetter{ID: "a", Target: "b/c"})
+	if a == b {
+		t.Fatalf("expected different keys, got: %s", a)
+	}
+}
+
+// publishAPI records the dead letters published using the Dapr HTTP API
+type publishAPI struct {
+	mu          sync.Mutex
+	deadLetters []*target.DeadLetter
+}
+
+func (a *publishAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var dl target.DeadLetter
+	if err := json.NewDecoder(r.Body).Decode(&dl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.deadLetters = append(a.deadLetters, &dl)
+}
+
+// topicSender records the topics the events are sent to
+type topicSender struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (s *topicSender) Send(ctx context.Context, t *target.Target, id string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topics = append(s.topics, t.Kind+":"+t.PubSub+"/"+t.Topic+":"+contentType)
+	return nil
+}
+
+func TestReplayDeadLetterOfSingleTarget(t *testing.T) {
+	ctx := context.Background()
+	api := &publishAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// converter without targets file fails to deliver to its single target
+	cfg := &target.HandlerConfig{
+		DaprHTTPPort:     u.Port(),
+		Format:           &convert.Config{AvroSchema: convert.AvroSchemaEmbedded},
+		MaxAttempts:      1,
+		DeadLetterPubSub: "p",
+		DeadLetterTopic:  "deadletter",
+		ValidationMode:   convert.ValidationOff,
+	}
+	single := &target.SingleTarget{
+		Name:        "p/out",
+		Format:      "csv",
+		Destination: &target.Destination{Kind: target.KindTopic, PubSub: "p", Topic: "out"},
+		Send: func(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
+			return errors.New("target down")
+		},
+	}
+	h, err := target.NewHandler(cfg, nil, single)
+	if err != nil {
+		t.Fatalf("error creating handler: %v", err)
+	}
+	e := &common.TopicEvent{ID: "d1-1", PubsubName: "p", Topic: "events",
+		Data: []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)}
+	if retry, _ := h.Handle(ctx, e); retry {
+		t.Fatal("expected event to be dead-lettered instead of retried")
+	}
+	if len(api.deadLetters) != 1 {
+		t.Fatalf("expected single dead letter, got: %d", len(api.deadLetters))
+	}
+
+	// replayer without targets file replays it to the recorded destination
+	sender := &topicSender{}
+	d, err := target.NewRedeliverer(sender, nil)
+	if err != nil {
+		t.Fatalf("error creating redeliverer: %v", err)
+	}
+	r := &replayer{store: newStore(&memState{items: map[string][]byte{}}, "test", "index"), targets: d, maxAttempts: 1}
+	if err := r.store.add(ctx, api.deadLetters[0]); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+	res, err := r.replay(ctx, &replayRequest{})
+	if err != nil || res.Replayed != 1 {
+		t.Fatalf("expected replayed dead letter, got: %+v, %v", res, err)
+	}
+	if len(sender.topics) != 1 || sender.topics[0] != "topic:p/out:text/csv" {
+		t.Fatalf("expected delivery to single target in its format, got: %v", sender.topics)
+	}
+}
+
+// blockingDeliverer fails each delivery once release is closed
+type blockingDeliverer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDeliverer) Redeliver(ctx context.Context, dl *target.DeadLetter) (*target.Result, error) {
+	d.started <- struct{}{}
+	<-d.release
+	return &target.Result{Target: dl.Target, Attempts: 1, Err: errors.New("target down")}, nil
+}
+
+func TestDeadLetterAddedDuringReplayIsNotOverwritten(t *testing.T) {
+	ctx := context.Background()
+	d := &blockingDeliverer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	r := &replayer{store: newStore(&memState{items: map[string][]byte{}}, "test", "index"), targets: d, maxAttempts: 3}
+	if err := r.store.add(ctx, &target.DeadLetter{ID: "1", Target: "a", Error: "first", Data: []byte(`{}`)}); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+
+	replayDone := make(chan error, 1)
+	go func() {
+		_, err := r.replay(ctx, &replayRequest{})
+		replayDone <- err
+	}()
+	<-d.started
+
+	// the same event dead-lettered again while its replay is in flight
+	addDone := make(chan error, 1)
+	go func() {
+		addDone <- r.store.add(ctx, &target.DeadLetter{ID: "1", Target: "a", Error: "second", Data: []byte(`{}`)})
+	}()
+	select {
+	case <-addDone:
+		t.Fatal("expected add to wait for the replay of the same entry")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(d.release)
+	if err := <-replayDone; err != nil {
+		t.Fatalf("error replaying: %v", err)
+	}
+	if err := <-addDone; err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+
+	list, err := r.list(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected single dead letter, got: %+v, %v", list, err)
+	}
+	if e := list[0]; e.DeadLetter.Error != "second" || e.Replays != 1 || e.LastError != "target down" {
+		t.Fatalf("expected new dead letter with the replay attempt, got: %+v (%+v)", e, e.DeadLetter)
+	}
+	if len(r.store.locks) != 0 {
+		t.Fatalf("expected entry locks to be released, got: %d", len(r.store.locks))
+	}
+}
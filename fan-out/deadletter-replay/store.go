@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
+	"github.com/pkg/errors"
+)
+
+// stateClient is the part of the Dapr client used by the store
+type stateClient interface {
+	GetState(ctx context.Context, store, key string) (*dapr.StateItem, error)
+	SaveState(ctx context.Context, store, key string, data []byte) error
+	DeleteState(ctx context.Context, store, key string) error
+}
+
+// entry is the dead letter kept in the state store until it's replayed
+type entry struct {
+	DeadLetter *target.DeadLetter `json:"dead_letter"`
+	// Replays is the number of replay attempts.
+	Replays int `json:"replays"`
+	// Parked is set once the dead letter exceeded the max replay attempts, it's never replayed again.
+	Parked bool `json:"parked"`
+	// LastError is the error of the last replay attempt.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// store keeps the dead letters in state store, one key per event and target,
+// along with the index of all of the keys under single key
+type store struct {
+	mu       sync.Mutex
+	client   stateClient
+	name     string
+	indexKey string
+
+	locksMu sync.Mutex
+	locks   map[string]*keyLock
+}
+
+// keyLock serializes the read-modify-writes of single entry
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newStore(client stateClient, name, indexKey string) *store {
+	return &store{client: client, name: name, indexKey: indexKey, locks: map[string]*keyLock{}}
+}
+
+// lock locks the entry until the returned unlock is called, so that its read-modify-write
+// (e.g. replay) is never interleaved with another one (e.g. the same event dead-lettered again)
+func (s *store) lock(key string) (unlock func()) {
+	s.locksMu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.locksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.locksMu.Lock()
+		defer s.locksMu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// entryKey identifies the dead letter of the event to the target, both escaped
+// so that the separator is unambiguous
+func entryKey(dl *target.DeadLetter) string {
+	return url.QueryEscape(dl.ID) + "/" + url.QueryEscape(dl.Target)
+}
+
+// add saves the dead letter, the replay attempts of already stored one are kept
+// so that the event dead-lettered again keeps counting towards the max attempts
+func (s *store) add(ctx context.Context, dl *target.DeadLetter) error {
+	key := entryKey(dl)
+	defer s.lock(key)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		e = &entry{}
+	}
+	e.DeadLetter = dl
+	if err := s.save(ctx, key, e); err != nil {
+		return err
+	}
+
+	keys, err := s.index(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k == key {
+			return nil
+		}
+	}
+	return s.saveIndex(ctx, append(keys, key))
+}
+
+// remove deletes the dead letter and its key from the index,
+// the caller holds the lock of the entry
+func (s *store) remove(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.index(ctx)
+	if err != nil {
+		return err
+	}
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k != key {
+			list = append(list, k)
+		}
+	}
+	if err := s.saveIndex(ctx, list); err != nil {
+		return err
+	}
+	if err := s.client.DeleteState(ctx, s.name, key); err != nil {
+		return errors.Wrapf(err, "error deleting dead letter: %s", key)
+	}
+	return nil
+}
+
+// keys returns the keys of all of the stored dead letters in the order they were added
+func (s *store) keys(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index(ctx)
+}
+
+// get returns the stored dead letter, nil when not found,
+// the caller holds the lock of the entry when it saves it back
+func (s *store) get(ctx context.Context, key string) (*entry, error) {
+	item, err := s.client.GetState(ctx, s.name, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting dead letter: %s", key)
+	}
+	if item == nil || len(item.Value) == 0 {
+		return nil, nil
+	}
+	var e entry
+	if err := json.Unmarshal(item.Value, &e); err != nil {
+		return nil, errors.Wrapf(err, "error parsing dead letter: %s", key)
+	}
+	return &e, nil
+}
+
+func (s *store) save(ctx context.Context, key string, e *entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "error serializing dead letter: %s", key)
+	}
+	if err := s.client.SaveState(ctx, s.name, key, b); err != nil {
+		return errors.Wrapf(err, "error saving dead letter: %s", key)
+	}
+	return nil
+}
+
+func (s *store) index(ctx context.Context) ([]string, error) {
+	item, err := s.client.GetState(ctx, s.name, s.indexKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting dead letter index")
+	}
+	if item == nil || len(item.Value) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	if err := json.Unmarshal(item.Value, &keys); err != nil {
+		return nil, errors.Wrap(err, "error parsing dead letter index")
+	}
+	return keys, nil
+}
+
+func (s *store) saveIndex(ctx context.Context, keys []string) error {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return errors.Wrap(err, "error serializing dead letter index")
+	}
+	if err := s.client.SaveState(ctx, s.name, s.indexKey, b); err != nil {
+		return errors.Wrap(err, "error saving dead letter index")
+	}
+	return nil
+}
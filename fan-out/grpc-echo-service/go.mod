@@ -2,4 +2,6 @@ module github.com/mchmarny/dapr-demos/grpc-echo-service
 
 go 1.15
 
-require github.com/dapr/go-sdk v0.11.0
+require github.com/mchmarny/dapr-demos/echo-service v0.0.0
+
+replace github.com/mchmarny/dapr-demos/echo-service => ../../echo-service
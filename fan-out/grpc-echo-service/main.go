@@ -1,55 +1,20 @@
 package main
 
 import (
-	"context"
 	"log"
-	"os"
-	"strings"
 
-	"github.com/dapr/go-sdk/service/common"
-	daprd "github.com/dapr/go-sdk/service/grpc"
-)
-
-var (
-	logger         = log.New(os.Stdout, "", 0)
-	serviceAddress = getEnvVar("ADDRESS", ":60015")
+	"github.com/mchmarny/dapr-demos/echo-service/echo"
 )
 
 func main() {
-	// create serving server
-	s, err := daprd.NewService(serviceAddress)
+	// create the service, served over gRPC unless set otherwise using PROTOCOL
+	s, err := echo.NewService(echo.ConfigFromEnv(echo.ProtocolGRPC, ":8080", ":60015"))
 	if err != nil {
-		log.Fatalf("failed to start the server: %v", err)
+		log.Fatalf("failed to create the service: %v", err)
 	}
 
-	// add handler to the service
-	s.AddServiceInvocationHandler("echo", echoHandler)
-
-	// start the server to handle incoming events
-	log.Printf("starting server at %s...", serviceAddress)
+	// start the server to handle incoming invocations
 	if err := s.Start(); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
-
-func echoHandler(ctx context.Context, in *common.InvocationEvent) (out *common.Content, err error) {
-	logger.Printf(
-		"Invocation (ContentType:%s, Verb:%s, QueryString:%s, Data:%s)",
-		in.ContentType, in.Verb, in.QueryString, string(in.Data),
-	)
-
-	// TODO: implement handling logic here
-	out = &common.Content{
-		ContentType: in.ContentType,
-		Data:        in.Data,
-	}
-
-	return
-}
-
-func getEnvVar(key, fallbackValue string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return strings.TrimSpace(val)
-	}
-	return fallbackValue
-}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"encoding/xml"
-	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -13,6 +10,7 @@ import (
 	dapr "github.com/dapr/go-sdk/client"
 	"github.com/dapr/go-sdk/service/common"
 	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
 	"github.com/pkg/errors"
 )
 
@@ -27,6 +25,8 @@ var (
 
 	targetBindingName = getEnvVar("TARGET_BINDING", "fanout-http-target-post-binding")
 	targetFormat      = getEnvVar("TARGET_FORMAT", "json")
+
+	handler *target.Handler
 )
 
 func main() {
@@ -43,6 +43,20 @@ func main() {
 	client = c
 	defer client.Close()
 
+	single := &target.SingleTarget{
+		Name:   targetBindingName,
+		Format: targetFormat,
+		Destination: &target.Destination{
+			Kind:      target.KindBinding,
+			Binding:   targetBindingName,
+			Operation: "create",
+		},
+		Send: invokeBinding,
+	}
+	if handler, err = target.NewHandler(target.HandlerConfigFromEnv(), client, single); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
 	// add handler to the service
 	sub := &common.Subscription{PubsubName: sourcePubSubName, Topic: sourceTopicName}
 	s.AddTopicEventHandler(sub, eventHandler)
@@ -53,62 +67,27 @@ func main() {
 	}
 }
 
-// SourceEvent represents the input event
-type SourceEvent struct {
-	ID          string  `json:"id"`
-	Temperature float64 `json:"temperature"`
-	Humidity    float64 `json:"humidity"`
-	Time        int64   `json:"time"`
-}
-
 func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
 	logger.Printf("Event - PubsubName:%s, Topic:%s, ID:%s", e.PubsubName, e.Topic, e.ID)
+	return handler.Handle(ctx, e)
+}
 
-	d, ok := e.Data.([]byte)
-	if !ok {
-		return false, errors.Errorf("invalid event data type: %T", e.Data)
-	}
-
-	var se SourceEvent
-	if err := json.Unmarshal(d, &se); err != nil {
-		return false, errors.Errorf("error parsing input content: %v", err)
-	}
-
-	var (
-		me error
-		b  []byte
-	)
-
-	switch strings.ToLower(targetFormat) {
-	case "json":
-		b = d
-	case "xml":
-		if b, me = xml.Marshal(&e); me != nil {
-			return false, errors.Errorf("error while converting content: %v", me)
-		}
-	case "csv":
-		b = []byte(fmt.Sprintf(`"%s",%f,%f,"%s"`,
-			se.ID, se.Temperature, se.Humidity, time.Unix(se.Time, 0).Format(time.RFC3339)))
-	default:
-		return false, errors.Errorf("invalid target format: %s", targetFormat)
-	}
-	logger.Printf("Target (%s): %s", targetFormat, b)
-
+// invokeBinding sends the converted content to the target binding
+func invokeBinding(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
 	content := &dapr.BindingInvocation{
-		Data: b,
+		Data: data,
 		Metadata: map[string]string{
 			"record-id":       e.ID,
 			"conversion-time": time.Now().UTC().Format(time.RFC3339),
+			"Content-Type":    contentType,
 		},
 		Name:      targetBindingName,
 		Operation: "create",
 	}
-
 	if err := client.InvokeOutputBinding(ctx, content); err != nil {
-		return true, errors.Wrap(err, "error invoking target binding")
+		return errors.Wrap(err, "error invoking target binding")
 	}
-
-	return false, nil
+	return nil
 }
 
 func getEnvVar(key, fallbackValue string) string {
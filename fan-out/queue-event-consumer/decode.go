@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatCSV  = "csv"
+)
+
+var (
+	// columns of CSV content without header row, same as the converters default
+	defaultCSVColumns = []string{"id", "temperature", "humidity", "time"}
+)
+
+// reading is the decoded content as field name to value
+type reading map[string]string
+
+// format returns the format of the content based on its content type,
+// or on its first character when the content type is not set or not known
+func format(contentType string, data []byte) string {
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(ct, "json"):
+		return formatJSON
+	case strings.Contains(ct, "xml"):
+		return formatXML
+	case strings.Contains(ct, "csv"):
+		return formatCSV
+	}
+	switch t := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(t, []byte("{")):
+		return formatJSON
+	case bytes.HasPrefix(t, []byte("<")):
+		return formatXML
+	default:
+		return formatCSV
+	}
+}
+
+// decode decodes the content in format into reading
+func decode(f string, data []byte) (reading, error) {
+	switch f {
+	case formatJSON:
+		return decodeJSON(data)
+	case formatXML:
+		return decodeXML(data)
+	case formatCSV:
+		return decodeCSV(data)
+	default:
+		return nil, errors.Errorf("invalid format: %s", f)
+	}
+}
+
+func decodeJSON(data []byte) (reading, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "error decoding JSON")
+	}
+	r := make(reading, len(m))
+	for k, v := range m {
+		switch tv := v.(type) {
+		case string:
+			r[k] = tv
+		case float64:
+			r[k] = strconv.FormatFloat(tv, 'f', -1, 64)
+		case nil:
+		default:
+			b, _ := json.Marshal(tv)
+			r[k] = string(b)
+		}
+	}
+	return r, nil
+}
+
+// decodeXML reads the child elements of the root element by their local names
+func decodeXML(data []byte) (reading, error) {
+	r := make(reading)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding XML")
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				var v string
+				if err := d.DecodeElement(&v, &tt); err != nil {
+					return nil, errors.Wrapf(err, "error decoding XML element: %s", tt.Name.Local)
+				}
+				r[tt.Name.Local] = strings.TrimSpace(v)
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if len(r) == 0 {
+		return nil, errors.New("error decoding XML: no fields")
+	}
+	return r, nil
+}
+
+// decodeCSV reads single record, with header row when its first column is id
+func decodeCSV(data []byte) (reading, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding CSV")
+	}
+	cols := defaultCSVColumns
+	if len(rows) > 1 && len(rows[0]) > 0 && strings.EqualFold(rows[0][0], "id") {
+		cols, rows = rows[0], rows[1:]
+	}
+	if len(rows) != 1 {
+		return nil, errors.Errorf("error decoding CSV: expected 1 record, got %d", len(rows))
+	}
+	if len(rows[0]) != len(cols) {
+		return nil, errors.Errorf("error decoding CSV: expected %d columns, got %d", len(cols), len(rows[0]))
+	}
+	r := make(reading, len(cols))
+	for i, c := range cols {
+		r[strings.ToLower(c)] = rows[0][i]
+	}
+	return r, nil
+}
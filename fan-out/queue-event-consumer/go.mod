@@ -2,4 +2,7 @@ module github.com/mchmarny/dapr-demos/fan-out/queue-format-consumer
 
 go 1.15
 
-require github.com/dapr/go-sdk v0.11.0
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/pkg/errors v0.9.1
+)
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/dapr/go-sdk/service/common"
 	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -15,6 +18,15 @@ var (
 	serviceAddress   = getEnvVar("ADDRESS", ":60030")
 	sourcePubSubName = getEnvVar("SOURCE_PUBSUB_NAME", "fanout-source-pubsub")
 	sourceTopicName  = getEnvVar("SOURCE_TOPIC_NAME", "test-topic")
+	reportAddress    = getEnvVar("REPORT_ADDRESS", ":8080")
+
+	expected = &contract{
+		MinTemperature: getEnvFloatOrFail("MIN_TEMPERATURE", "-90"),
+		MaxTemperature: getEnvFloatOrFail("MAX_TEMPERATURE", "150"),
+		MinHumidity:    getEnvFloatOrFail("MIN_HUMIDITY", "0"),
+		MaxHumidity:    getEnvFloatOrFail("MAX_HUMIDITY", "100"),
+	}
+	verified = newVerifier(expected)
 )
 
 func main() {
@@ -31,6 +43,11 @@ func main() {
 	}
 	s.AddTopicEventHandler(sub, eventHandler)
 
+	// serve the verification report
+	if reportAddress != "" {
+		go serveReport(reportAddress)
+	}
+
 	// start the server to handle incoming events
 	if err := s.Start(); err != nil {
 		log.Fatalf("server error: %v", err)
@@ -39,12 +56,40 @@ func main() {
 
 func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
 	logger.Printf("Event - PubsubName:%s, Topic:%s, ID:%s", e.PubsubName, e.Topic, e.ID)
+
+	d, ok := e.Data.([]byte)
+	if !ok {
+		return false, errors.Errorf("invalid event data type: %T", e.Data)
+	}
+
+	// the consumer only verifies, so the invalid events are reported but never retried
+	id, reasons := verified.verify(e.DataContentType, d)
+	if len(reasons) > 0 {
+		logger.Printf("Invalid - ID:%s, reading:%s, reasons:%s", e.ID, id, strings.Join(reasons, ", "))
+	}
 	return false, nil
 }
 
+func serveReport(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", verified.reportHandler)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logger.Printf("report server error: %v", err)
+	}
+}
+
 func getEnvVar(key, fallbackValue string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return strings.TrimSpace(val)
 	}
 	return fallbackValue
 }
+
+func getEnvFloatOrFail(key, fallbackValue string) float64 {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
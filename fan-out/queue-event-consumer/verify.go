@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// max number of missing IDs listed for each device in the report
+	maxMissingIDs = 100
+	// number of sequence numbers below the last one of each device in which the gaps are tracked,
+	// the older gaps are given up on, and the readings arriving below are counted as late
+	sequenceWindow = 10000
+	// max number of IDs without sequence remembered to detect their duplicates
+	maxRecentIDs = 10000
+	// max number of devices tracked, the least recently updated one is dropped
+	maxDevices = 1000
+)
+
+// contract defines the expected fields and their valid ranges
+type contract struct {
+	MinTemperature float64
+	MaxTemperature float64
+	MinHumidity    float64
+	MaxHumidity    float64
+}
+
+// check validates the reading fields, returns the reasons of all violations
+func (c *contract) check(r reading) []string {
+	var reasons []string
+	if r["id"] == "" {
+		reasons = append(reasons, "id:required")
+	}
+	reasons = append(reasons, checkNumber(r, "temperature", c.MinTemperature, c.MaxTemperature)...)
+	reasons = append(reasons, checkNumber(r, "humidity", c.MinHumidity, c.MaxHumidity)...)
+	if v, ok := r["time"]; !ok || v == "" {
+		reasons = append(reasons, "time:required")
+	} else if t, ok := parseTime(v); !ok {
+		reasons = append(reasons, "time:invalid")
+	} else if t.Unix() <= 0 {
+		reasons = append(reasons, "time:range")
+	}
+	return reasons
+}
+
+func checkNumber(r reading, field string, min, max float64) []string {
+	v, ok := r[field]
+	if !ok || v == "" {
+		return []string{field + ":required"}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return []string{field + ":invalid"}
+	}
+	if n < min || n > max {
+		return []string{field + ":range"}
+	}
+	return nil
+}
+
+// parseTime parses Unix epoch seconds or RFC 3339 time
+func parseTime(v string) (time.Time, bool) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// sequence tracks the arrival of the readings of single device using the high-water mark
+// of its sequence and the gaps below it, so it's bounded no matter how many readings arrive
+type sequence struct {
+	first, last int64
+	received    int64
+	outOfOrder  int64
+	late        int64
+	// gaps are the missing sequence numbers within window below last in ascending order
+	gaps []int64
+	// givenUp is the number of gaps which fell out of window
+	givenUp int64
+	// updated orders the devices by their last update
+	updated int64
+}
+
+// recentIDs remembers the last IDs in order of their arrival
+type recentIDs struct {
+	ids   map[string]bool
+	order []string
+}
+
+// add returns false when the ID was already seen, the oldest one is forgotten when full
+func (r *recentIDs) add(id string) bool {
+	if r.ids[id] {
+		return false
+	}
+	if len(r.order) >= maxRecentIDs {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.ids[id] = true
+	r.order = append(r.order, id)
+	return true
+}
+
+// verifier checks the received readings against the contract and tracks their arrival
+type verifier struct {
+	contract *contract
+
+	mu           sync.Mutex
+	received     int64
+	valid        int64
+	invalid      int64
+	undecodable  int64
+	duplicates   int64
+	formats      map[string]int64
+	reasons      map[string]int64
+	ids          *recentIDs
+	devices      map[string]*sequence
+	updates      int64
+	lastReceived time.Time
+}
+
+func newVerifier(c *contract) *verifier {
+	return &verifier{
+		contract: c,
+		formats:  make(map[string]int64),
+		reasons:  make(map[string]int64),
+		ids:      &recentIDs{ids: make(map[string]bool)},
+		devices:  make(map[string]*sequence),
+	}
+}
+
+// verify decodes the content and checks it against the contract,
+// returns the reasons of all violations
+func (v *verifier) verify(contentType string, data []byte) (id string, reasons []string) {
+	f := format(contentType, data)
+	r, err := decode(f, data)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.received++
+	v.formats[f]++
+	v.lastReceived = time.Now()
+
+	if err != nil {
+		v.undecodable++
+		v.reasons[f+":undecodable"]++
+		return "", []string{err.Error()}
+	}
+
+	id = r["id"]
+	if reasons = v.contract.check(r); len(reasons) > 0 {
+		v.invalid++
+		for _, reason := range reasons {
+			v.reasons[reason]++
+		}
+	} else {
+		v.valid++
+	}
+
+	if id == "" {
+		return id, reasons
+	}
+	if !v.track(id) {
+		v.duplicates++
+		return id, append(reasons, "id:duplicate")
+	}
+	return id, reasons
+}
+
+// track tracks the sequence of IDs in <device>-<number> form (e.g. kitchen-9f86d081-42),
+// or just the ID itself when it has no sequence, returns false for duplicate
+func (v *verifier) track(id string) bool {
+	i := strings.LastIndex(id, "-")
+	if i < 1 {
+		return v.ids.add(id)
+	}
+	n, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || n < 1 {
+		return v.ids.add(id)
+	}
+	name := id[:i]
+	v.updates++
+	s, ok := v.devices[name]
+	if !ok {
+		if len(v.devices) >= maxDevices {
+			v.dropOldestDevice()
+		}
+		s = &sequence{first: n, last: n, received: 1, updated: v.updates}
+		v.devices[name] = s
+		return true
+	}
+	s.updated = v.updates
+	return s.add(n)
+}
+
+func (v *verifier) dropOldestDevice() {
+	var oldest string
+	for name, s := range v.devices {
+		if oldest == "" || s.updated < v.devices[oldest].updated {
+			oldest = name
+		}
+	}
+	delete(v.devices, oldest)
+}
+
+// add records the arrival of the sequence number, returns false for duplicate
+func (s *sequence) add(n int64) bool {
+	switch {
+	case n > s.last:
+		// the numbers skipped since the last one are the new gaps
+		from := s.last + 1
+		if n-from > sequenceWindow {
+			s.givenUp += n - from - sequenceWindow
+			from = n - sequenceWindow
+		}
+		for i := from; i < n; i++ {
+			s.gaps = append(s.gaps, i)
+		}
+		s.last = n
+		s.trim()
+	case n < s.last-sequenceWindow:
+		// too old to tell if it's duplicate or given up gap
+		s.late++
+		s.outOfOrder++
+	case n < s.first:
+		// arrived before the first one, the numbers in between are the new gaps
+		gaps := make([]int64, 0, s.first-n-1+int64(len(s.gaps)))
+		for i := n + 1; i < s.first; i++ {
+			gaps = append(gaps, i)
+		}
+		s.gaps = append(gaps, s.gaps...)
+		s.first = n
+		s.outOfOrder++
+	default:
+		i := sort.Search(len(s.gaps), func(i int) bool { return s.gaps[i] >= n })
+		if i == len(s.gaps) || s.gaps[i] != n {
+			return false
+		}
+		s.gaps = append(s.gaps[:i], s.gaps[i+1:]...)
+		s.outOfOrder++
+	}
+	s.received++
+	return true
+}
+
+// trim gives up on the gaps which fell out of window
+func (s *sequence) trim() {
+	i := sort.Search(len(s.gaps), func(i int) bool { return s.gaps[i] >= s.last-sequenceWindow })
+	if i > 0 {
+		s.givenUp += int64(i)
+		s.gaps = append([]int64(nil), s.gaps[i:]...)
+	}
+}
+
+// report is the summary of all of the received readings
+type report struct {
+	Received     int64                    `json:"received"`
+	Valid        int64                    `json:"valid"`
+	Invalid      int64                    `json:"invalid"`
+	Undecodable  int64                    `json:"undecodable"`
+	Duplicates   int64                    `json:"duplicates"`
+	OutOfOrder   int64                    `json:"out_of_order"`
+	Missing      int64                    `json:"missing"`
+	Formats      map[string]int64         `json:"formats"`
+	Reasons      map[string]int64         `json:"reasons"`
+	Devices      map[string]*deviceReport `json:"devices"`
+	LastReceived string                   `json:"last_received,omitempty"`
+}
+
+// deviceReport is the arrival summary of single device,
+// missing are the gaps between the first and the last received reading
+type deviceReport struct {
+	First      int64    `json:"first"`
+	Last       int64    `json:"last"`
+	Received   int64    `json:"received"`
+	OutOfOrder int64    `json:"out_of_order"`
+	Late       int64    `json:"late,omitempty"`
+	Missing    int64    `json:"missing"`
+	MissingIDs []string `json:"missing_ids,omitempty"`
+}
+
+// report copies the counts under lock and builds the report outside of it
+// so that the verification of the arriving readings is not blocked
+func (v *verifier) report() *report {
+	v.mu.Lock()
+	rep := &report{
+		Received:    v.received,
+		Valid:       v.valid,
+		Invalid:     v.invalid,
+		Undecodable: v.undecodable,
+		Duplicates:  v.duplicates,
+		Formats:     copyCounts(v.formats),
+		Reasons:     copyCounts(v.reasons),
+		Devices:     make(map[string]*deviceReport, len(v.devices)),
+	}
+	if !v.lastReceived.IsZero() {
+		rep.LastReceived = v.lastReceived.UTC().Format(time.RFC3339)
+	}
+	gaps := make(map[string][]int64, len(v.devices))
+	for n, s := range v.devices {
+		rep.Devices[n] = &deviceReport{
+			First:      s.first,
+			Last:       s.last,
+			Received:   s.received,
+			OutOfOrder: s.outOfOrder,
+			Late:       s.late,
+			Missing:    int64(len(s.gaps)) + s.givenUp,
+		}
+		list := s.gaps
+		if len(list) > maxMissingIDs {
+			list = list[:maxMissingIDs]
+		}
+		gaps[n] = append([]int64(nil), list...)
+	}
+	v.mu.Unlock()
+
+	for n, d := range rep.Devices {
+		for _, i := range gaps[n] {
+			d.MissingIDs = append(d.MissingIDs, n+"-"+strconv.FormatInt(i, 10))
+		}
+		rep.OutOfOrder += d.OutOfOrder
+		rep.Missing += d.Missing
+	}
+	return rep
+}
+
+func copyCounts(m map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// reportHandler returns the report as JSON
+func (v *verifier) reportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v.report()); err != nil {
+		logger.Printf("error encoding report: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testVerifier() *verifier {
+	return newVerifier(&contract{MinTemperature: -90, MaxTemperature: 150, MinHumidity: 0, MaxHumidity: 100})
+}
+
+func verifyID(v *verifier, id string) []string {
+	data := fmt.Sprintf(`{"id":%q,"temperature":21.5,"humidity":40,"time":1600000000}`, id)
+	_, reasons := v.verify("application/json", []byte(data))
+	return reasons
+}
+
+func TestVerifierTracksGapsAndOutOfOrderReadings(t *testing.T) {
+	v := testVerifier()
+	for _, n := range []int{3, 4, 7, 5, 2, 5} {
+		verifyID(v, fmt.Sprintf("kitchen-9f86d081-%d", n))
+	}
+
+	rep := v.report()
+	d := rep.Devices["kitchen-9f86d081"]
+	if d == nil {
+		t.Fatalf("expected device report, got: %+v", rep.Devices)
+	}
+	if d.First != 2 || d.Last != 7 || d.Received != 5 || d.OutOfOrder != 2 || d.Missing != 1 {
+		t.Fatalf("unexpected device report: %+v", d)
+	}
+	if len(d.MissingIDs) != 1 || d.MissingIDs[0] != "kitchen-9f86d081-6" {
+		t.Fatalf("expected missing 6, got: %v", d.MissingIDs)
+	}
+	if rep.Duplicates != 1 || rep.Received != 6 || rep.Valid != 6 {
+		t.Fatalf("expected single duplicate, got: %+v", rep)
+	}
+}
+
+func TestVerifierGivesUpOnGapsOutOfWindow(t *testing.T) {
+	v := testVerifier()
+	verifyID(v, "bedroom-1")
+	verifyID(v, "bedroom-3")
+	verifyID(v, fmt.Sprintf("bedroom-%d", sequenceWindow+10))
+
+	d := v.report().Devices["bedroom"]
+	if d.Missing != sequenceWindow+7 {
+		t.Fatalf("expected all gaps counted as missing, got: %d", d.Missing)
+	}
+	if s := v.devices["bedroom"]; len(s.gaps) > sequenceWindow {
+		t.Fatalf("expected gaps bounded by window, got: %d", len(s.gaps))
+	}
+	if len(d.MissingIDs) != maxMissingIDs {
+		t.Fatalf("expected %d missing IDs listed, got: %d", maxMissingIDs, len(d.MissingIDs))
+	}
+
+	// given up gap arriving late is neither duplicate nor filling the gap
+	if reasons := verifyID(v, "bedroom-2"); len(reasons) != 0 {
+		t.Fatalf("expected late reading to be valid, got: %v", reasons)
+	}
+	if d := v.report().Devices["bedroom"]; d.Late != 1 || d.Missing != sequenceWindow+7 {
+		t.Fatalf("expected late reading, got: %+v", d)
+	}
+}
+
+func TestVerifierBoundsIDsAndDevices(t *testing.T) {
+	v := testVerifier()
+	if reasons := verifyID(v, "no-sequence"); len(reasons) != 0 {
+		t.Fatalf("unexpected reasons: %v", reasons)
+	}
+	if reasons := verifyID(v, "no-sequence"); len(reasons) != 1 || reasons[0] != "id:duplicate" {
+		t.Fatalf("expected duplicate, got: %v", reasons)
+	}
+	for i := 0; i < maxRecentIDs; i++ {
+		v.ids.add(fmt.Sprintf("id%d", i))
+	}
+	if len(v.ids.ids) != maxRecentIDs || len(v.ids.order) != maxRecentIDs || v.ids.ids["no-sequence"] {
+		t.Fatalf("expected oldest ID forgotten, got: %d", len(v.ids.ids))
+	}
+
+	for i := 0; i <= maxDevices; i++ {
+		verifyID(v, fmt.Sprintf("device%d-1", i))
+	}
+	if len(v.devices) != maxDevices || v.devices["device0"] != nil {
+		t.Fatalf("expected least recently updated device dropped, got: %d", len(v.devices))
+	}
+}
+
+func TestVerifierReportIsCopy(t *testing.T) {
+	v := testVerifier()
+	verifyID(v, "kitchen-1")
+	verifyID(v, "kitchen-3")
+	rep := v.report()
+	verifyID(v, "kitchen-2")
+	if d := rep.Devices["kitchen"]; d.Missing != 1 || len(d.MissingIDs) != 1 || rep.Received != 2 {
+		t.Fatalf("expected report unchanged by later readings, got: %+v", d)
+	}
+}
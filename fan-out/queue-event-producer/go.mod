@@ -4,6 +4,5 @@ go 1.15
 
 require (
 	github.com/dapr/go-sdk v0.11.0
-	github.com/google/uuid v1.1.2
 	github.com/pkg/errors v0.9.1
 )
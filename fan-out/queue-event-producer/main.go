@@ -4,15 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"math/rand"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	dapr "github.com/dapr/go-sdk/client"
 	daprd "github.com/dapr/go-sdk/service/grpc"
-	"github.com/google/uuid"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -24,6 +23,29 @@ var (
 	targetTopicName  = getEnvVar("TARGET_TOPIC_NAME", "events")
 
 	threadFreq = getEnvVar("THREAD_PUB_FREQ", "3s")
+
+	outboxSize      = int(getEnvIntOrFail("OUTBOX_SIZE", "1000"))
+	publishAttempts = int(getEnvIntOrFail("PUBLISH_ATTEMPTS", "3"))
+	publishBackoff  = getEnvDurationOrFail("PUBLISH_BACKOFF", "200ms")
+	publishTimeout  = getEnvDurationOrFail("PUBLISH_TIMEOUT", "5s")
+	healthAddress   = getEnvVar("HEALTH_ADDRESS", ":8080")
+
+	simConfig = &simulatorConfig{
+		Devices:         getEnvVar("SIM_DEVICES", "kitchen,living-room,bedroom"),
+		Instance:        getEnvVar("SIM_INSTANCE", ""),
+		Seed:            getEnvIntOrFail("SIM_SEED", "0"),
+		TemperatureBase: getEnvFloatOrFail("SIM_TEMPERATURE_BASE", "70"),
+		HumidityBase:    getEnvFloatOrFail("SIM_HUMIDITY_BASE", "45"),
+		DayLength:       getEnvDurationOrFail("SIM_DAY_LENGTH", "24h"),
+		DailyAmplitude:  getEnvFloatOrFail("SIM_DAILY_AMPLITUDE", "5"),
+		WalkStep:        getEnvFloatOrFail("SIM_WALK_STEP", "0.3"),
+		Noise:           getEnvFloatOrFail("SIM_NOISE", "0.2"),
+		AnomalyRate:     getEnvFloatOrFail("SIM_ANOMALY_RATE", "0"),
+		AnomalySize:     getEnvFloatOrFail("SIM_ANOMALY_SIZE", "25"),
+		DropoutRate:     getEnvFloatOrFail("SIM_DROPOUT_RATE", "0"),
+		ReorderRate:     getEnvFloatOrFail("SIM_REORDER_RATE", "0"),
+		DuplicateRate:   getEnvFloatOrFail("SIM_DUPLICATE_RATE", "0"),
+	}
 )
 
 func main() {
@@ -35,6 +57,12 @@ func main() {
 	}
 	logger.Printf("thread frequency: %s", tf)
 
+	sim, err := newSimulator(simConfig)
+	if err != nil {
+		logger.Fatalf("invalid simulator configuration: %v", err)
+	}
+	logger.Printf("simulator instance: %s", sim.instance)
+
 	// create Dapr service
 	s, err := daprd.NewService(serviceAddress)
 	if err != nil {
@@ -49,16 +77,28 @@ func main() {
 	}
 	defer c.Close()
 
+	publish := func(ctx context.Context, data []byte) error {
+		ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+		return c.PublishEvent(ctx, targetPubSubName, targetTopicName, data)
+	}
+	out, err := newOutbox(publish, outboxSize, publishAttempts, publishBackoff)
+	if err != nil {
+		logger.Fatalf("invalid outbox configuration: %v", err)
+	}
+
+	// health
+	if healthAddress != "" {
+		go serveHealth(healthAddress, out)
+	}
+
 	// timer
 	timer := time.NewTicker(tf)
 	defer timer.Stop()
 
-	// produce
-	go func() {
-		if err := produce(ctx, c, timer); err != nil {
-			logger.Fatalf("error: %v", err)
-		}
-	}()
+	// produce and publish, publish errors put the producer into degraded mode until the outbox is flushed again
+	go out.run(ctx)
+	go produce(ctx, sim, out, timer)
 
 	// start the server to handle incoming events
 	if err := s.Start(); err != nil {
@@ -66,43 +106,73 @@ func main() {
 	}
 }
 
-func produce(ctx context.Context, c dapr.Client, t *time.Ticker) error {
+// produce adds the simulated readings into outbox on each tick,
+// the outbox publishes them in its own goroutine
+func produce(ctx context.Context, sim *simulator, out *outbox, t *time.Ticker) {
 	for {
 		select {
-		case <-t.C:
-			b, err := json.Marshal(getRoomReading())
-			if err != nil {
-				return errors.Wrap(err, "error serializing reading")
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, r := range sim.next(now) {
+				b, err := json.Marshal(r)
+				if err != nil {
+					logger.Printf("error serializing reading: %v", err)
+					continue
+				}
+				out.add(b)
 			}
-			if err := c.PublishEvent(ctx, targetPubSubName, targetTopicName, b); err != nil {
-				return errors.Wrap(err, "error publishing content")
-			}
-			logger.Printf("published: %s", b)
 		}
 	}
 }
 
+func serveHealth(address string, out *outbox) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", out.healthHandler)
+	mux.HandleFunc("/ready", out.readyHandler)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logger.Printf("health server error: %v", err)
+	}
+}
+
 type roomReading struct {
 	ID          string  `json:"id"`
+	Room        string  `json:"room"`
 	Temperature float64 `json:"temperature"`
 	Humidity    float64 `json:"humidity"`
 	Time        int64   `json:"time"`
 }
 
-func getRoomReading() interface{} {
-	min := 0.01
-	max := 100.00
-	return &roomReading{
-		ID:          uuid.New().String(),
-		Temperature: min + rand.Float64()*(max-min),
-		Humidity:    min + rand.Float64()*(max-min),
-		Time:        time.Now().UTC().Unix(),
-	}
-}
-
 func getEnvVar(key, fallbackValue string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return strings.TrimSpace(val)
 	}
 	return fallbackValue
 }
+
+func getEnvIntOrFail(key, fallbackValue string) int64 {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
+
+func getEnvFloatOrFail(key, fallbackValue string) float64 {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
+
+func getEnvDurationOrFail(key, fallbackValue string) time.Duration {
+	s := getEnvVar(key, fallbackValue)
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Fatalf("invalid duration variable: %s - %v", s, err)
+	}
+	return d
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+)
+
+// publishFunc publishes single serialized reading
+type publishFunc func(ctx context.Context, data []byte) error
+
+// entry is single buffered reading
+type entry struct {
+	data []byte
+}
+
+// outbox buffers readings in memory while they can't be published
+// and publishes them in order with retries once the sidecar is back
+type outbox struct {
+	publish  publishFunc
+	size     int
+	attempts int
+	backoff  time.Duration
+	// wake signals the flush of the added readings
+	wake chan struct{}
+
+	mu       sync.Mutex
+	queue    []*entry
+	inflight *entry
+	degraded bool
+	lastErr  error
+	lastOK   time.Time
+
+	published int64
+	failures  int64
+	dropped   int64
+}
+
+func newOutbox(fn publishFunc, size, attempts int, backoff time.Duration) (*outbox, error) {
+	if size < 1 {
+		return nil, errors.Errorf("invalid outbox size: %d", size)
+	}
+	if attempts < 1 {
+		return nil, errors.Errorf("invalid publish attempts: %d", attempts)
+	}
+	return &outbox{
+		publish:  fn,
+		size:     size,
+		attempts: attempts,
+		backoff:  backoff,
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+// add appends the reading to the outbox and wakes up the flush, when full,
+// the oldest reading which is not being published is dropped
+func (o *outbox) add(data []byte) {
+	o.mu.Lock()
+	if len(o.queue) > 0 && o.buffered() >= o.size {
+		o.queue = o.queue[1:]
+		o.dropped++
+	}
+	o.queue = append(o.queue, &entry{data: data})
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// buffered returns the number of readings not yet published, must be called under lock
+func (o *outbox) buffered() int {
+	if o.inflight != nil {
+		return len(o.queue) + 1
+	}
+	return len(o.queue)
+}
+
+// run flushes the outbox each time readings are added until the context is done,
+// so that slow or failing publishes don't block the production of readings
+func (o *outbox) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+			if err := o.flush(ctx); err != nil {
+				logger.Printf("degraded, %d readings buffered: %v", o.health().Buffered, err)
+			}
+		}
+	}
+}
+
+// flush publishes the buffered readings in order until the outbox is empty,
+// or one of them fails all attempts, in which case the outbox goes into degraded mode.
+// The reading being published is taken out of the queue so that add never drops it.
+func (o *outbox) flush(ctx context.Context) error {
+	for {
+		o.mu.Lock()
+		if len(o.queue) == 0 {
+			o.mu.Unlock()
+			return nil
+		}
+		o.inflight = o.queue[0]
+		o.queue = o.queue[1:]
+		head := o.inflight
+		o.mu.Unlock()
+
+		err := o.publishWithRetry(ctx, head.data)
+
+		o.mu.Lock()
+		o.inflight = nil
+		if err != nil {
+			// put back in front to keep the order, unless the outbox filled up in the meantime
+			// in which case it's the oldest reading to drop
+			if len(o.queue) < o.size {
+				o.queue = append([]*entry{head}, o.queue...)
+			} else {
+				o.dropped++
+			}
+			o.degraded = true
+			o.lastErr = err
+			o.mu.Unlock()
+			return err
+		}
+		o.published++
+		o.degraded = false
+		o.lastErr = nil
+		o.lastOK = time.Now()
+		o.mu.Unlock()
+		logger.Printf("published: %s", head.data)
+	}
+}
+
+func (o *outbox) publishWithRetry(ctx context.Context, data []byte) error {
+	backoff := o.backoff
+	var err error
+	for i := 0; i < o.attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = o.publish(ctx, data); err == nil {
+			return nil
+		}
+		o.mu.Lock()
+		o.failures++
+		o.mu.Unlock()
+		logger.Printf("error publishing (attempt %d/%d): %v", i+1, o.attempts, err)
+	}
+	return errors.Wrapf(err, "error publishing after %d attempts", o.attempts)
+}
+
+// health is the producer health report
+type health struct {
+	Status    string `json:"status"`
+	Buffered  int    `json:"buffered"`
+	Published int64  `json:"published"`
+	Failures  int64  `json:"failures"`
+	Dropped   int64  `json:"dropped"`
+	LastError string `json:"last_error,omitempty"`
+	LastOK    string `json:"last_published,omitempty"`
+}
+
+func (o *outbox) health() *health {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	h := &health{
+		Status:    statusOK,
+		Buffered:  o.buffered(),
+		Published: o.published,
+		Failures:  o.failures,
+		Dropped:   o.dropped,
+	}
+	if o.degraded {
+		h.Status = statusDegraded
+	}
+	if o.lastErr != nil {
+		h.LastError = o.lastErr.Error()
+	}
+	if !o.lastOK.IsZero() {
+		h.LastOK = o.lastOK.UTC().Format(time.RFC3339)
+	}
+	return h
+}
+
+// healthHandler reports the producer as alive even in degraded mode
+// so that it's not restarted while the sidecar is unavailable
+func (o *outbox) healthHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, o.health())
+}
+
+// readyHandler reports the producer as not ready in degraded mode
+func (o *outbox) readyHandler(w http.ResponseWriter, r *http.Request) {
+	h := o.health()
+	code := http.StatusOK
+	if h.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, h)
+}
+
+func writeHealth(w http.ResponseWriter, code int, h *health) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		logger.Printf("error encoding health: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// recordingPublisher records the published readings and fails while down
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []string
+	down      bool
+	// block, when set, holds each publish until it's closed
+	block chan struct{}
+	// started is signaled at the start of each publish
+	started chan struct{}
+}
+
+func (p *recordingPublisher) publish(ctx context.Context, data []byte) error {
+	if p.started != nil {
+		p.started <- struct{}{}
+	}
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("sidecar down")
+	}
+	p.published = append(p.published, string(data))
+	return nil
+}
+
+func (p *recordingPublisher) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+func (p *recordingPublisher) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+func testOutbox(t *testing.T, p *recordingPublisher, size int) *outbox {
+	t.Helper()
+	o, err := newOutbox(p.publish, size, 2, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error creating outbox: %v", err)
+	}
+	return o
+}
+
+func assertPublished(t *testing.T, p *recordingPublisher, want ...string) {
+	t.Helper()
+	got := p.list()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v published, got: %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v published, got: %v", want, got)
+		}
+	}
+}
+
+func TestOutboxBuffersInOrderWhileDegraded(t *testing.T) {
+	p := &recordingPublisher{}
+	o := testOutbox(t, p, 10)
+
+	p.setDown(true)
+	o.add([]byte("1"))
+	o.add([]byte("2"))
+	if err := o.flush(context.Background()); err == nil {
+		t.Fatal("expected error while sidecar is down")
+	}
+	h := o.health()
+	if h.Status != statusDegraded || h.Buffered != 2 || h.Failures != 2 {
+		t.Fatalf("expected degraded outbox with 2 buffered readings, got: %+v", h)
+	}
+
+	p.setDown(false)
+	o.add([]byte("3"))
+	if err := o.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertPublished(t, p, "1", "2", "3")
+	if h := o.health(); h.Status != statusOK || h.Buffered != 0 || h.Published != 3 {
+		t.Fatalf("expected recovered outbox, got: %+v", h)
+	}
+}
+
+func TestOutboxDropsOldestWhenFull(t *testing.T) {
+	p := &recordingPublisher{}
+	o := testOutbox(t, p, 2)
+	for _, r := range []string{"1", "2", "3"} {
+		o.add([]byte(r))
+	}
+	if err := o.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertPublished(t, p, "2", "3")
+	if h := o.health(); h.Dropped != 1 {
+		t.Fatalf("expected 1 dropped reading, got: %+v", h)
+	}
+}
+
+func TestOutboxNeverDropsReadingBeingPublished(t *testing.T) {
+	p := &recordingPublisher{block: make(chan struct{}), started: make(chan struct{}, 10)}
+	o := testOutbox(t, p, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.run(ctx)
+
+	o.add([]byte("1"))
+	<-p.started
+	// 1 is being published, so the outbox drops 2, the oldest one waiting
+	for _, r := range []string{"2", "3"} {
+		o.add([]byte(r))
+	}
+	if h := o.health(); h.Buffered != 2 || h.Dropped != 1 {
+		t.Fatalf("expected 2 buffered and 1 dropped reading, got: %+v", h)
+	}
+	close(p.block)
+
+	deadline := time.Now().Add(time.Second)
+	for len(p.list()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assertPublished(t, p, "1", "3")
+}
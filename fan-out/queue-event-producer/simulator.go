@@ -0,0 +1,204 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// hour of the day with the highest temperature and lowest humidity
+	dailyPeakHour = 15
+	// how fast the random walk reverts to the baseline (0-1)
+	walkReversion = 0.05
+)
+
+// simulatorConfig defines the device fleet and the imperfections of its emission
+type simulatorConfig struct {
+	// Devices is the comma separated list of device (room) names
+	Devices string
+	// Instance identifies this producer in the reading IDs so they don't collide across
+	// restarts and replicas, random when not set
+	Instance string
+	// Seed makes the simulation reproducible, 0 seeds from current time
+	Seed int64
+	// TemperatureBase and HumidityBase are the average fleet baselines,
+	// each device gets its own baseline around them
+	TemperatureBase float64
+	HumidityBase    float64
+	// DayLength is the period of the daily cycle, shorter than 24h to speed up demos
+	DayLength time.Duration
+	// DailyAmplitude is the temperature swing of the daily cycle, humidity swings inversely
+	DailyAmplitude float64
+	// WalkStep is the standard deviation of each random walk step
+	WalkStep float64
+	// Noise is the standard deviation of the measurement noise
+	Noise float64
+	// AnomalyRate is the probability of reading with temperature spike of AnomalySize
+	AnomalyRate float64
+	AnomalySize float64
+	// DropoutRate is the probability of reading not being emitted at all
+	DropoutRate float64
+	// ReorderRate is the probability of reading being emitted after the next one
+	ReorderRate float64
+	// DuplicateRate is the probability of reading being emitted twice
+	DuplicateRate float64
+}
+
+func (c *simulatorConfig) validate() error {
+	if len(c.deviceNames()) == 0 {
+		return errors.New("at least one device required")
+	}
+	if strings.Contains(c.Instance, "-") {
+		return errors.Errorf("invalid instance, must not contain dash: %s", c.Instance)
+	}
+	if c.DayLength <= 0 {
+		return errors.Errorf("invalid day length: %v", c.DayLength)
+	}
+	for name, r := range map[string]float64{
+		"anomaly": c.AnomalyRate, "dropout": c.DropoutRate,
+		"reorder": c.ReorderRate, "duplicate": c.DuplicateRate,
+	} {
+		if r < 0 || r > 1 {
+			return errors.Errorf("invalid %s rate, expected 0-1: %f", name, r)
+		}
+	}
+	if c.WalkStep < 0 || c.Noise < 0 {
+		return errors.Errorf("invalid walk step (%f) or noise (%f)", c.WalkStep, c.Noise)
+	}
+	return nil
+}
+
+func (c *simulatorConfig) deviceNames() []string {
+	var list []string
+	for _, n := range strings.Split(c.Devices, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			list = append(list, n)
+		}
+	}
+	return list
+}
+
+// device is single simulated sensor
+type device struct {
+	name     string
+	seq      int64
+	tempBase float64
+	humBase  float64
+	// tempWalk and humWalk are the current random walk offsets from the baseline
+	tempWalk float64
+	humWalk  float64
+	// held is the reading delayed to be emitted out of order
+	held *roomReading
+}
+
+// simulator generates readings of the device fleet, it is not safe for concurrent use
+type simulator struct {
+	cfg      *simulatorConfig
+	rnd      *rand.Rand
+	instance string
+	devices  []*device
+}
+
+func newSimulator(cfg *simulatorConfig) (*simulator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	instance := cfg.Instance
+	if instance == "" {
+		// not drawn from the seeded source so that reproducible simulations still get unique IDs
+		b := make([]byte, 4)
+		if _, err := crand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "error generating instance")
+		}
+		instance = hex.EncodeToString(b)
+	}
+	s := &simulator{cfg: cfg, rnd: rand.New(rand.NewSource(seed)), instance: instance}
+	for _, n := range cfg.deviceNames() {
+		s.devices = append(s.devices, &device{
+			name:     n,
+			tempBase: cfg.TemperatureBase + s.rnd.NormFloat64()*2,
+			humBase:  cfg.HumidityBase + s.rnd.NormFloat64()*5,
+		})
+	}
+	return s, nil
+}
+
+// next returns the readings of all devices to emit at now, after the dropouts,
+// duplicates and reordering, so there can be none or more than one per device
+func (s *simulator) next(now time.Time) []*roomReading {
+	var list []*roomReading
+	for _, d := range s.devices {
+		r := s.read(d, now)
+
+		if s.chance(s.cfg.DropoutRate) {
+			continue
+		}
+		if d.held == nil && s.chance(s.cfg.ReorderRate) {
+			d.held = r
+			continue
+		}
+		list = append(list, r)
+		if s.chance(s.cfg.DuplicateRate) {
+			list = append(list, r)
+		}
+		if d.held != nil {
+			list = append(list, d.held)
+			d.held = nil
+		}
+	}
+	return list
+}
+
+// read measures the device at now: baseline, plus daily cycle, random walk, noise, and anomaly
+func (s *simulator) read(d *device, now time.Time) *roomReading {
+	d.seq++
+	d.tempWalk += s.rnd.NormFloat64()*s.cfg.WalkStep - d.tempWalk*walkReversion
+	d.humWalk += s.rnd.NormFloat64()*s.cfg.WalkStep - d.humWalk*walkReversion
+
+	cycle := s.dailyCycle(now)
+	temp := d.tempBase + cycle*s.cfg.DailyAmplitude + d.tempWalk + s.rnd.NormFloat64()*s.cfg.Noise
+	hum := d.humBase - cycle*s.cfg.DailyAmplitude + d.humWalk + s.rnd.NormFloat64()*s.cfg.Noise
+
+	if s.chance(s.cfg.AnomalyRate) {
+		if s.rnd.Intn(2) == 0 {
+			temp += s.cfg.AnomalySize
+		} else {
+			temp -= s.cfg.AnomalySize
+		}
+	}
+
+	return &roomReading{
+		ID:          fmt.Sprintf("%s-%s-%d", d.name, s.instance, d.seq),
+		Room:        d.name,
+		Temperature: round(temp),
+		Humidity:    round(math.Max(0, math.Min(100, hum))),
+		Time:        now.UTC().Unix(),
+	}
+}
+
+// dailyCycle returns position in the daily cycle from -1 to 1 peaking at dailyPeakHour
+func (s *simulator) dailyCycle(now time.Time) float64 {
+	day := s.cfg.DayLength
+	peak := time.Duration(float64(day) * dailyPeakHour / 24)
+	pos := float64((time.Duration(now.UnixNano())-peak)%day) / float64(day)
+	return math.Cos(2 * math.Pi * pos)
+}
+
+func (s *simulator) chance(rate float64) bool {
+	return rate > 0 && s.rnd.Float64() < rate
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
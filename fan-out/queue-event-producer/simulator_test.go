@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulatorIDsAreUniqueAcrossInstances(t *testing.T) {
+	cfg := &simulatorConfig{Devices: "kitchen,living-room", Seed: 1, DayLength: time.Hour}
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		sim, err := newSimulator(cfg)
+		if err != nil {
+			t.Fatalf("error creating simulator: %v", err)
+		}
+		for _, r := range sim.next(time.Unix(1600000000, 0)) {
+			if ids[r.ID] {
+				t.Fatalf("duplicate ID across instances: %s", r.ID)
+			}
+			ids[r.ID] = true
+			if !strings.HasPrefix(r.ID, r.Room+"-"+sim.instance+"-") || !strings.HasSuffix(r.ID, "-1") {
+				t.Fatalf("expected <device>-<instance>-<sequence> ID, got: %s", r.ID)
+			}
+		}
+	}
+
+	cfg.Instance = "a-b"
+	if _, err := newSimulator(cfg); err == nil {
+		t.Fatal("expected error for instance with dash")
+	}
+}
@@ -2,10 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"encoding/xml"
-	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -13,14 +11,16 @@ import (
 	dapr "github.com/dapr/go-sdk/client"
 	"github.com/dapr/go-sdk/service/common"
 	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
 	"github.com/pkg/errors"
 )
 
 var (
 	logger = log.New(os.Stdout, "", 0)
-	client dapr.Client
 
 	serviceAddress = getEnvVar("ADDRESS", ":60010")
+	daprHTTPPort   = getEnvVar("DAPR_HTTP_PORT", "3500")
+	httpClient     = &http.Client{Timeout: 10 * time.Second}
 
 	sourcePubSubName = getEnvVar("SOURCE_PUBSUB_NAME", "fanout-source-pubsub")
 	sourceTopicName  = getEnvVar("SOURCE_TOPIC_NAME", "events")
@@ -28,6 +28,8 @@ var (
 	targetPubSubName  = getEnvVar("TARGET_PUBSUB_NAME", "fanout-target-pubsub")
 	targetTopicName   = getEnvVar("TARGET_TOPIC_NAME", "events")
 	targetTopicFormat = getEnvVar("TARGET_TOPIC_FORMAT", "csv")
+
+	handler *target.Handler
 )
 
 func main() {
@@ -37,12 +39,29 @@ func main() {
 		log.Fatalf("failed to start the server: %v", err)
 	}
 
-	c, err := dapr.NewClient()
-	if err != nil {
-		log.Fatalf("failed to create Dapr client: %v", err)
+	// the single target is published to using HTTP API, the client is needed only for targets file
+	cfg := target.HandlerConfigFromEnv()
+	var client dapr.Client
+	if cfg.TargetsFile != "" {
+		if client, err = dapr.NewClient(); err != nil {
+			log.Fatalf("failed to create Dapr client: %v", err)
+		}
+		defer client.Close()
+	}
+
+	single := &target.SingleTarget{
+		Name:   targetPubSubName + "/" + targetTopicName,
+		Format: targetTopicFormat,
+		Destination: &target.Destination{
+			Kind:   target.KindTopic,
+			PubSub: targetPubSubName,
+			Topic:  targetTopicName,
+		},
+		Send: publish,
+	}
+	if handler, err = target.NewHandler(cfg, client, single); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
-	client = c
-	defer client.Close()
 
 	// add handler to the service
 	sub := &common.Subscription{PubsubName: sourcePubSubName, Topic: sourceTopicName}
@@ -54,52 +73,18 @@ func main() {
 	}
 }
 
-// SourceEvent represents the input event
-type SourceEvent struct {
-	ID          string  `json:"id"`
-	Temperature float64 `json:"temperature"`
-	Humidity    float64 `json:"humidity"`
-	Time        int64   `json:"time"`
-}
-
 func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
 	logger.Printf("Event - PubsubName:%s, Topic:%s, ID:%s", e.PubsubName, e.Topic, e.ID)
+	return handler.Handle(ctx, e)
+}
 
-	d, ok := e.Data.([]byte)
-	if !ok {
-		return false, errors.Errorf("invalid event data type: %T", e.Data)
-	}
-
-	var se SourceEvent
-	if err := json.Unmarshal(d, &se); err != nil {
-		return false, errors.Errorf("error parsing input content: %v", err)
-	}
-
-	var (
-		me error
-		b  []byte
-	)
-
-	switch strings.ToLower(targetTopicFormat) {
-	case "json":
-		b = d
-	case "xml":
-		if b, me = xml.Marshal(&e); me != nil {
-			return false, errors.Errorf("error while converting content: %v", me)
-		}
-	case "csv":
-		b = []byte(fmt.Sprintf(`"%s",%f,%f,"%s"`,
-			se.ID, se.Temperature, se.Humidity, time.Unix(se.Time, 0).Format(time.RFC3339)))
-	default:
-		return false, errors.Errorf("invalid target format: %s", targetTopicFormat)
-	}
-	logger.Printf("Target (%s): %s", targetTopicFormat, b)
-
-	if err := client.PublishEvent(ctx, targetPubSubName, targetTopicName, b); err != nil {
-		return true, errors.Wrap(err, "error publishing converted content")
+// publish publishes the converted content onto the target topic, the Dapr HTTP API
+// is used because the Dapr SDK client doesn't support content type on publish
+func publish(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
+	if err := target.Publish(ctx, httpClient, daprHTTPPort, targetPubSubName, targetTopicName, data, contentType); err != nil {
+		return errors.Wrap(err, "error publishing converted content")
 	}
-
-	return false, nil
+	return nil
 }
 
 func getEnvVar(key, fallbackValue string) string {
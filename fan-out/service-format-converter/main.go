@@ -2,17 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"encoding/xml"
-	"fmt"
 	"log"
 	"os"
 	"strings"
-	"time"
 
 	dapr "github.com/dapr/go-sdk/client"
 	"github.com/dapr/go-sdk/service/common"
 	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
 	"github.com/pkg/errors"
 )
 
@@ -28,6 +25,8 @@ var (
 	targetServiceID  = getEnvVar("TARGET_SERVICE", "grpc-echo-service")
 	targetMethodName = getEnvVar("TARGET_METHOD", "echo")
 	targetFormat     = getEnvVar("TARGET_FORMAT", "xml")
+
+	handler *target.Handler
 )
 
 func main() {
@@ -44,6 +43,20 @@ func main() {
 	client = c
 	defer client.Close()
 
+	single := &target.SingleTarget{
+		Name:   targetServiceID + "/" + targetMethodName,
+		Format: targetFormat,
+		Destination: &target.Destination{
+			Kind:    target.KindService,
+			Service: targetServiceID,
+			Method:  targetMethodName,
+		},
+		Send: invokeService,
+	}
+	if handler, err = target.NewHandler(target.HandlerConfigFromEnv(), client, single); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
 	// add handler to the service
 	sub := &common.Subscription{PubsubName: sourcePubSubName, Topic: sourceTopicName}
 	s.AddTopicEventHandler(sub, eventHandler)
@@ -54,59 +67,20 @@ func main() {
 	}
 }
 
-// SourceEvent represents the input event
-type SourceEvent struct {
-	ID          string  `json:"id"`
-	Temperature float64 `json:"temperature"`
-	Humidity    float64 `json:"humidity"`
-	Time        int64   `json:"time"`
-}
-
 func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
 	logger.Printf("Event - PubsubName:%s, Topic:%s, ID:%s", e.PubsubName, e.Topic, e.ID)
+	return handler.Handle(ctx, e)
+}
 
-	d, ok := e.Data.([]byte)
-	if !ok {
-		return false, errors.Errorf("invalid event data type: %T", e.Data)
-	}
-
-	var se SourceEvent
-	if err := json.Unmarshal(d, &se); err != nil {
-		return false, errors.Errorf("error parsing input content: %v", err)
-	}
-
-	var (
-		me error
-		b  []byte
-		ct string
-	)
-
-	switch strings.ToLower(targetFormat) {
-	case "json":
-		b = d
-		ct = "application/json"
-	case "xml":
-		if b, me = xml.Marshal(&e); me != nil {
-			return false, errors.Errorf("error while converting content: %v", me)
-		}
-		ct = "application/xml"
-	case "csv":
-		b = []byte(fmt.Sprintf(`"%s",%f,%f,"%s"`,
-			se.ID, se.Temperature, se.Humidity, time.Unix(se.Time, 0).Format(time.RFC3339)))
-		ct = "text/csv"
-	default:
-		return false, errors.Errorf("invalid target format: %s", targetFormat)
-	}
-	logger.Printf("Target (%s): %s", targetFormat, b)
-
-	content := &dapr.DataContent{Data: b, ContentType: ct}
+// invokeService sends the converted content to the target service
+func invokeService(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
+	content := &dapr.DataContent{Data: data, ContentType: contentType}
 	out, err := client.InvokeServiceWithContent(ctx, targetServiceID, targetMethodName, content)
 	if err != nil {
-		return true, errors.Wrap(err, "error invoking target binding")
+		return errors.Wrap(err, "error invoking target service")
 	}
 	logger.Printf("Response: %s", out)
-
-	return false, nil
+	return nil
 }
 
 func getEnvVar(key, fallbackValue string) string {
@@ -0,0 +1,124 @@
+package target
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// number of attempts between sweeps of expired entries
+	sweepInterval = 1000
+)
+
+// AttemptTracker counts the delivery attempts of each event ID across its redeliveries
+type AttemptTracker struct {
+	mu       sync.Mutex
+	max      int
+	ttl      time.Duration
+	calls    int
+	attempts map[string]*attempt
+}
+
+type attempt struct {
+	count int
+	last  time.Time
+}
+
+// NewAttemptTracker creates tracker allowing max attempts per event ID,
+// IDs without any attempt for longer than ttl are forgotten
+func NewAttemptTracker(max int, ttl time.Duration) *AttemptTracker {
+	if max < 1 {
+		max = 1
+	}
+	return &AttemptTracker{
+		max:      max,
+		ttl:      ttl,
+		attempts: make(map[string]*attempt),
+	}
+}
+
+// Attempt records new attempt of the event ID, returns the attempt number
+// and whether it's the last one allowed
+func (t *AttemptTracker) Attempt(id string) (n int, last bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.calls++
+	if t.calls%sweepInterval == 0 {
+		for k, a := range t.attempts {
+			if now.Sub(a.last) > t.ttl {
+				delete(t.attempts, k)
+			}
+		}
+	}
+
+	a, ok := t.attempts[id]
+	if !ok || now.Sub(a.last) > t.ttl {
+		a = &attempt{}
+		t.attempts[id] = a
+	}
+	a.count++
+	a.last = now
+	return a.count, a.count >= t.max
+}
+
+// Done forgets the event ID once it was either delivered or dead-lettered
+func (t *AttemptTracker) Done(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, id)
+}
+
+// settledTracker records the targets each event ID was already delivered to or dead-lettered for
+type settledTracker struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	calls   int
+	targets map[string]*settled
+}
+
+type settled struct {
+	targets map[string]bool
+	last    time.Time
+}
+
+func newSettledTracker(ttl time.Duration) *settledTracker {
+	return &settledTracker{ttl: ttl, targets: make(map[string]*settled)}
+}
+
+func (t *settledTracker) add(id, target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.calls++
+	if t.calls%sweepInterval == 0 {
+		for k, s := range t.targets {
+			if now.Sub(s.last) > t.ttl {
+				delete(t.targets, k)
+			}
+		}
+	}
+
+	s, ok := t.targets[id]
+	if !ok {
+		s = &settled{targets: make(map[string]bool)}
+		t.targets[id] = s
+	}
+	s.targets[target] = true
+	s.last = now
+}
+
+func (t *settledTracker) has(id, target string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.targets[id]
+	return ok && s.targets[target] && time.Since(s.last) <= t.ttl
+}
+
+func (t *settledTracker) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.targets, id)
+}
@@ -0,0 +1,110 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is the event which could not be converted or delivered
+type DeadLetter struct {
+	// ID is the ID of the original event.
+	ID string `json:"id"`
+	// SourcePubSub is the pub/sub component from which the original event was received.
+	SourcePubSub string `json:"source_pubsub"`
+	// SourceTopic is the topic from which the original event was received.
+	SourceTopic string `json:"source_topic"`
+	// Target is the name of the target to which the event could not be delivered,
+	// empty when the event failed before reaching any target (e.g. parsing).
+	Target string `json:"target,omitempty"`
+	// Destination describes the target which is not in the targets file
+	// (i.e. single target of the converter) so that the event can be replayed to it.
+	Destination *Destination `json:"destination,omitempty"`
+	// Error is the last error.
+	Error string `json:"error"`
+	// Reasons are the validation failure reasons of the quarantined events.
+	Reasons []string `json:"reasons,omitempty"`
+	// Attempts is the number of delivery attempts.
+	Attempts int `json:"attempts"`
+	// Time is the time when the event was dead-lettered in RFC 3339 format.
+	Time string `json:"time"`
+	// ContentType is the content type of the original event data.
+	ContentType string `json:"content_type,omitempty"`
+	// Data is the original event data.
+	Data []byte `json:"data"`
+}
+
+// Destination is the kind, component, and format of the target recorded in the dead letter
+type Destination struct {
+	// Kind is the kind of target: topic, binding, or service.
+	Kind string `json:"kind"`
+	// Format is the format of the converted content.
+	Format string `json:"format"`
+	// PubSub and Topic are the pub/sub component and topic of the topic target.
+	PubSub string `json:"pubsub,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+	// Binding and Operation are the output binding and its operation of the binding target.
+	Binding   string `json:"binding,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	// Service and Method are the service ID and method of the service target.
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+// target returns validated target of the destination with the default retry policy
+func (d *Destination) target(name string) (*Target, error) {
+	t := &Target{
+		Name:      name,
+		Kind:      d.Kind,
+		Format:    d.Format,
+		PubSub:    d.PubSub,
+		Topic:     d.Topic,
+		Binding:   d.Binding,
+		Operation: d.Operation,
+		Service:   d.Service,
+		Method:    d.Method,
+	}
+	if err := t.init(); err != nil {
+		return nil, errors.Wrapf(err, "invalid destination of target %s", name)
+	}
+	return t, nil
+}
+
+// DeadLetterPublisher publishes dead letters onto pub/sub topic
+type DeadLetterPublisher struct {
+	httpClient *http.Client
+	httpPort   string
+	pubsub     string
+	topic      string
+}
+
+// NewDeadLetterPublisher creates publisher of dead letters using the Dapr HTTP API on httpPort
+func NewDeadLetterPublisher(httpPort, pubsub, topic string) (*DeadLetterPublisher, error) {
+	if pubsub == "" || topic == "" {
+		return nil, errors.New("dead letter pubsub and topic required")
+	}
+	return &DeadLetterPublisher{
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		httpPort:   httpPort,
+		pubsub:     pubsub,
+		topic:      topic,
+	}, nil
+}
+
+// Publish publishes the dead letter, the time is set when not already defined
+func (p *DeadLetterPublisher) Publish(ctx context.Context, dl *DeadLetter) error {
+	if dl.Time == "" {
+		dl.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return errors.Wrap(err, "error serializing dead letter")
+	}
+	if err := Publish(ctx, p.httpClient, p.httpPort, p.pubsub, p.topic, b, "application/json"); err != nil {
+		return errors.Wrapf(err, "error dead-lettering event: %s", dl.ID)
+	}
+	return nil
+}
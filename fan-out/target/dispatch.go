@@ -0,0 +1,199 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+// Result is the outcome of single event delivery to single target
+type Result struct {
+	// Target is the name of the target.
+	Target string
+	// Skipped indicates the event did not match the target filter.
+	Skipped bool
+	// Settled indicates the event was already delivered to, or dead-lettered for,
+	// the target in one of its previous deliveries so it was not sent again.
+	Settled bool
+	// Attempts is the number of delivery attempts.
+	Attempts int
+	// Duration is the total time spent on the delivery, including retries.
+	Duration time.Duration
+	// Err is the last delivery error, nil when the delivery succeeded.
+	Err error
+}
+
+// Dispatcher sends each source event to all of its targets in parallel
+type Dispatcher struct {
+	targets []*Target
+	sender  Sender
+	mapping *convert.Mapping
+	settled *settledTracker
+}
+
+// NewDispatcher creates dispatcher for the configured targets,
+// the optional mapping is applied to each event before conversion
+func NewDispatcher(cfg *Config, sender Sender, mapping *convert.Mapping) (*Dispatcher, error) {
+	if cfg == nil || len(cfg.Targets) == 0 {
+		return nil, errors.New("at least one target required")
+	}
+	d, err := NewRedeliverer(sender, mapping)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range cfg.Targets {
+		if err := convert.CheckMapping(t.converter, mapping); err != nil {
+			return nil, errors.Wrapf(err, "target %s", t.Name)
+		}
+	}
+	d.targets = cfg.Targets
+	return d, nil
+}
+
+// NewRedeliverer creates dispatcher without any configured targets, which only
+// redelivers the dead letters to the destinations recorded in them
+func NewRedeliverer(sender Sender, mapping *convert.Mapping) (*Dispatcher, error) {
+	if sender == nil {
+		return nil, errors.New("sender required")
+	}
+	return &Dispatcher{
+		sender:  sender,
+		mapping: mapping,
+		settled: newSettledTracker(settledTTL),
+	}, nil
+}
+
+// Dispatch sends the event to all of the targets, each one is retried independently
+// so the failure of one doesn't cause duplicates in the others. When the same event is
+// dispatched again (e.g. redelivered after failed dead-lettering), the targets already
+// settled are not sent to again. The returned error lists the targets to which the event
+// could not be delivered.
+func (d *Dispatcher) Dispatch(ctx context.Context, id string, data []byte) ([]*Result, error) {
+	var in map[string]interface{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, errors.Wrap(err, "error parsing input content")
+	}
+
+	results := make([]*Result, len(d.targets))
+	var wg sync.WaitGroup
+	for i, t := range d.targets {
+		if d.settled.has(id, t.Name) {
+			results[i] = &Result{Target: t.Name, Settled: true}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t *Target) {
+			defer wg.Done()
+			results[i] = d.deliver(ctx, t, id, data, in)
+			if results[i].Err == nil {
+				d.settled.add(id, t.Name)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Target+": "+r.Err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return results, errors.Errorf("%d of %d targets failed (%s)",
+			len(failed), len(results), strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// DeliverTo sends the event only to the named target (e.g. when replaying its dead letter)
+func (d *Dispatcher) DeliverTo(ctx context.Context, name, id string, data []byte) (*Result, error) {
+	for _, t := range d.targets {
+		if t.Name != name {
+			continue
+		}
+		var in map[string]interface{}
+		if err := json.Unmarshal(data, &in); err != nil {
+			return nil, errors.Wrap(err, "error parsing input content")
+		}
+		return d.deliver(ctx, t, id, data, in), nil
+	}
+	return nil, errors.Errorf("target not found: %s", name)
+}
+
+// Redeliver sends the dead-lettered event to its failed target: the configured target
+// of the same name or, when there is none, the destination recorded in the dead letter
+func (d *Dispatcher) Redeliver(ctx context.Context, dl *DeadLetter) (*Result, error) {
+	for _, t := range d.targets {
+		if t.Name == dl.Target {
+			return d.DeliverTo(ctx, dl.Target, dl.ID, dl.Data)
+		}
+	}
+	if dl.Destination == nil {
+		return nil, errors.Errorf("target not found: %s", dl.Target)
+	}
+	t, err := dl.Destination.target(dl.Target)
+	if err != nil {
+		return nil, err
+	}
+	if err := convert.CheckMapping(t.converter, d.mapping); err != nil {
+		return nil, errors.Wrapf(err, "target %s", t.Name)
+	}
+	var in map[string]interface{}
+	if err := json.Unmarshal(dl.Data, &in); err != nil {
+		return nil, errors.Wrap(err, "error parsing input content")
+	}
+	return d.deliver(ctx, t, dl.ID, dl.Data, in), nil
+}
+
+// Settle records the event as dead-lettered for the target so it's not sent there again
+func (d *Dispatcher) Settle(id, target string) {
+	d.settled.add(id, target)
+}
+
+// Forget forgets the settled targets of the event once it's completely handled
+func (d *Dispatcher) Forget(id string) {
+	d.settled.forget(id)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, t *Target, id string, data []byte, in map[string]interface{}) *Result {
+	start := time.Now()
+	r := &Result{Target: t.Name}
+	defer func() {
+		r.Duration = time.Since(start)
+	}()
+
+	if !matchesAll(t.Filter, in) {
+		r.Skipped = true
+		return r
+	}
+
+	b, err := convert.ConvertData(t.converter, d.mapping, data)
+	if err != nil {
+		r.Err = errors.Wrap(err, "error converting content")
+		return r
+	}
+
+	backoff := t.backoff
+	for r.Attempts < t.Attempts {
+		r.Attempts++
+		actx, cancel := context.WithTimeout(ctx, t.timeout)
+		r.Err = d.sender.Send(actx, t, id, b, t.converter.ContentType())
+		cancel()
+		if r.Err == nil || r.Attempts == t.Attempts {
+			return r
+		}
+		select {
+		case <-ctx.Done():
+			r.Err = errors.Wrap(ctx.Err(), r.Err.Error())
+			return r
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+	return r
+}
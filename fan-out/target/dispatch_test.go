@@ -0,0 +1,158 @@
+package target
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// recordingSender counts the sends to each target and fails the ones in fail
+type recordingSender struct {
+	mu   sync.Mutex
+	sent map[string]int
+	fail map[string]bool
+}
+
+func (s *recordingSender) Send(ctx context.Context, t *Target, id string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[t.Name]++
+	if s.fail[t.Name] {
+		return errors.New("target down")
+	}
+	return nil
+}
+
+func testDispatcher(t *testing.T, sender Sender) *Dispatcher {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(`
+targets:
+- name: a
+  kind: topic
+  pubsub: p
+  topic: t
+  format: json
+  attempts: 1
+- name: b
+  kind: binding
+  binding: b
+  format: csv
+  attempts: 2
+  backoff: 1ms
+- name: hot
+  kind: service
+  service: s
+  method: m
+  format: xml
+  attempts: 1
+  filter:
+  - field: temperature
+    op: gt
+    value: 80
+`))
+	if err != nil {
+		t.Fatalf("invalid targets: %v", err)
+	}
+	d, err := NewDispatcher(cfg, sender, nil)
+	if err != nil {
+		t.Fatalf("error creating dispatcher: %v", err)
+	}
+	return d
+}
+
+func TestDispatchRetriesTargetsIndependently(t *testing.T) {
+	s := &recordingSender{sent: map[string]int{}, fail: map[string]bool{"b": true}}
+	d := testDispatcher(t, s)
+	data := []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)
+
+	results, err := d.Dispatch(context.Background(), "d1-1", data)
+	if err == nil {
+		t.Fatal("expected error for failed target")
+	}
+	if !results[2].Skipped {
+		t.Fatalf("expected filtered target to be skipped: %+v", results[2])
+	}
+	if results[0].Err != nil || results[1].Err == nil || results[1].Attempts != 2 {
+		t.Fatalf("unexpected results: %+v, %+v", results[0], results[1])
+	}
+	if s.sent["a"] != 1 || s.sent["b"] != 2 || s.sent["hot"] != 0 {
+		t.Fatalf("unexpected sends: %v", s.sent)
+	}
+}
+
+func TestDispatchSkipsSettledTargetsOnRedelivery(t *testing.T) {
+	s := &recordingSender{sent: map[string]int{}, fail: map[string]bool{"b": true}}
+	d := testDispatcher(t, s)
+	data := []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)
+
+	// first delivery fails b, whose dead-lettering fails too, so the event is redelivered
+	if _, err := d.Dispatch(context.Background(), "d1-1", data); err == nil {
+		t.Fatal("expected error for failed target")
+	}
+	s.fail["b"] = false
+	results, err := d.Dispatch(context.Background(), "d1-1", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !results[0].Settled || results[1].Settled {
+		t.Fatalf("expected only delivered target to be settled: %+v, %+v", results[0], results[1])
+	}
+	if s.sent["a"] != 1 || s.sent["b"] != 3 {
+		t.Fatalf("unexpected sends: %v", s.sent)
+	}
+
+	// dead-lettered target is settled as well, and forgotten once the event is handled
+	d.Settle("d1-2", "b")
+	if results, _ := d.Dispatch(context.Background(), "d1-2", data); !results[1].Settled {
+		t.Fatalf("expected dead-lettered target to be settled: %+v", results[1])
+	}
+	d.Forget("d1-2")
+	if results, _ := d.Dispatch(context.Background(), "d1-2", data); results[0].Settled || results[1].Settled {
+		t.Fatalf("expected forgotten event to be delivered again: %+v, %+v", results[0], results[1])
+	}
+}
+
+func TestDeliverToSendsOnlyToNamedTarget(t *testing.T) {
+	s := &recordingSender{sent: map[string]int{}, fail: map[string]bool{}}
+	d := testDispatcher(t, s)
+	data := []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)
+
+	r, err := d.DeliverTo(context.Background(), "b", "d1-1", data)
+	if err != nil || r.Err != nil || r.Target != "b" {
+		t.Fatalf("unexpected result: %+v, %v", r, err)
+	}
+	if s.sent["a"] != 0 || s.sent["b"] != 1 {
+		t.Fatalf("unexpected sends: %v", s.sent)
+	}
+	if _, err := d.DeliverTo(context.Background(), "missing", "d1-1", data); err == nil {
+		t.Fatal("expected error for unknown target")
+	}
+}
+
+func TestRedeliverToConfiguredTargetOrDestination(t *testing.T) {
+	s := &recordingSender{sent: map[string]int{}, fail: map[string]bool{}}
+	d := testDispatcher(t, s)
+	data := []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)
+
+	if r, err := d.Redeliver(context.Background(), &DeadLetter{ID: "d1-1", Target: "a", Data: data}); err != nil || r.Err != nil {
+		t.Fatalf("unexpected result: %+v, %v", r, err)
+	}
+	single := &DeadLetter{ID: "d1-1", Target: "p/out", Data: data,
+		Destination: &Destination{Kind: KindTopic, Format: "csv", PubSub: "p", Topic: "out"}}
+	if r, err := d.Redeliver(context.Background(), single); err != nil || r.Err != nil || r.Target != "p/out" {
+		t.Fatalf("unexpected result: %+v, %v", r, err)
+	}
+	if s.sent["a"] != 1 || s.sent["p/out"] != 1 {
+		t.Fatalf("unexpected sends: %v", s.sent)
+	}
+
+	if _, err := d.Redeliver(context.Background(), &DeadLetter{ID: "d1-1", Target: "missing", Data: data}); err == nil {
+		t.Fatal("expected error for unknown target without destination")
+	}
+	invalid := &DeadLetter{ID: "d1-1", Target: "x", Data: data, Destination: &Destination{Kind: KindTopic, Format: "json"}}
+	if _, err := d.Redeliver(context.Background(), invalid); err == nil {
+		t.Fatal("expected error for destination without topic")
+	}
+}
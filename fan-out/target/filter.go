@@ -0,0 +1,106 @@
+package target
+
+import (
+	"fmt"
+
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+const (
+	opEqual        = "eq"
+	opNotEqual     = "ne"
+	opGreater      = "gt"
+	opGreaterEqual = "gte"
+	opLess         = "lt"
+	opLessEqual    = "lte"
+	opExists       = "exists"
+)
+
+// Condition is single filter condition evaluated against the source event field
+type Condition struct {
+	// Field is the dot separated path of the source event field (e.g. sensor.temp).
+	Field string `yaml:"field"`
+	// Op is the comparison operator: eq, ne, gt, gte, lt, lte, or exists.
+	Op string `yaml:"op"`
+	// Value is the value the field is compared to.
+	Value interface{} `yaml:"value"`
+}
+
+func (c *Condition) validate() error {
+	if c.Field == "" {
+		return errors.New("filter field required")
+	}
+	switch c.Op {
+	case opEqual, opNotEqual, opExists:
+	case opGreater, opGreaterEqual, opLess, opLessEqual:
+		if _, ok := toFloat(c.Value); !ok {
+			return errors.Errorf("filter %s %s requires numeric value: %v", c.Field, c.Op, c.Value)
+		}
+	default:
+		return errors.Errorf("invalid filter operator (eq, ne, gt, gte, lt, lte, exists): %s", c.Op)
+	}
+	return nil
+}
+
+// matches checks if the source event meets the condition
+func (c *Condition) matches(in map[string]interface{}) bool {
+	v, ok := convert.Lookup(in, c.Field)
+	switch c.Op {
+	case opExists:
+		return ok && v != nil
+	case opEqual:
+		return ok && equal(v, c.Value)
+	case opNotEqual:
+		return !ok || !equal(v, c.Value)
+	}
+
+	n, ok := toFloat(v)
+	if !ok {
+		return false
+	}
+	cv, _ := toFloat(c.Value)
+	switch c.Op {
+	case opGreater:
+		return n > cv
+	case opGreaterEqual:
+		return n >= cv
+	case opLess:
+		return n < cv
+	case opLessEqual:
+		return n <= cv
+	default:
+		return false
+	}
+}
+
+// matchesAll checks if the source event meets all of the conditions
+func matchesAll(conds []*Condition, in map[string]interface{}) bool {
+	for _, c := range conds {
+		if !c.matches(in) {
+			return false
+		}
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
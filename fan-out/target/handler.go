@@ -0,0 +1,303 @@
+package target
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+var (
+	logger = log.New(os.Stdout, "", 0)
+)
+
+// HandlerConfig is the configuration shared by all of the format converters
+type HandlerConfig struct {
+	// DaprHTTPPort is the port of the Dapr HTTP API used to publish events.
+	DaprHTTPPort string
+	// Format configures the xml, csv, and avro formats.
+	Format *convert.Config
+	// MappingFile is the path of the optional YAML mapping (see convert.Mapping).
+	MappingFile string
+	// TargetsFile is the path of the optional YAML targets, replacing the single target.
+	TargetsFile string
+	// MaxAttempts is the max number of deliveries of each event to the single target.
+	MaxAttempts int
+	// DeadLetterPubSub and DeadLetterTopic is where the undeliverable events are published.
+	DeadLetterPubSub string
+	DeadLetterTopic  string
+	// ValidationMode is the validation mode of the input events: off, lenient, or strict.
+	ValidationMode string
+	// SchemaFile is the path of the JSON Schema, defaults to the schema of the mapping
+	// or, without mapping, to the source event schema.
+	SchemaFile string
+	// QuarantinePubSub and QuarantineTopic is where the invalid events are published.
+	QuarantinePubSub string
+	QuarantineTopic  string
+	// MetricsAddress is the address of the validation metrics server, disabled when empty.
+	MetricsAddress string
+}
+
+// HandlerConfigFromEnv returns the converter configuration defined using environment variables
+func HandlerConfigFromEnv() *HandlerConfig {
+	return &HandlerConfig{
+		DaprHTTPPort: getEnvVar("DAPR_HTTP_PORT", "3500"),
+		Format: &convert.Config{
+			XMLRoot:          getEnvVar("XML_ROOT_ELEMENT", "roomReading"),
+			XMLNamespaces:    getEnvVar("XML_NAMESPACES", ""),
+			XMLElementPrefix: getEnvVar("XML_ELEMENT_PREFIX", ""),
+			CSVHeader:        strings.EqualFold(getEnvVar("CSV_HEADER", "false"), "true"),
+			CSVColumns:       getEnvVar("CSV_COLUMNS", ""),
+			AvroSchema:       getEnvVar("AVRO_SCHEMA", convert.AvroSchemaEmbedded),
+		},
+		MappingFile:      getEnvVar("MAPPING_FILE", ""),
+		TargetsFile:      getEnvVar("TARGETS_FILE", ""),
+		MaxAttempts:      getEnvIntOrFail("MAX_ATTEMPTS", "5"),
+		DeadLetterPubSub: getEnvVar("DEAD_LETTER_PUBSUB_NAME", "fanout-source-pubsub"),
+		DeadLetterTopic:  getEnvVar("DEAD_LETTER_TOPIC_NAME", "events-deadletter"),
+		ValidationMode:   getEnvVar("VALIDATION_MODE", convert.ValidationOff),
+		SchemaFile:       getEnvVar("SCHEMA_FILE", ""),
+		QuarantinePubSub: getEnvVar("QUARANTINE_PUBSUB_NAME", "fanout-source-pubsub"),
+		QuarantineTopic:  getEnvVar("QUARANTINE_TOPIC_NAME", "events-quarantine"),
+		MetricsAddress:   getEnvVar("METRICS_ADDRESS", ""),
+	}
+}
+
+// SingleTarget is the target of the converter when no targets file is configured
+type SingleTarget struct {
+	// Name identifies the target in the dead letters.
+	Name string
+	// Format is the format of the converted content.
+	Format string
+	// Destination describes the target in its dead letters so that they can be replayed
+	// without the targets file, its format is always the Format of the single target.
+	Destination *Destination
+	// Send delivers the converted content of the event to the target.
+	Send func(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error
+}
+
+// Handler handles the source events of the format converters: validates them,
+// converts and delivers them to the single target or dispatches them to all of the
+// configured targets, and dead-letters the ones which can't be delivered
+type Handler struct {
+	single      *SingleTarget
+	converter   convert.Converter
+	mapping     *convert.Mapping
+	dispatcher  *Dispatcher
+	attempts    *AttemptTracker
+	deadLetters *DeadLetterPublisher
+	validator   *convert.Validator
+	quarantined *DeadLetterPublisher
+}
+
+// NewHandler creates the handler, the client is required only when the targets file is
+// configured. When the validation and metrics address are set, it also starts the server
+// exporting the validation metrics.
+func NewHandler(cfg *HandlerConfig, client dapr.Client, single *SingleTarget) (*Handler, error) {
+	if cfg == nil || single == nil {
+		return nil, errors.New("config and single target required")
+	}
+	if err := convert.Configure(cfg.Format); err != nil {
+		return nil, errors.Wrap(err, "invalid format configuration")
+	}
+	c, err := convert.Get(single.Format)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{single: single, converter: c}
+
+	if cfg.MappingFile != "" {
+		if h.mapping, err = convert.LoadMapping(cfg.MappingFile); err != nil {
+			return nil, errors.Wrap(err, "invalid mapping")
+		}
+		if err := convert.CheckMapping(c, h.mapping); err != nil && cfg.TargetsFile == "" {
+			return nil, errors.Wrap(err, "invalid mapping")
+		}
+	}
+	if cfg.TargetsFile != "" {
+		if client == nil {
+			return nil, errors.New("client required for targets")
+		}
+		tc, err := LoadConfig(cfg.TargetsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid targets")
+		}
+		if h.dispatcher, err = NewDispatcher(tc, NewDaprSender(client, cfg.DaprHTTPPort), h.mapping); err != nil {
+			return nil, errors.Wrap(err, "error creating dispatcher")
+		}
+	}
+
+	h.attempts = NewAttemptTracker(cfg.MaxAttempts, time.Hour)
+	if h.deadLetters, err = NewDeadLetterPublisher(cfg.DaprHTTPPort, cfg.DeadLetterPubSub, cfg.DeadLetterTopic); err != nil {
+		return nil, errors.Wrap(err, "invalid dead letter configuration")
+	}
+
+	if !strings.EqualFold(cfg.ValidationMode, convert.ValidationOff) {
+		schema := cfg.SchemaFile
+		if schema == "" && h.mapping != nil {
+			// mapped events have their own shape so they can't be validated using the source event schema
+			if h.mapping.Schema == "" {
+				return nil, errors.New("validation of mapped events requires schema in mapping or schema file")
+			}
+			schema = h.mapping.Schema
+		}
+		if h.validator, err = convert.LoadValidator(schema, cfg.ValidationMode); err != nil {
+			return nil, errors.Wrap(err, "invalid validation configuration")
+		}
+		if h.quarantined, err = NewDeadLetterPublisher(cfg.DaprHTTPPort, cfg.QuarantinePubSub, cfg.QuarantineTopic); err != nil {
+			return nil, errors.Wrap(err, "invalid quarantine configuration")
+		}
+		if cfg.MetricsAddress != "" {
+			go h.serveMetrics(cfg.MetricsAddress)
+		}
+	}
+	return h, nil
+}
+
+// Handle handles single source event
+func (h *Handler) Handle(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
+	d, ok := e.Data.([]byte)
+	if !ok {
+		return h.deadLetter(ctx, e, nil, "", 1, errors.Errorf("invalid event data type: %T", e.Data))
+	}
+
+	if h.validator != nil {
+		if err := h.validator.Validate(d); err != nil {
+			if h.validator.Strict() {
+				return h.quarantine(ctx, e, d, err)
+			}
+			logger.Printf("Invalid event %s (lenient): %v", e.ID, err)
+		}
+	}
+
+	if h.dispatcher != nil {
+		return h.dispatch(ctx, e, d)
+	}
+
+	b, err := convert.ConvertData(h.converter, h.mapping, d)
+	if err != nil {
+		return h.deadLetter(ctx, e, d, "", 1, errors.Wrap(err, "error while converting content"))
+	}
+	logger.Printf("Target (%s): %s", h.single.Format, b)
+
+	n, last := h.attempts.Attempt(e.ID)
+	if err := h.single.Send(ctx, e, b, h.converter.ContentType()); err != nil {
+		if !last {
+			return true, err
+		}
+		h.attempts.Done(e.ID)
+		return h.deadLetter(ctx, e, d, h.single.Name, n, err)
+	}
+	h.attempts.Done(e.ID)
+
+	return false, nil
+}
+
+// dispatch sends the event to all of the configured targets, each one is already retried
+// by the dispatcher so the failed ones are dead-lettered instead of retried here
+// to avoid duplicates in the others. When dead-lettering fails, the event is retried,
+// but only to the targets which weren't already delivered to or dead-lettered for.
+func (h *Handler) dispatch(ctx context.Context, e *common.TopicEvent, data []byte) (retry bool, err error) {
+	results, err := h.dispatcher.Dispatch(ctx, e.ID, data)
+	if results == nil && err != nil {
+		return h.deadLetter(ctx, e, data, "", 1, err)
+	}
+	for _, r := range results {
+		logger.Printf("Target %s - ID:%s, skipped:%v, settled:%v, attempts:%d, duration:%v, error:%v",
+			r.Target, e.ID, r.Skipped, r.Settled, r.Attempts, r.Duration, r.Err)
+		if r.Err == nil {
+			continue
+		}
+		if dlRetry, dlErr := h.deadLetter(ctx, e, data, r.Target, r.Attempts, r.Err); dlRetry {
+			retry, err = true, dlErr
+			continue
+		}
+		h.dispatcher.Settle(e.ID, r.Target)
+	}
+	if !retry {
+		h.dispatcher.Forget(e.ID)
+	}
+	return retry, err
+}
+
+// deadLetter publishes the original event data with the error details onto the dead letter
+// topic, the event is retried only when it can't be dead-lettered so that it's not lost
+func (h *Handler) deadLetter(ctx context.Context, e *common.TopicEvent, data []byte, targetName string, n int, cause error) (retry bool, err error) {
+	dl := &DeadLetter{
+		ID:           e.ID,
+		SourcePubSub: e.PubsubName,
+		SourceTopic:  e.Topic,
+		Target:       targetName,
+		Error:        cause.Error(),
+		Attempts:     n,
+		ContentType:  e.DataContentType,
+		Data:         data,
+	}
+	if h.dispatcher == nil && targetName == h.single.Name && h.single.Destination != nil {
+		dest := *h.single.Destination
+		dest.Format = h.single.Format
+		dl.Destination = &dest
+	}
+	if err := h.deadLetters.Publish(ctx, dl); err != nil {
+		logger.Printf("error dead-lettering event %s: %v", e.ID, err)
+		return true, errors.Wrap(cause, err.Error())
+	}
+	logger.Printf("Dead-lettered event %s (target: %s, attempts: %d): %v", e.ID, targetName, n, cause)
+	return false, cause
+}
+
+// quarantine publishes the event which failed validation with its failure reasons
+// onto the quarantine topic, the event is retried only when it can't be quarantined
+func (h *Handler) quarantine(ctx context.Context, e *common.TopicEvent, data []byte, cause error) (retry bool, err error) {
+	dl := &DeadLetter{
+		ID:           e.ID,
+		SourcePubSub: e.PubsubName,
+		SourceTopic:  e.Topic,
+		Error:        cause.Error(),
+		Attempts:     1,
+		ContentType:  e.DataContentType,
+		Data:         data,
+	}
+	if verr, ok := cause.(*convert.ValidationError); ok {
+		dl.Reasons = verr.Reasons
+	}
+	if err := h.quarantined.Publish(ctx, dl); err != nil {
+		logger.Printf("error quarantining event %s: %v", e.ID, err)
+		return true, errors.Wrap(cause, err.Error())
+	}
+	logger.Printf("Quarantined event %s: %v", e.ID, dl.Reasons)
+	return false, cause
+}
+
+// serveMetrics exports the validation counts on /metrics
+func (h *Handler) serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", h.validator.MetricsHandler)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logger.Printf("metrics server error: %v", err)
+	}
+}
+
+func getEnvVar(key, fallbackValue string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(val)
+	}
+	return fallbackValue
+}
+
+func getEnvIntOrFail(key, fallbackValue string) int {
+	s := getEnvVar(key, fallbackValue)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		logger.Fatalf("invalid number variable: %s - %v", s, err)
+	}
+	return v
+}
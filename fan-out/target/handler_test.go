@@ -0,0 +1,165 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+// daprPublishAPI records the events published using the Dapr HTTP API by topic
+type daprPublishAPI struct {
+	mu     sync.Mutex
+	topics map[string][]*DeadLetter
+	fail   bool
+}
+
+func (a *daprPublishAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.fail {
+		http.Error(w, "pubsub down", http.StatusInternalServerError)
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	var dl DeadLetter
+	json.Unmarshal(b, &dl)
+	topic := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	a.topics[topic] = append(a.topics[topic], &dl)
+}
+
+func (a *daprPublishAPI) published(topic string) []*DeadLetter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.topics[topic]
+}
+
+func testHandler(t *testing.T, mode string, send func(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error) (*Handler, *daprPublishAPI) {
+	t.Helper()
+	api := &daprPublishAPI{topics: map[string][]*DeadLetter{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+
+	cfg := &HandlerConfig{
+		DaprHTTPPort:     u.Port(),
+		Format:           &convert.Config{AvroSchema: convert.AvroSchemaEmbedded},
+		MaxAttempts:      2,
+		DeadLetterPubSub: "p",
+		DeadLetterTopic:  "deadletter",
+		ValidationMode:   mode,
+		QuarantinePubSub: "p",
+		QuarantineTopic:  "quarantine",
+	}
+	h, err := NewHandler(cfg, nil, &SingleTarget{Name: "single", Format: "json", Send: send})
+	if err != nil {
+		t.Fatalf("error creating handler: %v", err)
+	}
+	return h, api
+}
+
+func TestHandlerDeadLettersAfterMaxAttempts(t *testing.T) {
+	var sent int
+	h, api := testHandler(t, convert.ValidationOff, func(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
+		sent++
+		return errors.New("target down")
+	})
+	e := &common.TopicEvent{ID: "d1-1", PubsubName: "p", Topic: "events",
+		Data: []byte(`{"id":"d1-1","temperature":21.5,"humidity":40,"time":1600000000}`)}
+
+	if retry, err := h.Handle(context.Background(), e); !retry || err == nil {
+		t.Fatalf("expected retry on first attempt, got: %v, %v", retry, err)
+	}
+	if retry, err := h.Handle(context.Background(), e); retry || err == nil {
+		t.Fatalf("expected dead letter on last attempt, got: %v, %v", retry, err)
+	}
+	dls := api.published("deadletter")
+	if sent != 2 || len(dls) != 1 {
+		t.Fatalf("expected 2 sends and 1 dead letter, got: %d, %d", sent, len(dls))
+	}
+	if dls[0].ID != "d1-1" || dls[0].Target != "single" || dls[0].Attempts != 2 || dls[0].SourceTopic != "events" {
+		t.Fatalf("unexpected dead letter: %+v", dls[0])
+	}
+}
+
+func TestHandlerRetriesWhenDeadLetteringFails(t *testing.T) {
+	h, api := testHandler(t, convert.ValidationOff, nil)
+	api.fail = true
+	e := &common.TopicEvent{ID: "d1-1", Data: "not bytes"}
+	if retry, err := h.Handle(context.Background(), e); !retry || err == nil {
+		t.Fatalf("expected retry when dead letter can't be published, got: %v, %v", retry, err)
+	}
+}
+
+func TestHandlerQuarantinesInvalidEvents(t *testing.T) {
+	var sent int
+	send := func(ctx context.Context, e *common.TopicEvent, data []byte, contentType string) error {
+		sent++
+		return nil
+	}
+	invalid := []byte(`{"id":"d1-1","temperature":21.5,"humidity":140,"time":1600000000}`)
+
+	h, api := testHandler(t, convert.ValidationStrict, send)
+	if retry, err := h.Handle(context.Background(), &common.TopicEvent{ID: "d1-1", Data: invalid}); retry || err == nil {
+		t.Fatalf("expected invalid event error, got: %v, %v", retry, err)
+	}
+	q := api.published("quarantine")
+	if sent != 0 || len(q) != 1 || len(q[0].Reasons) != 1 || q[0].Reasons[0] != "humidity:number_lte" {
+		t.Fatalf("expected quarantined event with reasons, got sends: %d, quarantined: %+v", sent, q)
+	}
+
+	h, api = testHandler(t, convert.ValidationLenient, send)
+	if retry, err := h.Handle(context.Background(), &common.TopicEvent{ID: "d1-1", Data: invalid}); retry || err != nil {
+		t.Fatalf("expected lenient mode to convert invalid event, got: %v, %v", retry, err)
+	}
+	if sent != 1 || len(api.published("quarantine")) != 0 {
+		t.Fatalf("expected converted event, got sends: %d", sent)
+	}
+}
+
+func TestHandlerValidatesMappedEventsWithMappingSchema(t *testing.T) {
+	dir := t.TempDir()
+	mapping := filepath.Join(dir, "mapping.yaml")
+	if err := ioutil.WriteFile(mapping, []byte("passthrough: true\n"), 0600); err != nil {
+		t.Fatalf("error writing mapping: %v", err)
+	}
+	cfg := &HandlerConfig{
+		Format:           &convert.Config{AvroSchema: convert.AvroSchemaEmbedded},
+		MappingFile:      mapping,
+		MaxAttempts:      1,
+		DeadLetterPubSub: "p",
+		DeadLetterTopic:  "deadletter",
+		ValidationMode:   convert.ValidationStrict,
+		QuarantinePubSub: "p",
+		QuarantineTopic:  "quarantine",
+	}
+	single := &SingleTarget{Name: "single", Format: "json"}
+	if _, err := NewHandler(cfg, nil, single); err == nil || !strings.Contains(err.Error(), "requires schema") {
+		t.Fatalf("expected error for mapping without schema, got: %v", err)
+	}
+
+	schema := `{"type":"object","required":["temp"],"additionalProperties":false,"properties":{"temp":{"type":"number"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "schema.json"), []byte(schema), 0600); err != nil {
+		t.Fatalf("error writing schema: %v", err)
+	}
+	if err := ioutil.WriteFile(mapping, []byte("passthrough: true\nschema: schema.json\n"), 0600); err != nil {
+		t.Fatalf("error writing mapping: %v", err)
+	}
+	h, err := NewHandler(cfg, nil, single)
+	if err != nil {
+		t.Fatalf("error creating handler: %v", err)
+	}
+	if err := h.validator.Validate([]byte(`{"temp":21.5}`)); err != nil {
+		t.Fatalf("expected valid mapped event, got: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/pkg/errors"
+)
+
+// Sender delivers converted content to the target
+type Sender interface {
+	// Send delivers single converted event to the target.
+	Send(ctx context.Context, t *Target, id string, data []byte, contentType string) error
+}
+
+// DaprSender delivers content using Dapr APIs
+type DaprSender struct {
+	client     dapr.Client
+	httpPort   string
+	httpClient *http.Client
+}
+
+// NewDaprSender creates sender using the Dapr client for bindings and services,
+// and the Dapr HTTP API on the httpPort for topics
+func NewDaprSender(client dapr.Client, httpPort string) *DaprSender {
+	return &DaprSender{
+		client:     client,
+		httpPort:   httpPort,
+		httpClient: &http.Client{},
+	}
+}
+
+// Send delivers single converted event to the target
+func (s *DaprSender) Send(ctx context.Context, t *Target, id string, data []byte, contentType string) error {
+	switch t.Kind {
+	case KindTopic:
+		return Publish(ctx, s.httpClient, s.httpPort, t.PubSub, t.Topic, data, contentType)
+	case KindBinding:
+		in := &dapr.BindingInvocation{
+			Name:      t.Binding,
+			Operation: t.Operation,
+			Data:      data,
+			Metadata: map[string]string{
+				"record-id":       id,
+				"conversion-time": time.Now().UTC().Format(time.RFC3339),
+				"Content-Type":    contentType,
+			},
+		}
+		if err := s.client.InvokeOutputBinding(ctx, in); err != nil {
+			return errors.Wrapf(err, "error invoking binding: %s", t.Binding)
+		}
+		return nil
+	case KindService:
+		content := &dapr.DataContent{Data: data, ContentType: contentType}
+		if _, err := s.client.InvokeServiceWithContent(ctx, t.Service, t.Method, content); err != nil {
+			return errors.Wrapf(err, "error invoking service: %s/%s", t.Service, t.Method)
+		}
+		return nil
+	default:
+		return errors.Errorf("invalid target kind: %s", t.Kind)
+	}
+}
+
+// Publish publishes data using the Dapr HTTP API, unlike the SDK client,
+// it sets the content type so the subscribers know how to decode the data
+func Publish(ctx context.Context, c *http.Client, port, pubsub, topic string, data []byte, contentType string) error {
+	url := fmt.Sprintf("http://localhost:%s/v1.0/publish/%s/%s", port, pubsub, topic)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "error creating publish request: %s", url)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "error publishing to %s/%s", pubsub, topic)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("error publishing to %s/%s: %s %s", pubsub, topic, resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package target fans out single source event to multiple targets,
+// each one with its own format, kind, filter, and retry policy.
+package target
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// KindTopic publishes the converted content onto pub/sub topic
+	KindTopic = "topic"
+	// KindBinding invokes output binding with the converted content
+	KindBinding = "binding"
+	// KindService invokes Dapr service with the converted content
+	KindService = "service"
+
+	defaultAttempts  = 3
+	defaultBackoff   = 100 * time.Millisecond
+	defaultTimeout   = 10 * time.Second
+	defaultOperation = "create"
+	// time the settled targets of each event are remembered for its redelivery
+	settledTTL = time.Hour
+)
+
+// Config is the list of targets
+type Config struct {
+	Targets []*Target `yaml:"targets"`
+}
+
+// Target defines single fan-out target
+type Target struct {
+	// Name identifies the target in logs and errors.
+	Name string `yaml:"name"`
+	// Kind is the kind of target: topic, binding, or service.
+	Kind string `yaml:"kind"`
+	// Format is the format of the converted content (see convert.Formats).
+	Format string `yaml:"format"`
+	// PubSub is the name of the pub/sub component of the topic target.
+	PubSub string `yaml:"pubsub"`
+	// Topic is the name of the topic of the topic target.
+	Topic string `yaml:"topic"`
+	// Binding is the name of the output binding of the binding target.
+	Binding string `yaml:"binding"`
+	// Operation is the operation of the binding target, defaults to create.
+	Operation string `yaml:"operation"`
+	// Service is the ID of the service of the service target.
+	Service string `yaml:"service"`
+	// Method is the name of the method of the service target.
+	Method string `yaml:"method"`
+	// Filter lists the conditions the source event must meet to be sent to this target.
+	Filter []*Condition `yaml:"filter"`
+	// Attempts is the max number of delivery attempts, defaults to 3.
+	Attempts int `yaml:"attempts"`
+	// Backoff is the initial delay between attempts, doubled after each one (default: 100ms).
+	Backoff string `yaml:"backoff"`
+	// Timeout is the timeout of each delivery attempt (default: 10s).
+	Timeout string `yaml:"timeout"`
+
+	converter convert.Converter
+	backoff   time.Duration
+	timeout   time.Duration
+}
+
+// LoadConfig loads targets from YAML file
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading targets file: %s", path)
+	}
+	return ParseConfig(b)
+}
+
+// ParseConfig parses and validates YAML targets
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, errors.Wrap(err, "error parsing targets")
+	}
+	if len(c.Targets) == 0 {
+		return nil, errors.New("at least one target required")
+	}
+	names := make(map[string]bool)
+	for i, t := range c.Targets {
+		if t.Name == "" {
+			return nil, errors.Errorf("target %d: name required", i)
+		}
+		if names[t.Name] {
+			return nil, errors.Errorf("target %s: duplicate name", t.Name)
+		}
+		names[t.Name] = true
+		if err := t.init(); err != nil {
+			return nil, errors.Wrapf(err, "target %s", t.Name)
+		}
+	}
+	return &c, nil
+}
+
+// init validates the target and sets its defaults
+func (t *Target) init() error {
+	switch t.Kind {
+	case KindTopic:
+		if t.PubSub == "" || t.Topic == "" {
+			return errors.New("pubsub and topic required")
+		}
+	case KindBinding:
+		if t.Binding == "" {
+			return errors.New("binding required")
+		}
+		if t.Operation == "" {
+			t.Operation = defaultOperation
+		}
+	case KindService:
+		if t.Service == "" || t.Method == "" {
+			return errors.New("service and method required")
+		}
+	default:
+		return errors.Errorf("invalid kind (topic, binding, service): %s", t.Kind)
+	}
+
+	c, err := convert.Get(t.Format)
+	if err != nil {
+		return err
+	}
+	t.converter = c
+
+	for _, f := range t.Filter {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+
+	if t.Attempts < 1 {
+		t.Attempts = defaultAttempts
+	}
+	if t.backoff, err = parseDuration(t.Backoff, defaultBackoff); err != nil {
+		return errors.Wrap(err, "invalid backoff")
+	}
+	if t.timeout, err = parseDuration(t.Timeout, defaultTimeout); err != nil {
+		return errors.Wrap(err, "invalid timeout")
+	}
+	return nil
+}
+
+func parseDuration(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+const (
+	statusFiring   = "firing"
+	statusResolved = "resolved"
+)
+
+// alert is the notification sent when rule starts firing or gets resolved
+type alert struct {
+	Rule        string  `json:"rule"`
+	Key         string  `json:"key"`
+	Status      string  `json:"status"`
+	Severity    string  `json:"severity"`
+	Description string  `json:"description"`
+	Field       string  `json:"field"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	StartedAt   string  `json:"started_at"`
+	ResolvedAt  string  `json:"resolved_at,omitempty"`
+}
+
+// sample is single field value at time
+type sample struct {
+	T time.Time `json:"t"`
+	V float64   `json:"v"`
+}
+
+// stateKey identifies the state of single rule for single key
+type stateKey struct {
+	Rule string `json:"rule"`
+	Key  string `json:"key"`
+}
+
+// ruleState tracks the evaluation of single rule for single key
+type ruleState struct {
+	// Matches and Misses count the consecutive (non)matching readings
+	Matches int `json:"matches"`
+	Misses  int `json:"misses"`
+	// Firing is the evaluated state, Notified is the last state successfully notified
+	Firing    bool      `json:"firing"`
+	Notified  bool      `json:"notified"`
+	StartedAt time.Time `json:"started_at"`
+	// ResolvedAt is set when the firing alert gets resolved
+	ResolvedAt time.Time `json:"resolved_at"`
+	// Last is the latest value and Samples are the values within window in rate rules
+	Last    float64  `json:"last"`
+	Samples []sample `json:"samples,omitempty"`
+}
+
+// savedState is the checkpoint of single rule state
+type savedState struct {
+	stateKey
+	State *ruleState `json:"state"`
+}
+
+// evaluator evaluates rules against the readings of each key, it is not safe for concurrent use
+type evaluator struct {
+	rules  []*rule
+	states map[stateKey]*ruleState
+}
+
+func newEvaluator(cfg *ruleConfig) *evaluator {
+	return &evaluator{rules: cfg.Rules, states: make(map[stateKey]*ruleState)}
+}
+
+// observe evaluates all of the rules against the reading of the key at time t
+func (ev *evaluator) observe(key string, t time.Time, in map[string]interface{}) {
+	for _, r := range ev.rules {
+		v, ok := lookupFloat(in, r.Field)
+		if !ok {
+			continue
+		}
+		id := stateKey{Rule: r.Name, Key: key}
+		s, ok := ev.states[id]
+		if !ok {
+			s = &ruleState{}
+			ev.states[id] = s
+		}
+		s.evaluate(r, t, v)
+	}
+}
+
+func (s *ruleState) evaluate(r *rule, t time.Time, v float64) {
+	s.Last = v
+	at := t
+	match := false
+	switch r.Kind {
+	case kindRate:
+		// samples are kept ordered by their time so that the readings arriving out of order
+		// don't produce spurious changes, the change is the one of the latest sample
+		i := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].T.After(t) })
+		s.Samples = append(s.Samples, sample{})
+		copy(s.Samples[i+1:], s.Samples[i:])
+		s.Samples[i] = sample{T: t, V: v}
+		latest := s.Samples[len(s.Samples)-1]
+		s.Last, at = latest.V, latest.T
+
+		cutoff := latest.T.Add(-r.window)
+		i = 0
+		for i < len(s.Samples)-1 && s.Samples[i].T.Before(cutoff) {
+			i++
+		}
+		s.Samples = s.Samples[i:]
+		if len(s.Samples) > 1 {
+			match = r.compare(latest.V - s.Samples[0].V)
+		}
+	default:
+		match = r.compare(v)
+	}
+
+	if match {
+		s.Matches++
+		s.Misses = 0
+	} else {
+		s.Misses++
+		s.Matches = 0
+	}
+
+	switch {
+	case !s.Firing && s.Matches >= r.For:
+		s.Firing = true
+		s.StartedAt = at
+		s.ResolvedAt = time.Time{}
+	case s.Firing && s.Misses >= r.For:
+		s.Firing = false
+		s.ResolvedAt = at
+	}
+}
+
+// pending returns alerts of the rule states of the key, or of all keys when the key is empty,
+// which changed since their last notification
+func (ev *evaluator) pending(key string) []*alert {
+	var list []*alert
+	for _, r := range ev.rules {
+		for id, s := range ev.states {
+			if id.Rule != r.Name || (key != "" && id.Key != key) || s.Firing == s.Notified {
+				continue
+			}
+			list = append(list, s.alert(r, id.Key))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+func (s *ruleState) alert(r *rule, key string) *alert {
+	a := &alert{
+		Rule:        r.Name,
+		Key:         key,
+		Status:      statusFiring,
+		Severity:    r.Severity,
+		Description: r.String(),
+		Field:       r.Field,
+		Value:       s.Last,
+		Threshold:   r.Value,
+		StartedAt:   s.StartedAt.UTC().Format(time.RFC3339),
+	}
+	if !s.Firing {
+		a.Status = statusResolved
+		a.ResolvedAt = s.ResolvedAt.UTC().Format(time.RFC3339)
+	}
+	return a
+}
+
+// notified marks the alert as successfully notified so it's not sent again
+func (ev *evaluator) notified(a *alert) {
+	if s, ok := ev.states[stateKey{Rule: a.Rule, Key: a.Key}]; ok {
+		s.Notified = a.Status == statusFiring
+	}
+}
+
+// marshal serializes all of the rule states for checkpoint
+func (ev *evaluator) marshal() ([]byte, error) {
+	list := make([]*savedState, 0, len(ev.states))
+	for id, s := range ev.states {
+		list = append(list, &savedState{stateKey: id, State: s})
+	}
+	return json.Marshal(list)
+}
+
+// unmarshal restores the rule states from checkpoint, the states of rules
+// which are no longer configured are dropped
+func (ev *evaluator) unmarshal(b []byte) error {
+	var list []*savedState
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.Wrap(err, "error parsing checkpoint")
+	}
+	names := make(map[string]bool, len(ev.rules))
+	for _, r := range ev.rules {
+		names[r.Name] = true
+	}
+	ev.states = make(map[stateKey]*ruleState, len(list))
+	for _, s := range list {
+		if names[s.Rule] && s.State != nil {
+			ev.states[s.stateKey] = s.State
+		}
+	}
+	return nil
+}
+
+// lookupFloat returns numeric value from nested maps using dot separated path
+func lookupFloat(in map[string]interface{}, path string) (float64, bool) {
+	v, ok := convert.Lookup(in, path)
+	if !ok {
+		return 0, false
+	}
+	n, ok := v.(float64)
+	return n, ok
+}
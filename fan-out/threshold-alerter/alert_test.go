@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testEvaluator(t *testing.T) *evaluator {
+	t.Helper()
+	cfg, err := parseRules([]byte(`
+rules:
+- name: temperature-high
+  field: temperature
+  op: gt
+  value: 80
+  for: 2
+  severity: critical
+- name: temperature-rising
+  kind: rate
+  field: temperature
+  op: gt
+  value: 10
+  window: 5m
+`))
+	if err != nil {
+		t.Fatalf("invalid rules: %v", err)
+	}
+	return newEvaluator(cfg)
+}
+
+func reading(v float64) map[string]interface{} {
+	return map[string]interface{}{"temperature": v}
+}
+
+func TestThresholdFiresAndResolvesAfterConsecutiveReadings(t *testing.T) {
+	ev := testEvaluator(t)
+	ts := time.Unix(1600000000, 0)
+	steps := []struct {
+		v      float64
+		status string
+	}{
+		{85, ""},
+		{75, ""}, // single match is not enough to fire
+		{85, ""},
+		{86, statusFiring},
+		{87, ""}, // already notified
+		{70, ""},
+		{85, ""}, // single miss is not enough to resolve
+		{70, ""},
+		{70, statusResolved},
+	}
+	for i, step := range steps {
+		ts = ts.Add(time.Hour) // outside of the rate window
+		ev.observe("kitchen", ts, reading(step.v))
+		list := ev.pending("kitchen")
+		if step.status == "" {
+			if len(list) != 0 {
+				t.Fatalf("step %d: expected no alerts, got: %s", i, list[0].Status)
+			}
+			continue
+		}
+		if len(list) != 1 || list[0].Status != step.status || list[0].Rule != "temperature-high" || list[0].Value != step.v {
+			t.Fatalf("step %d: expected %s alert, got: %+v", i, step.status, list)
+		}
+		ev.notified(list[0])
+	}
+}
+
+func TestRateRuleComparesChangeWithinWindow(t *testing.T) {
+	ev := testEvaluator(t)
+	ts := time.Unix(1600000000, 0)
+	ev.observe("kitchen", ts, reading(60))
+	ev.observe("kitchen", ts.Add(10*time.Minute), reading(72)) // previous reading outside of window
+	if list := ev.pending("kitchen"); len(list) != 0 {
+		t.Fatalf("expected no alerts, got: %+v", list[0])
+	}
+	ev.observe("kitchen", ts.Add(12*time.Minute), reading(83))
+	list := ev.pending("kitchen")
+	if len(list) != 1 || list[0].Rule != "temperature-rising" {
+		t.Fatalf("expected rate alert, got: %+v", list)
+	}
+}
+
+func TestRateRuleOrdersSamplesByTime(t *testing.T) {
+	ev := testEvaluator(t)
+	ts := time.Unix(1600000000, 0)
+	ev.observe("kitchen", ts.Add(time.Minute), reading(60))
+	// earlier reading arrives late, in arrival order it would be a rise of 12
+	ev.observe("kitchen", ts, reading(72))
+	if list := ev.pending("kitchen"); len(list) != 0 {
+		t.Fatalf("expected no alerts for out of order reading, got: %+v", list[0])
+	}
+	s := ev.states[stateKey{Rule: "temperature-rising", Key: "kitchen"}]
+	if len(s.Samples) != 2 || s.Samples[0].V != 72 || s.Samples[1].V != 60 || s.Last != 60 {
+		t.Fatalf("expected samples ordered by time, got: %+v", s.Samples)
+	}
+
+	ev.observe("kitchen", ts.Add(3*time.Minute), reading(83))
+	list := ev.pending("kitchen")
+	if len(list) != 1 || list[0].Rule != "temperature-rising" || list[0].StartedAt != "2020-09-13T12:29:40Z" {
+		t.Fatalf("expected rate alert, got: %+v", list)
+	}
+}
+
+func TestUnsentAlertsStayPendingForAllKeys(t *testing.T) {
+	ev := testEvaluator(t)
+	ts := time.Unix(1600000000, 0)
+	for _, key := range []string{"kitchen", "bedroom"} {
+		ev.observe(key, ts, reading(85))
+		ev.observe(key, ts.Add(time.Hour), reading(85))
+	}
+	if len(ev.pending("kitchen")) != 1 {
+		t.Fatal("expected single pending alert of key")
+	}
+	list := ev.pending("")
+	if len(list) != 2 || list[0].Key != "bedroom" || list[1].Key != "kitchen" {
+		t.Fatalf("expected pending alerts of all keys, got: %+v", list)
+	}
+	ev.notified(list[0])
+	if list := ev.pending(""); len(list) != 1 || list[0].Key != "kitchen" {
+		t.Fatalf("expected only unsent alert pending, got: %+v", list)
+	}
+}
+
+func TestRuleStatesCheckpointRoundTrip(t *testing.T) {
+	ev := testEvaluator(t)
+	ts := time.Unix(1600000000, 0)
+	ev.observe("kitchen", ts, reading(85))
+	ev.observe("kitchen", ts.Add(time.Minute), reading(86))
+	ev.notified(ev.pending("kitchen")[0])
+
+	b, err := ev.marshal()
+	if err != nil {
+		t.Fatalf("error serializing states: %v", err)
+	}
+	restored := testEvaluator(t)
+	if err := restored.unmarshal(b); err != nil {
+		t.Fatalf("error restoring states: %v", err)
+	}
+
+	// the restored alert is still firing and notified, and keeps the rate samples
+	restored.observe("kitchen", ts.Add(2*time.Minute), reading(97))
+	list := restored.pending("kitchen")
+	if len(list) != 1 || list[0].Rule != "temperature-rising" {
+		t.Fatalf("expected only rate alert, got: %+v", list)
+	}
+	restored.notified(list[0])
+	restored.observe("kitchen", ts.Add(3*time.Minute), reading(70))
+	restored.observe("kitchen", ts.Add(4*time.Minute), reading(70))
+	list = restored.pending("kitchen")
+	if len(list) != 2 || list[0].Status != statusResolved || list[0].StartedAt != "2020-09-13T12:27:40Z" {
+		t.Fatalf("expected restored alert to resolve, got: %+v", list)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// checkpointer tracks the changes of the rule states and their checkpoints so that
+// the states are saved only when they changed, and each reading is acknowledged
+// only once the checkpoint which includes it is saved
+type checkpointer struct {
+	mu     sync.Mutex
+	gen    int64
+	saved  int64
+	notify chan struct{}
+}
+
+func newCheckpointer() *checkpointer {
+	return &checkpointer{notify: make(chan struct{})}
+}
+
+// change records the change of the rule states and returns its generation,
+// must be called under the same lock as the change itself
+func (c *checkpointer) change() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	return c.gen
+}
+
+// pending returns the generation of the last change and whether it's not saved yet
+func (c *checkpointer) pending() (gen int64, dirty bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen, c.gen > c.saved
+}
+
+// done records the checkpoint of all of the changes up to the generation
+// and releases the readings waiting for it
+func (c *checkpointer) done(gen int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen <= c.saved {
+		return
+	}
+	c.saved = gen
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// wait blocks until the change of the generation is saved or the context is done
+func (c *checkpointer) wait(ctx context.Context, gen int64) error {
+	for {
+		c.mu.Lock()
+		if c.saved >= gen {
+			c.mu.Unlock()
+			return nil
+		}
+		ch := c.notify
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
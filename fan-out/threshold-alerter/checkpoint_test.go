@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckpointerReleasesReadingsOnceSaved(t *testing.T) {
+	c := newCheckpointer()
+	if _, dirty := c.pending(); dirty {
+		t.Fatal("expected no pending changes")
+	}
+	g1 := c.change()
+	g2 := c.change()
+	gen, dirty := c.pending()
+	if !dirty || gen != g2 {
+		t.Fatalf("expected pending generation %d, got: %d, %v", g2, gen, dirty)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.wait(ctx, g1); err == nil {
+		t.Fatal("expected wait to time out before checkpoint")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.wait(context.Background(), g2)
+	}()
+	c.done(g1)
+	select {
+	case <-done:
+		t.Fatal("expected wait for later change to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.done(g2)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected wait error: %v", err)
+	}
+	if _, dirty := c.pending(); dirty {
+		t.Fatal("expected no pending changes after checkpoint")
+	}
+}
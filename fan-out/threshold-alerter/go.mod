@@ -0,0 +1,12 @@
+module github.com/mchmarny/dapr-demos/fan-out/threshold-alerter
+
+go 1.15
+
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/mchmarny/dapr-demos/fan-out/convert v0.0.0
+	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v2 v2.3.0
+)
+
+replace github.com/mchmarny/dapr-demos/fan-out/convert => ../convert
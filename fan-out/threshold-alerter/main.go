@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/pkg/errors"
+)
+
+const (
+	// key used for all readings when no group by field is configured
+	defaultGroupKey = "all"
+)
+
+var (
+	logger = log.New(os.Stdout, "", 0)
+	client dapr.Client
+
+	serviceAddress = getEnvVar("ADDRESS", ":60018")
+
+	sourcePubSubName = getEnvVar("SOURCE_PUBSUB_NAME", "fanout-source-pubsub")
+	sourceTopicName  = getEnvVar("SOURCE_TOPIC_NAME", "events")
+
+	alertBindingName   = getEnvVar("ALERT_BINDING", "fanout-alert-binding")
+	alertOperation     = getEnvVar("ALERT_OPERATION", "create")
+	alertMetadata      = getEnvVar("ALERT_METADATA", "")
+	alertSubjectPrefix = getEnvVar("ALERT_SUBJECT_PREFIX", "Room Alert")
+
+	rulesFile = getEnvVar("RULES_FILE", "rules.yaml")
+	// dot separated path of the input field to group readings by (e.g. room or sensor.id)
+	groupBy = getEnvVar("GROUP_BY", "")
+	// how often are the alerts which failed to send retried
+	retryInterval = getEnvDurationOrFail("RETRY_INTERVAL", "10s")
+
+	stateStoreName = getEnvVar("STATE_STORE_NAME", "fanout-alerter-store")
+	stateStoreKey  = getEnvVar("STATE_KEY", "rules")
+	// how often are the changed rule states checkpointed
+	checkpointInterval = getEnvDurationOrFail("CHECKPOINT_INTERVAL", "1s")
+
+	// mu guards the rule states
+	mu         sync.Mutex
+	rules      *evaluator
+	staticMeta map[string]string
+	// checkpointMu orders the checkpoints so that older one never overwrites newer one
+	checkpointMu sync.Mutex
+	checkpoints  = newCheckpointer()
+	// sendMu serializes the notifications so that each alert is sent only once
+	sendMu sync.Mutex
+)
+
+func main() {
+	cfg, err := loadRules(rulesFile)
+	if err != nil {
+		log.Fatalf("invalid rules: %v", err)
+	}
+	rules = newEvaluator(cfg)
+
+	if staticMeta, err = parseMetadata(alertMetadata); err != nil {
+		log.Fatalf("invalid alert metadata: %v", err)
+	}
+
+	// create Dapr service
+	s, err := daprd.NewService(serviceAddress)
+	if err != nil {
+		log.Fatalf("failed to start the server: %v", err)
+	}
+
+	c, err := dapr.NewClient()
+	if err != nil {
+		log.Fatalf("failed to create Dapr client: %v", err)
+	}
+	client = c
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := restore(ctx); err != nil {
+		log.Fatalf("error restoring rule states: %v", err)
+	}
+
+	// add handler to the service
+	sub := &common.Subscription{PubsubName: sourcePubSubName, Topic: sourceTopicName}
+	s.AddTopicEventHandler(sub, eventHandler)
+
+	go retryAlerts(ctx)
+	go checkpointStates(ctx)
+
+	// start the server to handle incoming events
+	if err := s.Start(); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
+
+func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
+	d, ok := e.Data.([]byte)
+	if !ok {
+		return false, errors.Errorf("invalid event data type: %T", e.Data)
+	}
+
+	var in map[string]interface{}
+	if err := json.Unmarshal(d, &in); err != nil {
+		return false, errors.Wrap(err, "error parsing input content")
+	}
+	key, err := groupKey(in)
+	if err != nil {
+		return false, err
+	}
+
+	t := time.Now()
+	if ts, ok := lookupFloat(in, "time"); ok && ts > 0 {
+		t = time.Unix(int64(ts), 0)
+	}
+
+	mu.Lock()
+	rules.observe(key, t, in)
+	gen := checkpoints.change()
+	mu.Unlock()
+
+	// alerts which fail to send stay pending and are retried periodically,
+	// the event itself is not retried for them so that it's not counted twice in the rule states
+	notifyErr := notify(ctx, key)
+
+	// the reading is acknowledged only after the next checkpoint saves it, along with the alerts
+	// notified for it, so it survives restarts, when that doesn't happen before the delivery
+	// times out, the redelivered reading is counted twice
+	gen, _ = checkpoints.pending()
+	if err := checkpoints.wait(ctx, gen); err != nil {
+		return true, errors.Wrapf(err, "error waiting for checkpoint of %s", e.ID)
+	}
+	return false, notifyErr
+}
+
+// notify sends the pending alerts of the key, or of all keys when the key is empty,
+// and returns the last send error
+func notify(ctx context.Context, key string) error {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+
+	mu.Lock()
+	list := rules.pending(key)
+	mu.Unlock()
+
+	var lastErr error
+	for _, a := range list {
+		if err := send(ctx, a); err != nil {
+			logger.Printf("error sending alert %s/%s: %v", a.Rule, a.Key, err)
+			lastErr = err
+			continue
+		}
+		mu.Lock()
+		rules.notified(a)
+		checkpoints.change()
+		mu.Unlock()
+		logger.Printf("Alert %s - rule:%s, key:%s, value:%v", a.Status, a.Rule, a.Key, a.Value)
+	}
+	return lastErr
+}
+
+// retryAlerts periodically sends the alerts of all keys which failed to send,
+// so they don't wait for the next reading of their key
+func retryAlerts(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := notify(ctx, ""); err != nil {
+				logger.Printf("error retrying alerts: %v", err)
+			}
+		}
+	}
+}
+
+// checkpointStates periodically saves the rule states when they changed,
+// states which fail to save are retried on the next interval
+func checkpointStates(ctx context.Context) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := checkpoint(ctx); err != nil {
+				logger.Printf("error checkpointing rule states: %v", err)
+			}
+		}
+	}
+}
+
+// checkpoint saves all of the rule states into state store when they changed since the last checkpoint,
+// the states are serialized under lock but saved outside of it so the readings are not blocked
+func checkpoint(ctx context.Context) error {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+
+	mu.Lock()
+	gen, dirty := checkpoints.pending()
+	if !dirty {
+		mu.Unlock()
+		return nil
+	}
+	b, err := rules.marshal()
+	mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "error serializing rule states")
+	}
+
+	if err := client.SaveState(ctx, stateStoreName, stateStoreKey, b); err != nil {
+		return errors.Wrapf(err, "error saving %s to %s", stateStoreKey, stateStoreName)
+	}
+	checkpoints.done(gen)
+	return nil
+}
+
+// restore loads the rule states from the last checkpoint
+func restore(ctx context.Context) error {
+	item, err := client.GetState(ctx, stateStoreName, stateStoreKey)
+	if err != nil {
+		return errors.Wrapf(err, "error getting %s from %s", stateStoreKey, stateStoreName)
+	}
+	if item == nil || len(item.Value) == 0 {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := rules.unmarshal(item.Value); err != nil {
+		return err
+	}
+	logger.Printf("Restored %d rule states", len(rules.states))
+	return nil
+}
+
+// send invokes the alert binding with the alert as JSON, the subject metadata
+// is used by the email bindings and ignored by the others
+func send(ctx context.Context, a *alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "error serializing alert")
+	}
+	meta := make(map[string]string, len(staticMeta)+1)
+	for k, v := range staticMeta {
+		meta[k] = v
+	}
+	meta["subject"] = fmt.Sprintf("%s [%s] %s: %s (%s)",
+		alertSubjectPrefix, strings.ToUpper(a.Status), a.Rule, a.Key, a.Description)
+
+	in := &dapr.BindingInvocation{
+		Name:      alertBindingName,
+		Operation: alertOperation,
+		Data:      b,
+		Metadata:  meta,
+	}
+	if err := client.InvokeOutputBinding(ctx, in); err != nil {
+		return errors.Wrapf(err, "error invoking binding: %s", alertBindingName)
+	}
+	return nil
+}
+
+// groupKey returns the value of the group by field of the input content
+func groupKey(in map[string]interface{}) (string, error) {
+	if groupBy == "" {
+		return defaultGroupKey, nil
+	}
+	v, ok := convert.Lookup(in, groupBy)
+	if !ok {
+		return "", errors.Errorf("missing group by field: %s", groupBy)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// parseMetadata parses comma separated list of key=value pairs (e.g. emailTo=ops@thingz.io)
+func parseMetadata(s string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.Errorf("invalid metadata, expected key=value: %s", p)
+		}
+		meta[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return meta, nil
+}
+
+func getEnvVar(key, fallbackValue string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(val)
+	}
+	return fallbackValue
+}
+
+func getEnvDurationOrFail(key, fallbackValue string) time.Duration {
+	s := getEnvVar(key, fallbackValue)
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Fatalf("invalid duration variable: %s - %v", s, err)
+	}
+	return d
+}
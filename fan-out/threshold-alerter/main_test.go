@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+)
+
+// fakeClient records the saved states and sent alerts, other client methods are not implemented
+type fakeClient struct {
+	dapr.Client
+	mu     sync.Mutex
+	saved  []byte
+	alerts int
+}
+
+func (c *fakeClient) SaveState(ctx context.Context, store, key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saved = data
+	return nil
+}
+
+func (c *fakeClient) InvokeOutputBinding(ctx context.Context, in *dapr.BindingInvocation) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.alerts++
+	return nil
+}
+
+func TestReadingIsAcknowledgedOnlyAfterCheckpoint(t *testing.T) {
+	c := &fakeClient{}
+	rules, client = testEvaluator(t), c
+	defer func() {
+		rules, client = nil, nil
+	}()
+	e := &common.TopicEvent{ID: "1", Data: []byte(`{"temperature":85,"time":1600000000}`)}
+
+	// without checkpoint, the reading is returned for redelivery
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if retry, err := eventHandler(ctx, e); !retry || err == nil {
+		t.Fatalf("expected retry before checkpoint, got: %v, %v", retry, err)
+	}
+
+	// the next reading fires the alert, and waits for the checkpoint which includes it
+	done := make(chan bool, 1)
+	go func() {
+		retry, _ := eventHandler(context.Background(), &common.TopicEvent{ID: "2", Data: []byte(`{"temperature":86,"time":1600000060}`)})
+		done <- retry
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected reading to wait for checkpoint")
+	case <-time.After(20 * time.Millisecond):
+	}
+	for acked := false; !acked; {
+		if err := checkpoint(context.Background()); err != nil {
+			t.Fatalf("error checkpointing: %v", err)
+		}
+		select {
+		case retry := <-done:
+			if retry {
+				t.Fatal("expected checkpointed reading to be acknowledged")
+			}
+			acked = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// the restored states keep the notified alert so it's not sent again
+	restored := testEvaluator(t)
+	if err := restored.unmarshal(c.saved); err != nil {
+		t.Fatalf("error restoring states: %v", err)
+	}
+	if list := restored.pending(""); len(list) != 0 || c.alerts != 1 {
+		t.Fatalf("expected single alert sent and notified, got: %d sent, %+v pending", c.alerts, list)
+	}
+}
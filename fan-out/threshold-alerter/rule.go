@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// kindThreshold compares the field value to the rule value
+	kindThreshold = "threshold"
+	// kindRate compares the change of the field value over the rule window to the rule value
+	kindRate = "rate"
+
+	opGreater      = "gt"
+	opGreaterEqual = "gte"
+	opLess         = "lt"
+	opLessEqual    = "lte"
+
+	defaultSeverity = "warning"
+)
+
+// ruleConfig is the list of alerting rules
+type ruleConfig struct {
+	Rules []*rule `yaml:"rules"`
+}
+
+// rule defines single alerting rule
+type rule struct {
+	// Name identifies the rule in alerts.
+	Name string `yaml:"name"`
+	// Kind is the kind of rule: threshold (default) or rate.
+	Kind string `yaml:"kind"`
+	// Field is the dot separated path of the numeric input field (e.g. temperature).
+	Field string `yaml:"field"`
+	// Op is the comparison operator: gt, gte, lt, or lte.
+	Op string `yaml:"op"`
+	// Value is the threshold, or the change over Window in rate rules.
+	Value float64 `yaml:"value"`
+	// For is the number of consecutive (non)matching readings to fire (resolve) the alert, defaults to 1.
+	For int `yaml:"for"`
+	// Window is the period over which the change is calculated in rate rules (e.g. 5m).
+	Window string `yaml:"window"`
+	// Severity is passed on in alerts, defaults to warning.
+	Severity string `yaml:"severity"`
+
+	window time.Duration
+}
+
+// loadRules loads rules from YAML file
+func loadRules(path string) (*ruleConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading rules file: %s", path)
+	}
+	return parseRules(b)
+}
+
+// parseRules parses and validates YAML rules
+func parseRules(b []byte) (*ruleConfig, error) {
+	var c ruleConfig
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, errors.Wrap(err, "error parsing rules")
+	}
+	if len(c.Rules) == 0 {
+		return nil, errors.New("at least one rule required")
+	}
+	names := make(map[string]bool, len(c.Rules))
+	for i, r := range c.Rules {
+		if err := r.init(); err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+		if names[r.Name] {
+			return nil, errors.Errorf("duplicate rule name: %s", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return &c, nil
+}
+
+// init validates the rule and sets its defaults
+func (r *rule) init() error {
+	if r.Name == "" {
+		return errors.New("name required")
+	}
+	if r.Field == "" {
+		return errors.Errorf("%s: field required", r.Name)
+	}
+	switch r.Op {
+	case opGreater, opGreaterEqual, opLess, opLessEqual:
+	default:
+		return errors.Errorf("%s: invalid operator (gt, gte, lt, lte): %s", r.Name, r.Op)
+	}
+	if r.For == 0 {
+		r.For = 1
+	}
+	if r.For < 0 {
+		return errors.Errorf("%s: invalid for: %d", r.Name, r.For)
+	}
+	if r.Severity == "" {
+		r.Severity = defaultSeverity
+	}
+
+	switch r.Kind {
+	case "", kindThreshold:
+		r.Kind = kindThreshold
+		if r.Window != "" {
+			return errors.Errorf("%s: window is only valid in rate rules", r.Name)
+		}
+	case kindRate:
+		d, err := time.ParseDuration(r.Window)
+		if err != nil || d <= 0 {
+			return errors.Errorf("%s: invalid window: %s", r.Name, r.Window)
+		}
+		r.window = d
+	default:
+		return errors.Errorf("%s: invalid kind (threshold, rate): %s", r.Name, r.Kind)
+	}
+	return nil
+}
+
+// compare checks the value against the rule value using the rule operator
+func (r *rule) compare(v float64) bool {
+	switch r.Op {
+	case opGreater:
+		return v > r.Value
+	case opGreaterEqual:
+		return v >= r.Value
+	case opLess:
+		return v < r.Value
+	case opLessEqual:
+		return v <= r.Value
+	default:
+		return false
+	}
+}
+
+// String describes the rule condition (e.g. temperature gt 80 for 3 readings)
+func (r *rule) String() string {
+	s := fmt.Sprintf("%s %s %v", r.Field, r.Op, r.Value)
+	if r.Kind == kindRate {
+		s = fmt.Sprintf("change of %s over %v %s %v", r.Field, r.window, r.Op, r.Value)
+	}
+	if r.For > 1 {
+		s = fmt.Sprintf("%s for %d readings", s, r.For)
+	}
+	return s
+}
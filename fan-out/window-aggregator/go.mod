@@ -0,0 +1,14 @@
+module github.com/mchmarny/dapr-demos/fan-out/window-aggregator
+
+go 1.15
+
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/mchmarny/dapr-demos/fan-out/convert v0.0.0
+	github.com/mchmarny/dapr-demos/fan-out/target v0.0.0
+	github.com/pkg/errors v0.9.1
+)
+
+replace github.com/mchmarny/dapr-demos/fan-out/convert => ../convert
+
+replace github.com/mchmarny/dapr-demos/fan-out/target => ../target
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/dapr/go-sdk/service/common"
+	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/fan-out/convert"
+	"github.com/mchmarny/dapr-demos/fan-out/target"
+	"github.com/pkg/errors"
+)
+
+const (
+	// key used for all readings when no group by field is configured
+	defaultGroupKey = "all"
+)
+
+var (
+	logger = log.New(os.Stdout, "", 0)
+	client dapr.Client
+
+	serviceAddress = getEnvVar("ADDRESS", ":60017")
+	daprHTTPPort   = getEnvVar("DAPR_HTTP_PORT", "3500")
+	httpClient     = &http.Client{Timeout: 10 * time.Second}
+
+	sourcePubSubName = getEnvVar("SOURCE_PUBSUB_NAME", "fanout-source-pubsub")
+	sourceTopicName  = getEnvVar("SOURCE_TOPIC_NAME", "events")
+
+	targetPubSubName = getEnvVar("TARGET_PUBSUB_NAME", "fanout-target-pubsub")
+	targetTopicName  = getEnvVar("TARGET_TOPIC_NAME", "aggregates")
+
+	stateStoreName = getEnvVar("STATE_STORE_NAME", "fanout-aggregator-store")
+	stateKey       = getEnvVar("STATE_KEY", "windows")
+
+	// dot separated path of the input field to group readings by (e.g. room or sensor.id)
+	groupBy         = getEnvVar("GROUP_BY", "")
+	windowSize      = getEnvDurationOrFail("WINDOW_SIZE", "1m")
+	windowSlide     = getEnvDurationOrFail("WINDOW_SLIDE", "0s")
+	allowedLateness = getEnvDurationOrFail("ALLOWED_LATENESS", "0s")
+	closeInterval   = getEnvDurationOrFail("CLOSE_INTERVAL", "1s")
+	// how often are the changed windows checkpointed
+	checkpointInterval = getEnvDurationOrFail("CHECKPOINT_INTERVAL", "500ms")
+
+	// mu guards the windows
+	mu   sync.Mutex
+	open *windows
+	// checkpointMu orders the checkpoints so that older one never overwrites newer one
+	checkpointMu sync.Mutex
+	checkpoints  = newCheckpointer()
+)
+
+func main() {
+	w, err := newWindows(windowSize, windowSlide, allowedLateness)
+	if err != nil {
+		log.Fatalf("invalid window configuration: %v", err)
+	}
+	open = w
+
+	// create Dapr service
+	s, err := daprd.NewService(serviceAddress)
+	if err != nil {
+		log.Fatalf("failed to start the server: %v", err)
+	}
+
+	c, err := dapr.NewClient()
+	if err != nil {
+		log.Fatalf("failed to create Dapr client: %v", err)
+	}
+	client = c
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := restore(ctx); err != nil {
+		log.Fatalf("error restoring windows: %v", err)
+	}
+
+	// add handler to the service
+	sub := &common.Subscription{PubsubName: sourcePubSubName, Topic: sourceTopicName}
+	s.AddTopicEventHandler(sub, eventHandler)
+
+	// readings are acknowledged only after they are checkpointed so no need to flush them on shutdown
+	go checkpointWindows(ctx)
+	go closeWindows(ctx)
+
+	// start the server to handle incoming events
+	if err := s.Start(); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
+
+func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
+	d, ok := e.Data.([]byte)
+	if !ok {
+		return false, errors.Errorf("invalid event data type: %T", e.Data)
+	}
+
+	r, err := convert.Parse(d)
+	if err != nil {
+		return false, err
+	}
+	key, err := groupKey(d)
+	if err != nil {
+		return false, err
+	}
+
+	t, n, gen := addReading(key, r.Time, r.Temperature, r.Humidity)
+	if n == 0 {
+		logger.Printf("Late - ID:%s, key:%s, time:%s", e.ID, key, t.UTC().Format(time.RFC3339))
+		return false, nil
+	}
+
+	// the reading is acknowledged only after the next checkpoint saves it so it survives restarts,
+	// when that doesn't happen before the delivery times out, the redelivered reading is counted twice
+	if err := checkpoints.wait(ctx, gen); err != nil {
+		return true, errors.Wrapf(err, "error waiting for checkpoint of %s", e.ID)
+	}
+	return false, nil
+}
+
+// addReading adds the reading taken at ts (unix seconds, now when 0) into its windows and
+// returns its time, the number of windows updated, and the checkpoint generation of the change.
+// The current time is read under the lock so that it's never older than the one of publishDue.
+func addReading(key string, ts int64, temperature, humidity float64) (t time.Time, n int, gen int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	t = now
+	if ts > 0 {
+		t = time.Unix(ts, 0)
+	}
+	if n = open.add(key, t, now, temperature, humidity); n > 0 {
+		gen = checkpoints.change()
+	}
+	return t, n, gen
+}
+
+// groupKey returns the value of the group by field of the input content
+func groupKey(data []byte) (string, error) {
+	if groupBy == "" {
+		return defaultGroupKey, nil
+	}
+	var in map[string]interface{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return "", errors.Wrap(err, "error parsing input content")
+	}
+	v, ok := convert.Lookup(in, groupBy)
+	if !ok {
+		return "", errors.Errorf("missing group by field: %s", groupBy)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// checkpointWindows periodically saves the open windows when they changed,
+// windows which fail to save are retried on the next interval
+func checkpointWindows(ctx context.Context) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := checkpoint(ctx); err != nil {
+				logger.Printf("error checkpointing windows: %v", err)
+			}
+		}
+	}
+}
+
+// closeWindows periodically publishes aggregates of the closed windows,
+// windows which fail to publish are kept open and retried on the next interval
+func closeWindows(ctx context.Context) {
+	ticker := time.NewTicker(closeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := publishDue(ctx); err != nil {
+				logger.Printf("error closing windows: %v", err)
+			}
+		}
+	}
+}
+
+// publishDue publishes the due windows one by one, each one is removed and checkpointed
+// right after it's published so that it's not published again after restart
+func publishDue(ctx context.Context) error {
+	mu.Lock()
+	list := open.due(time.Now())
+	mu.Unlock()
+
+	for _, w := range list {
+		// due windows never accept readings again (see windows.due) so they can be read without lock
+		b, err := json.Marshal(w.aggregate())
+		if err != nil {
+			return errors.Wrapf(err, "error serializing window: %s", w.id())
+		}
+		if err := target.Publish(ctx, httpClient, daprHTTPPort, targetPubSubName, targetTopicName, b, "application/json"); err != nil {
+			return errors.Wrapf(err, "error publishing window: %s", w.id())
+		}
+		logger.Printf("Window %s: %s", w.id(), b)
+
+		mu.Lock()
+		open.remove(w)
+		checkpoints.change()
+		mu.Unlock()
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpoint saves all of the open windows into state store when they changed since the last checkpoint,
+// the windows are serialized under lock but saved outside of it so the readings are not blocked
+func checkpoint(ctx context.Context) error {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+
+	mu.Lock()
+	gen, dirty := checkpoints.pending()
+	if !dirty {
+		mu.Unlock()
+		return nil
+	}
+	b, err := open.marshal()
+	mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "error serializing windows")
+	}
+
+	if err := client.SaveState(ctx, stateStoreName, stateKey, b); err != nil {
+		return errors.Wrapf(err, "error saving %s to %s", stateKey, stateStoreName)
+	}
+	checkpoints.done(gen)
+	return nil
+}
+
+// restore loads the open windows from the last checkpoint
+func restore(ctx context.Context) error {
+	item, err := client.GetState(ctx, stateStoreName, stateKey)
+	if err != nil {
+		return errors.Wrapf(err, "error getting %s from %s", stateKey, stateStoreName)
+	}
+	if item == nil || len(item.Value) == 0 {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := open.unmarshal(item.Value); err != nil {
+		return err
+	}
+	logger.Printf("Restored %d open windows", len(open.open))
+	return nil
+}
+
+func getEnvVar(key, fallbackValue string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(val)
+	}
+	return fallbackValue
+}
+
+func getEnvDurationOrFail(key, fallbackValue string) time.Duration {
+	s := getEnvVar(key, fallbackValue)
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Fatalf("invalid duration variable: %s - %v", s, err)
+	}
+	return d
+}
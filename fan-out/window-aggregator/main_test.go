@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+)
+
+// noopStateClient accepts all checkpoints, other client methods are not implemented
+type noopStateClient struct {
+	dapr.Client
+}
+
+func (c *noopStateClient) SaveState(ctx context.Context, store, key string, data []byte) error {
+	return nil
+}
+
+// aggregateAPI records the aggregates published using the Dapr HTTP API
+type aggregateAPI struct {
+	mu   sync.Mutex
+	list []*aggregate
+}
+
+func (a *aggregateAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var agg aggregate
+	if err := json.NewDecoder(r.Body).Decode(&agg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.list = append(a.list, &agg)
+}
+
+func TestReadingsAddedWhilePublishingAreNeitherLostNorDuplicated(t *testing.T) {
+	api := &aggregateAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ws, err := newWindows(time.Second, 0, 0)
+	if err != nil {
+		t.Fatalf("error creating windows: %v", err)
+	}
+	open, client, daprHTTPPort = ws, &noopStateClient{}, u.Port()
+	defer func() {
+		open, client, daprHTTPPort = nil, nil, "3500"
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	var added int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if _, n, _ := addReading(defaultGroupKey, 0, 20, 40); n > 0 {
+					atomic.AddInt64(&added, 1)
+				}
+			}
+		}()
+	}
+	for ctx.Err() == nil {
+		if err := publishDue(context.Background()); err != nil {
+			t.Fatalf("error publishing windows: %v", err)
+		}
+	}
+	wg.Wait()
+
+	// publish the remaining windows
+	time.Sleep(time.Second)
+	if err := publishDue(context.Background()); err != nil {
+		t.Fatalf("error publishing windows: %v", err)
+	}
+
+	var published int64
+	seen := map[string]bool{}
+	for _, a := range api.list {
+		if seen[a.WindowStart] {
+			t.Fatalf("window %s published twice", a.WindowStart)
+		}
+		seen[a.WindowStart] = true
+		published += a.Count
+	}
+	if published != added || len(open.open) != 0 {
+		t.Fatalf("expected all %d readings published, got: %d (%d windows open)", added, published, len(open.open))
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// stats accumulates single measurement in a window
+type stats struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+}
+
+func (s *stats) add(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+func (s *stats) summary() *summary {
+	if s.Count == 0 {
+		return &summary{}
+	}
+	return &summary{Min: s.Min, Max: s.Max, Mean: round(s.Sum / float64(s.Count))}
+}
+
+// window holds the accumulated readings of single key in single time window
+type window struct {
+	Key         string `json:"key"`
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	Count       int64  `json:"count"`
+	Temperature stats  `json:"temperature"`
+	Humidity    stats  `json:"humidity"`
+}
+
+func (w *window) id() string {
+	return w.Key + "@" + time.Unix(w.Start, 0).UTC().Format(time.RFC3339)
+}
+
+// aggregate is the event published when window closes
+type aggregate struct {
+	Key         string   `json:"key"`
+	WindowStart string   `json:"window_start"`
+	WindowEnd   string   `json:"window_end"`
+	Count       int64    `json:"count"`
+	Temperature *summary `json:"temperature"`
+	Humidity    *summary `json:"humidity"`
+}
+
+type summary struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+func (w *window) aggregate() *aggregate {
+	return &aggregate{
+		Key:         w.Key,
+		WindowStart: time.Unix(w.Start, 0).UTC().Format(time.RFC3339),
+		WindowEnd:   time.Unix(w.End, 0).UTC().Format(time.RFC3339),
+		Count:       w.Count,
+		Temperature: w.Temperature.summary(),
+		Humidity:    w.Humidity.summary(),
+	}
+}
+
+// windows assigns readings into tumbling (slide equals size) or sliding (slide smaller than size)
+// time windows, it is not safe for concurrent use
+type windows struct {
+	size     time.Duration
+	slide    time.Duration
+	lateness time.Duration
+	open     map[string]*window
+	// closed is the latest end of the due windows, windows ending by then never accept readings
+	closed int64
+}
+
+func newWindows(size, slide, lateness time.Duration) (*windows, error) {
+	if size < time.Second || size%time.Second != 0 {
+		return nil, errors.Errorf("invalid window size, must be whole seconds: %v", size)
+	}
+	if slide == 0 {
+		slide = size
+	}
+	if slide < time.Second || slide > size || size%slide != 0 {
+		return nil, errors.Errorf("invalid window slide, must divide window size (%v): %v", size, slide)
+	}
+	if lateness < 0 {
+		return nil, errors.Errorf("invalid allowed lateness: %v", lateness)
+	}
+	return &windows{size: size, slide: slide, lateness: lateness, open: make(map[string]*window)}, nil
+}
+
+// add adds the reading to all of the windows of the key which contain t and are still open at now,
+// returns the number of windows updated, 0 means the reading was too late
+func (ws *windows) add(key string, t, now time.Time, temperature, humidity float64) int {
+	size, slide := int64(ws.size/time.Second), int64(ws.slide/time.Second)
+	ts := t.Unix()
+	closed := now.Add(-ws.lateness).Unix()
+	if closed < ws.closed {
+		closed = ws.closed
+	}
+
+	var n int
+	// the last window containing ts starts at ts rounded down to slide
+	for start := ts - mod(ts, slide); start > ts-size; start -= slide {
+		end := start + size
+		if end <= closed {
+			continue
+		}
+		w := &window{Key: key, Start: start, End: end}
+		if ow, ok := ws.open[w.id()]; ok {
+			w = ow
+		} else {
+			ws.open[w.id()] = w
+		}
+		w.Count++
+		w.Temperature.add(temperature)
+		w.Humidity.add(humidity)
+		n++
+	}
+	return n
+}
+
+// due returns the windows which end (plus allowed lateness) before now ordered by their end
+// and key, they never accept readings again, even when added with earlier now, but stay open
+// until they are published and removed
+func (ws *windows) due(now time.Time) []*window {
+	closed := now.Add(-ws.lateness).Unix()
+	if closed > ws.closed {
+		ws.closed = closed
+	}
+	var list []*window
+	for _, w := range ws.open {
+		if w.End <= closed {
+			list = append(list, w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].End != list[j].End {
+			return list[i].End < list[j].End
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// remove removes the published window
+func (ws *windows) remove(w *window) {
+	delete(ws.open, w.id())
+}
+
+// marshal serializes all of the open windows for checkpoint
+func (ws *windows) marshal() ([]byte, error) {
+	list := make([]*window, 0, len(ws.open))
+	for _, w := range ws.open {
+		list = append(list, w)
+	}
+	return json.Marshal(list)
+}
+
+// unmarshal restores the open windows from checkpoint
+func (ws *windows) unmarshal(b []byte) error {
+	var list []*window
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.Wrap(err, "error parsing checkpoint")
+	}
+	ws.open = make(map[string]*window, len(list))
+	for _, w := range list {
+		ws.open[w.id()] = w
+	}
+	return nil
+}
+
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testWindows(t *testing.T, size, slide, lateness time.Duration) *windows {
+	t.Helper()
+	ws, err := newWindows(size, slide, lateness)
+	if err != nil {
+		t.Fatalf("error creating windows: %v", err)
+	}
+	return ws
+}
+
+func TestNewWindowsValidatesConfiguration(t *testing.T) {
+	list := []struct {
+		size, slide, lateness time.Duration
+	}{
+		{500 * time.Millisecond, 0, 0},
+		{time.Minute, 7 * time.Second, 0},
+		{time.Minute, 2 * time.Minute, 0},
+		{time.Minute, 0, -time.Second},
+	}
+	for _, c := range list {
+		if _, err := newWindows(c.size, c.slide, c.lateness); err == nil {
+			t.Errorf("expected error for size %v, slide %v, lateness %v", c.size, c.slide, c.lateness)
+		}
+	}
+}
+
+func TestTumblingWindowsAggregateReadings(t *testing.T) {
+	ws := testWindows(t, time.Minute, 0, 0)
+	start := time.Unix(1600000020, 0) // 1600000020 is the start of minute
+	now := start
+
+	for i, v := range []float64{20, 24, 22} {
+		if n := ws.add("kitchen", start.Add(time.Duration(i)*time.Second), now, v, 40+v); n != 1 {
+			t.Fatalf("expected reading in single window, got: %d", n)
+		}
+	}
+	ws.add("bedroom", start, now, 18, 50)
+	ws.add("kitchen", start.Add(time.Minute), now, 30, 30)
+
+	list := ws.due(start.Add(time.Minute))
+	if len(list) != 2 || list[0].Key != "bedroom" || list[1].Key != "kitchen" {
+		t.Fatalf("expected bedroom and kitchen windows due, got: %d", len(list))
+	}
+	a := list[1].aggregate()
+	if a.Count != 3 || a.Temperature.Min != 20 || a.Temperature.Max != 24 || a.Temperature.Mean != 22 {
+		t.Fatalf("unexpected aggregate: %+v, %+v", a, a.Temperature)
+	}
+	if a.WindowStart != "2020-09-13T12:27:00Z" || a.WindowEnd != "2020-09-13T12:28:00Z" {
+		t.Fatalf("unexpected window bounds: %s - %s", a.WindowStart, a.WindowEnd)
+	}
+
+	// due windows stay open until removed
+	if len(ws.open) != 3 {
+		t.Fatalf("expected due windows to stay open, got: %d", len(ws.open))
+	}
+	for _, w := range list {
+		ws.remove(w)
+	}
+	if len(ws.open) != 1 || len(ws.due(start.Add(time.Minute))) != 0 {
+		t.Fatalf("expected only next window open, got: %d", len(ws.open))
+	}
+}
+
+func TestSlidingWindowsCountEachReadingInEachWindow(t *testing.T) {
+	ws := testWindows(t, time.Minute, 20*time.Second, 0)
+	ts := time.Unix(1600000030, 0)
+	if n := ws.add("all", ts, ts, 20, 40); n != 3 {
+		t.Fatalf("expected reading in 3 windows, got: %d", n)
+	}
+	for _, w := range ws.open {
+		if w.Start > ts.Unix() || w.End <= ts.Unix() {
+			t.Fatalf("window %s does not contain the reading", w.id())
+		}
+	}
+}
+
+func TestLateReadingsAreDroppedAfterAllowedLateness(t *testing.T) {
+	ws := testWindows(t, time.Minute, 0, 10*time.Second)
+	ts := time.Unix(1600000020, 0)
+
+	if n := ws.add("all", ts, ts.Add(65*time.Second), 20, 40); n != 1 {
+		t.Fatalf("expected reading within lateness to be added, got: %d", n)
+	}
+	if n := ws.add("all", ts, ts.Add(70*time.Second), 20, 40); n != 0 {
+		t.Fatalf("expected late reading to be dropped, got: %d", n)
+	}
+	if len(ws.due(ts.Add(65*time.Second))) != 0 || len(ws.due(ts.Add(70*time.Second))) != 1 {
+		t.Fatal("expected window due only after allowed lateness")
+	}
+}
+
+func TestWindowsCheckpointRoundTrip(t *testing.T) {
+	ws := testWindows(t, time.Minute, 0, 0)
+	ts := time.Unix(1600000020, 0)
+	ws.add("kitchen", ts, ts, 20, 40)
+	ws.add("bedroom", ts, ts, 18, 50)
+
+	b, err := ws.marshal()
+	if err != nil {
+		t.Fatalf("error serializing windows: %v", err)
+	}
+	restored := testWindows(t, time.Minute, 0, 0)
+	if err := restored.unmarshal(b); err != nil {
+		t.Fatalf("error restoring windows: %v", err)
+	}
+	restored.add("kitchen", ts, ts, 22, 40)
+	list := restored.due(ts.Add(time.Minute))
+	if len(list) != 2 || list[1].Count != 2 || list[1].aggregate().Temperature.Mean != 21 {
+		t.Fatalf("expected restored windows to keep accumulating, got: %d", len(list))
+	}
+}
+
+func TestDueWindowsRejectReadingsWithEarlierNow(t *testing.T) {
+	ws := testWindows(t, time.Minute, 0, 0)
+	start := time.Unix(1600000020, 0)
+	ws.add("all", start, start, 20, 40)
+
+	list := ws.due(start.Add(time.Minute))
+	if len(list) != 1 {
+		t.Fatalf("expected single window due, got: %d", len(list))
+	}
+	// reading whose now was read before the windows became due
+	if n := ws.add("all", start.Add(time.Second), start.Add(59*time.Second), 30, 40); n != 0 {
+		t.Fatalf("expected reading to be rejected by due window, got: %d", n)
+	}
+	ws.remove(list[0])
+	if n := ws.add("all", start.Add(time.Second), start.Add(59*time.Second), 30, 40); n != 0 || len(ws.open) != 0 {
+		t.Fatalf("expected published window not to be created again, got: %d", len(ws.open))
+	}
+}
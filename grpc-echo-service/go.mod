@@ -2,8 +2,6 @@ module github.com/mchmarny/dapr-demos/grpc-echo-service
 
 go 1.15
 
-require (
-	github.com/dapr/go-sdk v1.0.0-rc-1
-	golang.org/x/sys v0.0.0-20201116194326-cc9327a14d48 // indirect
-	google.golang.org/genproto v0.0.0-20201116205149-79184cff4dfe // indirect
-)
+require github.com/mchmarny/dapr-demos/echo-service v0.0.0
+
+replace github.com/mchmarny/dapr-demos/echo-service => ../echo-service
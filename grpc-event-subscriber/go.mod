@@ -2,4 +2,10 @@ module github.com/mchmarny/dapr-demos/grpc-event-subscriber
 
 go 1.15
 
-require github.com/dapr/go-sdk v0.11.0
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/mchmarny/dapr-demos/subscriber v0.0.0
+	github.com/pkg/errors v0.9.1
+)
+
+replace github.com/mchmarny/dapr-demos/subscriber => ../subscriber
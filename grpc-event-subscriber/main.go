@@ -1,51 +1,109 @@
 package main
 
 import (
-	"context"
 	"log"
+	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/dapr/go-sdk/service/common"
+	dapr "github.com/dapr/go-sdk/client"
 	daprd "github.com/dapr/go-sdk/service/grpc"
+	"github.com/mchmarny/dapr-demos/subscriber"
+	"github.com/pkg/errors"
 )
 
 var (
-	logger         = log.New(os.Stdout, "", 0)
-	serviceAddress = getEnvVar("ADDRESS", ":60002")
-	pubSubName     = getEnvVar("PUBSUB_NAME", "grpc-events")
-	topicName      = getEnvVar("TOPIC_NAME", "messages")
+	logger            = log.New(os.Stdout, "", 0)
+	serviceAddress    = getEnvVar("ADDRESS", ":60002")
+	pubSubName        = getEnvVar("PUBSUB_NAME", "grpc-events")
+	topicName         = getEnvVar("TOPIC_NAME", "messages")
+	subscriptionsFile = getEnvVar("SUBSCRIPTIONS_FILE", "")
 )
 
 func main() {
-	// create Dapr service
-	s, err := daprd.NewService(serviceAddress)
+	// load subscriptions, single one to PUBSUB_NAME/TOPIC_NAME unless SUBSCRIPTIONS_FILE is set
+	c, err := loadConfig()
 	if err != nil {
-		logger.Fatalf("failed to start the server: %v", err)
+		logger.Fatalf("invalid subscriptions: %v", err)
 	}
 
-	// add handler to the service
-	subscription := &common.Subscription{
-		PubsubName: pubSubName,
-		Topic:      topicName,
+	// create Dapr client only when the subscription actions need it
+	var client dapr.Client
+	if c.NeedsClient() {
+		if client, err = dapr.NewClient(); err != nil {
+			logger.Fatalf("error creating Dapr client: %v", err)
+		}
 	}
-	s.AddTopicEventHandler(subscription, eventHandler)
 
-	// start the server to handle incoming events
-	if err := s.Start(); err != nil {
-		logger.Fatalf("server error: %v", err)
+	// serve until signaled, the client is closed before exiting on error as well
+	err = serve(c, client)
+	if client != nil {
+		client.Close()
+	}
+	if err != nil {
+		logger.Fatal(err)
 	}
 }
 
-func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
-	logger.Printf(
-		"event - PubsubName:%s, Topic:%s, ID:%s, Data: %s",
-		e.PubsubName, e.Topic, e.ID, e.Data,
-	)
+// serve handles the subscriptions until the server stops or the process is signaled,
+// the pending events are flushed to the sinks in both cases
+func serve(c *subscriber.Config, client dapr.Client) error {
+	// open the sinks
+	sub, err := subscriber.New(c, client)
+	if err != nil {
+		return errors.Wrap(err, "error creating subscriber")
+	}
+	defer func() {
+		if err := sub.Close(); err != nil {
+			logger.Printf("error flushing sinks: %v", err)
+		}
+	}()
 
-	// TODO: do something with the cloud event data
+	// create Dapr service
+	lis, err := net.Listen("tcp", serviceAddress)
+	if err != nil {
+		return errors.Wrap(err, "failed to start the server")
+	}
+	s := daprd.NewServiceWithListener(lis)
 
-	return false, nil
+	// add handlers to the service
+	if err := sub.Register(s); err != nil {
+		lis.Close()
+		return errors.Wrap(err, "error adding topic subscriptions")
+	}
+
+	// start the server to handle incoming events, served through the topic event interceptor
+	// instead of s.Start, so that the extensions and raw payloads are available to the event handlers
+	server, err := subscriber.NewGRPCServer(c, s)
+	if err != nil {
+		lis.Close()
+		return errors.Wrap(err, "error creating server")
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(lis)
+	}()
+
+	// on signal, stop receiving events and flush the sinks
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "server error")
+	case sig := <-done:
+		logger.Printf("received %v, shutting down...", sig)
+		server.GracefulStop()
+	}
+	return nil
+}
+
+func loadConfig() (*subscriber.Config, error) {
+	if subscriptionsFile == "" {
+		return subscriber.DefaultConfig(pubSubName, topicName)
+	}
+	return subscriber.LoadConfig(subscriptionsFile)
 }
 
 func getEnvVar(key, fallbackValue string) string {
@@ -2,4 +2,9 @@ module github.com/mchmarny/dapr-demos/http-event-subscriber
 
 go 1.15
 
-require github.com/dapr/go-sdk v0.11.0
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/mchmarny/dapr-demos/subscriber v0.0.0
+)
+
+replace github.com/mchmarny/dapr-demos/subscriber => ../subscriber
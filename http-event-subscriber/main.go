@@ -2,54 +2,96 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
-
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/dapr/go-sdk/service/common"
+	dapr "github.com/dapr/go-sdk/client"
 	daprd "github.com/dapr/go-sdk/service/http"
+	"github.com/mchmarny/dapr-demos/subscriber"
 )
 
 var (
-	logger     = log.New(os.Stdout, "", 0)
-	address    = getEnvVar("ADDRESS", ":8080")
-	pubSubName = getEnvVar("PUBSUB_NAME", "http-events")
-	topicName  = getEnvVar("TOPIC_NAME", "messages")
+	logger            = log.New(os.Stdout, "", 0)
+	address           = getEnvVar("ADDRESS", ":8080")
+	pubSubName        = getEnvVar("PUBSUB_NAME", "http-events")
+	topicName         = getEnvVar("TOPIC_NAME", "messages")
+	subscriptionsFile = getEnvVar("SUBSCRIPTIONS_FILE", "")
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
 )
 
 func main() {
-	// create a Dapr service
-	s := daprd.NewService(address)
+	// load subscriptions, single one to PUBSUB_NAME/TOPIC_NAME unless SUBSCRIPTIONS_FILE is set
+	c, err := loadConfig()
+	if err != nil {
+		logger.Fatalf("invalid subscriptions: %v", err)
+	}
+
+	// create Dapr client only when the subscription actions need it
+	var client dapr.Client
+	if c.NeedsClient() {
+		if client, err = dapr.NewClient(); err != nil {
+			logger.Fatalf("error creating Dapr client: %v", err)
+		}
+		defer client.Close()
+	}
 
-	// add some topic subscriptions
-	subscription := &common.Subscription{
-		PubsubName: pubSubName,
-		Topic:      topicName,
-		Route:      fmt.Sprintf("/%s", topicName),
+	// open the sinks
+	sub, err := subscriber.New(c, client)
+	if err != nil {
+		logger.Fatalf("error creating subscriber: %v", err)
 	}
 
-	if err := s.AddTopicEventHandler(subscription, eventHandler); err != nil {
-		logger.Fatalf("error adding topic subscription: %v", err)
+	// create a Dapr service
+	mux := http.NewServeMux()
+	s := daprd.NewServiceWithMux(address, mux)
+
+	// add the topic subscriptions
+	if err := sub.Register(s); err != nil {
+		logger.Fatalf("error adding topic subscriptions: %v", err)
 	}
 
-	// start the service
-	if err := s.Start(); err != nil && err != http.ErrServerClosed {
-		logger.Fatalf("error starting service: %v", err)
+	// start the service, served through the envelope handler instead of s.Start,
+	// so that all of the CloudEvent attributes are available to the event handlers
+	mux.Handle("/dapr/subscribe", subscriber.SubscribeHandler(c))
+	server := &http.Server{
+		Addr:    address,
+		Handler: subscriber.EnvelopeHandler(c, mux),
 	}
-}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("error starting service: %v", err)
+		}
+	}()
 
-func eventHandler(ctx context.Context, e *common.TopicEvent) (retry bool, err error) {
-	logger.Printf(
-		"event - PubsubName:%s, Topic:%s, ID:%s, Data: %v",
-		e.PubsubName, e.Topic, e.ID, e.Data,
-	)
+	// on signal, stop receiving events and flush the sinks
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-done
+	logger.Printf("received %v, shutting down...", sig)
 
-	// TODO: do something with the cloud event data
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Printf("error shutting down service: %v", err)
+	}
+	if err := sub.Close(); err != nil {
+		logger.Printf("error flushing sinks: %v", err)
+	}
+}
 
-	return false, nil
+func loadConfig() (*subscriber.Config, error) {
+	if subscriptionsFile == "" {
+		return subscriber.DefaultConfig(pubSubName, topicName)
+	}
+	return subscriber.LoadConfig(subscriptionsFile)
 }
 
 func getEnvVar(key, fallbackValue string) string {
@@ -0,0 +1,130 @@
+package subscriber
+
+import (
+	"context"
+	"log"
+	"os"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ActionLog logs the event
+	ActionLog = "log"
+	// ActionPublish forwards the event data to another topic
+	ActionPublish = "publish"
+	// ActionState saves the event data in state store, keyed by event ID
+	ActionState = "state"
+	// ActionBinding invokes output binding with the event data
+	ActionBinding = "binding"
+	// ActionSink writes the event to one of the configured sinks
+	ActionSink = "sink"
+
+	defaultOperation = "create"
+)
+
+var (
+	logger = log.New(os.Stdout, "", 0)
+)
+
+// Client is the subset of Dapr client used by the actions
+type Client interface {
+	PublishEvent(ctx context.Context, component, topic string, in []byte) error
+	SaveState(ctx context.Context, store, key string, data []byte) error
+	SaveStateItems(ctx context.Context, store string, items ...*dapr.SetStateItem) error
+	InvokeOutputBinding(ctx context.Context, in *dapr.BindingInvocation) error
+}
+
+// EventHandler is the signature of the handlers of the normalized events
+type EventHandler func(ctx context.Context, e *Event) (retry bool, err error)
+
+// Action defines what is done with each event of the subscription
+type Action struct {
+	// Type is the type of action: log, publish, state, binding, or sink.
+	Type string `yaml:"type"`
+	// PubSub and Topic are the pub/sub component and topic of the publish action.
+	PubSub string `yaml:"pubsub"`
+	Topic  string `yaml:"topic"`
+	// Store is the name of the state store of the state action.
+	Store string `yaml:"store"`
+	// Binding is the name of the output binding of the binding action.
+	Binding string `yaml:"binding"`
+	// Operation is the operation of the binding action, defaults to create.
+	Operation string `yaml:"operation"`
+	// Metadata is the metadata of the binding action.
+	Metadata map[string]string `yaml:"metadata"`
+	// Sink is the name of the sink of the sink action.
+	Sink string `yaml:"sink"`
+}
+
+// init validates the action and sets its defaults
+func (a *Action) init() error {
+	if a.Type == "" {
+		a.Type = ActionLog
+	}
+	switch a.Type {
+	case ActionLog:
+	case ActionPublish:
+		if a.PubSub == "" || a.Topic == "" {
+			return errors.New("publish action pubsub and topic required")
+		}
+	case ActionState:
+		if a.Store == "" {
+			return errors.New("state action store required")
+		}
+	case ActionBinding:
+		if a.Binding == "" {
+			return errors.New("binding action binding required")
+		}
+		if a.Operation == "" {
+			a.Operation = defaultOperation
+		}
+	case ActionSink:
+		if a.Sink == "" {
+			return errors.New("sink action sink required")
+		}
+	default:
+		return errors.Errorf("invalid action (log, publish, state, binding, sink): %s", a.Type)
+	}
+	return nil
+}
+
+// handler returns the event handler executing the action, failed actions are retried
+func (a *Action) handler(client Client, sinks map[string]*batcher) (EventHandler, error) {
+	if a.Type != ActionLog && a.Type != ActionSink && client == nil {
+		return nil, errors.Errorf("client required for %s action", a.Type)
+	}
+	sink := sinks[a.Sink]
+	if a.Type == ActionSink && sink == nil {
+		return nil, errors.Errorf("sink not configured: %s", a.Sink)
+	}
+	return func(ctx context.Context, e *Event) (retry bool, err error) {
+		data := e.RawData
+		switch a.Type {
+		case ActionLog:
+			logger.Printf(
+				"event - PubsubName:%s, Topic:%s, ID:%s, Type:%s, Extensions:%v, Data: %s",
+				e.PubsubName, e.Topic, e.ID, e.Type, e.Extensions, e.DataString(),
+			)
+			return false, nil
+		case ActionPublish:
+			err = client.PublishEvent(ctx, a.PubSub, a.Topic, data)
+		case ActionState:
+			err = client.SaveState(ctx, a.Store, e.ID, data)
+		case ActionBinding:
+			err = client.InvokeOutputBinding(ctx, &dapr.BindingInvocation{
+				Name:      a.Binding,
+				Operation: a.Operation,
+				Data:      data,
+				Metadata:  a.Metadata,
+			})
+		case ActionSink:
+			err = sink.write(ctx, e)
+		}
+		if err != nil {
+			return true, errors.Wrapf(err, "error executing %s action on event %s", a.Type, e.ID)
+		}
+		return false, nil
+	}, nil
+}
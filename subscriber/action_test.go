@@ -0,0 +1,115 @@
+package subscriber
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestActionHandlers(t *testing.T) {
+	list := []struct {
+		name   string
+		action *Action
+		check  func(c *testClient) bool
+	}{
+		{
+			name:   "log",
+			action: &Action{Type: ActionLog},
+			check:  func(c *testClient) bool { return len(c.published)+len(c.saved)+len(c.invoked) == 0 },
+		},
+		{
+			name:   "publish",
+			action: &Action{Type: ActionPublish, PubSub: "p", Topic: "t"},
+			check:  func(c *testClient) bool { return len(c.published) == 1 && c.published[0] == `{"amount":150}` },
+		},
+		{
+			name:   "state",
+			action: &Action{Type: ActionState, Store: "s"},
+			check: func(c *testClient) bool {
+				return len(c.saved) == 1 && c.saved[0].Key == "1" && string(c.saved[0].Value) == `{"amount":150}`
+			},
+		},
+		{
+			name:   "binding",
+			action: &Action{Type: ActionBinding, Binding: "b", Metadata: map[string]string{"k": "v"}},
+			check: func(c *testClient) bool {
+				return len(c.invoked) == 1 && c.invoked[0].Name == "b" && c.invoked[0].Operation == defaultOperation &&
+					c.invoked[0].Metadata["k"] == "v" && string(c.invoked[0].Data) == `{"amount":150}`
+			},
+		},
+	}
+
+	for _, tt := range list {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.action.init(); err != nil {
+				t.Fatalf("invalid action: %v", err)
+			}
+			e := testEvent(t, `{"amount":150}`)
+
+			c := &testClient{}
+			h, err := tt.action.handler(c, nil)
+			if err != nil {
+				t.Fatalf("error creating handler: %v", err)
+			}
+			if retry, err := h(context.Background(), e); retry || err != nil {
+				t.Fatalf("unexpected result: %v, %v", retry, err)
+			}
+			if !tt.check(c) {
+				t.Fatalf("unexpected client calls: %+v", c)
+			}
+
+			// failed actions are retried, except log which never fails
+			failing := &testClient{err: errors.New("sidecar down")}
+			if h, err = tt.action.handler(failing, nil); err != nil {
+				t.Fatalf("error creating handler: %v", err)
+			}
+			retry, err := h(context.Background(), e)
+			if tt.action.Type == ActionLog {
+				if retry || err != nil {
+					t.Fatalf("unexpected result: %v, %v", retry, err)
+				}
+				return
+			}
+			if !retry || err == nil {
+				t.Fatalf("expected retry on error, got: %v, %v", retry, err)
+			}
+		})
+	}
+}
+
+func TestActionHandlerRequiresClientAndSink(t *testing.T) {
+	for _, a := range []*Action{
+		{Type: ActionPublish, PubSub: "p", Topic: "t"},
+		{Type: ActionState, Store: "s"},
+		{Type: ActionBinding, Binding: "b"},
+	} {
+		if _, err := a.handler(nil, nil); err == nil {
+			t.Errorf("expected client required for %s action", a.Type)
+		}
+	}
+	if _, err := (&Action{Type: ActionLog}).handler(nil, nil); err != nil {
+		t.Errorf("unexpected error for log action without client: %v", err)
+	}
+	if _, err := (&Action{Type: ActionSink, Sink: "missing"}).handler(nil, nil); err == nil {
+		t.Error("expected error for sink which is not configured")
+	}
+}
+
+func TestActionInitValidatesAction(t *testing.T) {
+	for _, a := range []*Action{
+		{Type: ActionPublish, PubSub: "p"},
+		{Type: ActionState},
+		{Type: ActionBinding},
+		{Type: ActionSink},
+		{Type: "email"},
+	} {
+		if err := a.init(); err == nil {
+			t.Errorf("expected error for invalid %s action", a.Type)
+		}
+	}
+	a := &Action{}
+	if err := a.init(); err != nil || a.Type != ActionLog {
+		t.Errorf("expected default log action, got: %s, %v", a.Type, err)
+	}
+}
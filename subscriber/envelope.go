@@ -0,0 +1,81 @@
+package subscriber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dapr/go-sdk/service/common"
+)
+
+// envelopeKey is the context key of the CloudEvent envelope read by EnvelopeHandler
+type envelopeKey struct{}
+
+// EnvelopeHandler reads the CloudEvent envelope of each request before passing it to h,
+// so that the attributes the HTTP SDK doesn't decode (time, dataschema, data_base64,
+// and the extensions) are available when normalizing the event. The raw payloads delivered
+// to the subscriptions with rawPayload metadata are wrapped in synthesized envelope.
+func EnvelopeHandler(c *Config, h http.Handler) http.Handler {
+	raw := make(map[string]*Subscription)
+	for _, s := range c.Subscriptions {
+		if s.raw() {
+			raw[s.Route] = s
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Body == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var env map[string]json.RawMessage
+		if err := json.Unmarshal(b, &env); err != nil || env["specversion"] == nil {
+			if s, ok := raw[r.URL.Path]; ok {
+				env = s.rawEnvelope(r.Header.Get("Content-Type"), b)
+				if b, err = json.Marshal(env); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				r.Header.Set("Content-Type", "application/cloudevents+json")
+			}
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		r.ContentLength = int64(len(b))
+		if env != nil {
+			r = r.WithContext(context.WithValue(r.Context(), envelopeKey{}, env))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SubscribeHandler lists the subscriptions to Dapr, it replaces the handler
+// registered by the HTTP SDK when the service is served through EnvelopeHandler
+func SubscribeHandler(c *Config) http.HandlerFunc {
+	subs := make([]*common.Subscription, 0, len(c.Subscriptions))
+	for _, s := range c.Subscriptions {
+		subs = append(subs, &common.Subscription{
+			PubsubName: s.PubSub,
+			Topic:      s.Topic,
+			Route:      s.Route,
+			Metadata:   s.Metadata,
+		})
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(subs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func envelopeFrom(ctx context.Context) (map[string]json.RawMessage, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(map[string]json.RawMessage)
+	return env, ok
+}
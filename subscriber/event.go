@@ -0,0 +1,361 @@
+package subscriber
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SpecVersion is the only supported version of the CloudEvents specification
+	SpecVersion = "1.0"
+
+	// attributes of the envelope Dapr adds to the event which aren't its extensions
+	attrPubsubName = "pubsubname"
+	attrTopic      = "topic"
+	attrDataBase64 = "data_base64"
+)
+
+var (
+	// attributes defined by the CloudEvents specification
+	contextAttributes = map[string]bool{
+		"id": true, "source": true, "specversion": true, "type": true,
+		"datacontenttype": true, "dataschema": true, "subject": true, "time": true,
+		"data": true, attrDataBase64: true,
+	}
+
+	// extension attribute names must be lower-case alphanumeric
+	extensionNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+// Event is the validated and normalized CloudEvent passed to the handlers
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	DataContentType string
+	DataSchema      string
+	Subject         string
+	Time            time.Time
+	// PubsubName and Topic are the pub/sub component and topic the event was delivered from.
+	PubsubName string
+	Topic      string
+	// Data is the decoded data: JSON value for JSON content types, string for text,
+	// and bytes for any other (binary) content.
+	Data interface{}
+	// RawData is the data as received, decoded from base64 for binary content.
+	RawData []byte
+	// Extensions are the extension attributes (e.g. traceid) with string, number, or boolean values.
+	Extensions map[string]interface{}
+}
+
+// ValidationError lists all of the reasons the event is not valid CloudEvent
+type ValidationError struct {
+	ID      string
+	Reasons []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid CloudEvent %s: %s", e.ID, strings.Join(e.Reasons, ", "))
+}
+
+// NewEvent validates and normalizes the topic event, using its full envelope when read
+// by EnvelopeHandler, or the attributes provided by the SDK with the extensions read
+// by TopicEventInterceptor otherwise (gRPC)
+func NewEvent(ctx context.Context, te *common.TopicEvent) (*Event, error) {
+	var e *Event
+	var reasons []string
+	if env, ok := envelopeFrom(ctx); ok {
+		e, reasons = fromEnvelope(env)
+	} else {
+		e, reasons = fromTopicEvent(te)
+		for name, v := range extensionsFrom(ctx) {
+			if contextAttributes[name] {
+				continue
+			}
+			if reason := e.addExtension(name, v); reason != "" {
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	if e.PubsubName == "" {
+		e.PubsubName = te.PubsubName
+	}
+	if e.Topic == "" {
+		e.Topic = te.Topic
+	}
+
+	reasons = append(reasons, e.validate()...)
+	if len(reasons) == 0 {
+		var err error
+		if e.Data, err = decodeData(e.DataContentType, e.RawData); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		return nil, &ValidationError{ID: e.ID, Reasons: reasons}
+	}
+	return e, nil
+}
+
+// fromTopicEvent normalizes the attributes decoded by the SDK, the gRPC SDK provides
+// data as bytes, the HTTP one as the value decoded from the envelope JSON
+func fromTopicEvent(te *common.TopicEvent) (*Event, []string) {
+	e := &Event{
+		ID:              te.ID,
+		Source:          te.Source,
+		SpecVersion:     te.SpecVersion,
+		Type:            te.Type,
+		DataContentType: te.DataContentType,
+		Subject:         te.Subject,
+		PubsubName:      te.PubsubName,
+		Topic:           te.Topic,
+	}
+	switch v := te.Data.(type) {
+	case nil:
+	case []byte:
+		e.RawData = v
+	case string:
+		if isJSON(e.DataContentType) {
+			e.RawData, _ = json.Marshal(v)
+		} else {
+			e.RawData = []byte(v)
+		}
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return e, []string{"data:invalid"}
+		}
+		e.RawData = b
+	}
+	return e, nil
+}
+
+// fromEnvelope normalizes all of the envelope attributes, including the extensions
+func fromEnvelope(env map[string]json.RawMessage) (*Event, []string) {
+	e := &Event{}
+	var reasons []string
+	for name, to := range map[string]*string{
+		"id":              &e.ID,
+		"source":          &e.Source,
+		"specversion":     &e.SpecVersion,
+		"type":            &e.Type,
+		"datacontenttype": &e.DataContentType,
+		"dataschema":      &e.DataSchema,
+		"subject":         &e.Subject,
+		attrPubsubName:    &e.PubsubName,
+		attrTopic:         &e.Topic,
+	} {
+		v, ok := env[name]
+		if !ok || isNull(v) {
+			continue
+		}
+		if err := json.Unmarshal(v, to); err != nil {
+			reasons = append(reasons, name+":type")
+		}
+	}
+
+	if v, ok := env["time"]; ok && !isNull(v) {
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			reasons = append(reasons, "time:type")
+		} else if t, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			reasons = append(reasons, "time:format")
+		} else {
+			e.Time = t
+		}
+	}
+
+	data, hasData := env["data"]
+	hasData = hasData && !isNull(data)
+	data64, hasData64 := env[attrDataBase64]
+	hasData64 = hasData64 && !isNull(data64)
+	switch {
+	case hasData && hasData64:
+		reasons = append(reasons, "data:exclusive")
+	case hasData64:
+		var s string
+		if err := json.Unmarshal(data64, &s); err != nil {
+			reasons = append(reasons, "data_base64:type")
+		} else if e.RawData, err = base64.StdEncoding.DecodeString(s); err != nil {
+			reasons = append(reasons, "data_base64:format")
+		}
+	case hasData && isJSON(e.DataContentType):
+		e.RawData = data
+	case hasData:
+		// non-JSON data is carried as JSON string
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			e.RawData = data
+		} else {
+			e.RawData = []byte(s)
+		}
+	}
+
+	for name, v := range env {
+		if contextAttributes[name] || name == attrPubsubName || name == attrTopic {
+			continue
+		}
+		var ev interface{}
+		if err := json.Unmarshal(v, &ev); err != nil {
+			reasons = append(reasons, name+":type")
+			continue
+		}
+		if reason := e.addExtension(name, ev); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return e, reasons
+}
+
+// addExtension validates the extension attribute and adds it to the event,
+// returns the reason when it's not valid, null values are ignored
+func (e *Event) addExtension(name string, v interface{}) string {
+	if !extensionNamePattern.MatchString(name) {
+		return name + ":name"
+	}
+	switch v.(type) {
+	case string, float64, bool:
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]interface{})
+		}
+		e.Extensions[name] = v
+	case nil:
+	default:
+		return name + ":type"
+	}
+	return ""
+}
+
+// validate checks the context attributes against the CloudEvents 1.0 specification
+func (e *Event) validate() []string {
+	var reasons []string
+	if e.ID == "" {
+		reasons = append(reasons, "id:required")
+	}
+	if e.Source == "" {
+		reasons = append(reasons, "source:required")
+	} else if _, err := url.Parse(e.Source); err != nil {
+		reasons = append(reasons, "source:format")
+	}
+	if e.SpecVersion == "" {
+		reasons = append(reasons, "specversion:required")
+	} else if e.SpecVersion != SpecVersion {
+		reasons = append(reasons, "specversion:unsupported")
+	}
+	if e.Type == "" {
+		reasons = append(reasons, "type:required")
+	}
+	if e.DataContentType != "" {
+		if _, _, err := mime.ParseMediaType(e.DataContentType); err != nil {
+			reasons = append(reasons, "datacontenttype:format")
+		}
+	}
+	if e.DataSchema != "" {
+		if u, err := url.Parse(e.DataSchema); err != nil || !u.IsAbs() {
+			reasons = append(reasons, "dataschema:format")
+		}
+	}
+	return reasons
+}
+
+// decodeData decodes the data based on its content type, JSON is the default
+// content type of the events in JSON format
+func decodeData(contentType string, data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch {
+	case isJSON(contentType):
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, errors.New("data:json")
+		}
+		return v, nil
+	case isText(contentType):
+		return string(data), nil
+	default:
+		return data, nil
+	}
+}
+
+// DataString returns the data as text, or as base64 when it's binary
+func (e *Event) DataString() string {
+	if _, ok := e.Data.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(e.RawData)
+	}
+	return string(e.RawData)
+}
+
+// Attributes returns the context and extension attributes of the event
+func (e *Event) Attributes() map[string]interface{} {
+	attrs := map[string]interface{}{
+		"id":              e.ID,
+		"source":          e.Source,
+		"specversion":     e.SpecVersion,
+		"type":            e.Type,
+		"datacontenttype": e.DataContentType,
+		"dataschema":      e.DataSchema,
+		"subject":         e.Subject,
+		"pubsubname":      e.PubsubName,
+		"topic":           e.Topic,
+	}
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	for k, v := range e.Extensions {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json"))
+}
+
+func isText(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (strings.HasPrefix(mt, "text/") || mt == "application/xml" || strings.HasSuffix(mt, "+xml"))
+}
+
+func isNull(v json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(v), []byte("null"))
+}
+
+// MarshalJSON serializes the event in CloudEvents JSON format, with binary data as data_base64
+func (e *Event) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{})
+	for k, v := range e.Attributes() {
+		if s, ok := v.(string); ok && s == "" {
+			continue
+		}
+		m[k] = v
+	}
+	switch e.Data.(type) {
+	case nil:
+	case []byte:
+		m[attrDataBase64] = base64.StdEncoding.EncodeToString(e.RawData)
+	case string:
+		m["data"] = e.Data
+	default:
+		m["data"] = json.RawMessage(e.RawData)
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,217 @@
+package subscriber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	pb "github.com/dapr/go-sdk/dapr/proto/runtime/v1"
+	"github.com/dapr/go-sdk/service/common"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func testConfig(t *testing.T, raw bool) *Config {
+	t.Helper()
+	c, err := DefaultConfig("events", "orders")
+	if err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if raw {
+		c.Subscriptions[0].Metadata = map[string]string{"rawPayload": "true"}
+	}
+	return c
+}
+
+// deliverHTTP posts the body to the subscription route through EnvelopeHandler,
+// and normalizes the event decoded the same way as the HTTP SDK does
+func deliverHTTP(t *testing.T, c *Config, contentType, body string) (*Event, error) {
+	t.Helper()
+	var e *Event
+	var err error
+	h := EnvelopeHandler(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var te common.TopicEvent
+		if err := json.NewDecoder(r.Body).Decode(&te); err != nil {
+			t.Fatalf("SDK can't decode the envelope: %v", err)
+		}
+		e, err = NewEvent(r.Context(), &te)
+	}))
+	r := httptest.NewRequest(http.MethodPost, c.Subscriptions[0].Route, bytes.NewReader([]byte(body)))
+	r.Header.Set("Content-Type", contentType)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return e, err
+}
+
+// deliverGRPC passes the request through TopicEventInterceptor, and normalizes
+// the event decoded the same way as the gRPC SDK does
+func deliverGRPC(t *testing.T, c *Config, in *pb.TopicEventRequest) (*Event, error) {
+	t.Helper()
+	var e *Event
+	var err error
+	_, _ = TopicEventInterceptor(c)(context.Background(), in, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		e, err = NewEvent(ctx, &common.TopicEvent{
+			ID:              in.Id,
+			Source:          in.Source,
+			Type:            in.Type,
+			SpecVersion:     in.SpecVersion,
+			DataContentType: in.DataContentType,
+			Data:            in.Data,
+			Topic:           in.Topic,
+			PubsubName:      in.PubsubName,
+		})
+		return nil, nil
+	})
+	return e, err
+}
+
+func TestNewEventNormalizesEnvelope(t *testing.T) {
+	e, err := deliverHTTP(t, testConfig(t, false), "application/cloudevents+json", `{
+		"id": "1", "source": "orders", "specversion": "1.0", "type": "order.created",
+		"time": "2020-09-13T12:26:40Z", "traceid": "abc", "priority": 2,
+		"pubsubname": "events", "topic": "orders", "data": {"amount": 150}
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.ID != "1" || e.Time.Unix() != 1600000000 || e.PubsubName != "events" {
+		t.Fatalf("unexpected attributes: %+v", e)
+	}
+	if !reflect.DeepEqual(e.Extensions, map[string]interface{}{"traceid": "abc", "priority": 2.0}) {
+		t.Fatalf("unexpected extensions: %v", e.Extensions)
+	}
+	if !reflect.DeepEqual(e.Data, map[string]interface{}{"amount": 150.0}) {
+		t.Fatalf("unexpected data: %v", e.Data)
+	}
+}
+
+func TestNewEventListsAllReasons(t *testing.T) {
+	_, err := deliverHTTP(t, testConfig(t, false), "application/cloudevents+json", `{
+		"id": "1", "specversion": "0.3", "type": "order.created", "time": "yesterday",
+		"TraceID": "abc", "nested": {"a": 1}, "data": {}, "data_base64": "e30="
+	}`)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+	want := []string{"TraceID:name", "data:exclusive", "nested:type", "source:required", "specversion:unsupported", "time:format"}
+	if !reflect.DeepEqual(verr.Reasons, want) {
+		t.Fatalf("expected %v, got: %v", want, verr.Reasons)
+	}
+}
+
+func TestNewEventDecodesBinaryData(t *testing.T) {
+	e, err := deliverHTTP(t, testConfig(t, false), "application/cloudevents+json", `{
+		"id": "1", "source": "orders", "specversion": "1.0", "type": "order.created",
+		"datacontenttype": "application/octet-stream", "data_base64": "AQID"
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, ok := e.Data.([]byte); !ok || !bytes.Equal(b, []byte{1, 2, 3}) || e.DataString() != "AQID" {
+		t.Fatalf("unexpected data: %v", e.Data)
+	}
+}
+
+func TestRawPayloadIsWrappedInSynthesizedEnvelope(t *testing.T) {
+	c := testConfig(t, true)
+	list := []struct {
+		contentType string
+		body        string
+		data        interface{}
+	}{
+		{"application/json", `{"amount":150}`, map[string]interface{}{"amount": 150.0}},
+		{"text/plain", "ping", "ping"},
+		{"", "\x01\x02", []byte{1, 2}},
+		{"application/json", "not json", []byte("not json")},
+	}
+	for _, r := range list {
+		e, err := deliverHTTP(t, c, r.contentType, r.body)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", r.body, err)
+		}
+		if e.ID == "" || e.Type != rawEventType || e.Source != "events/orders" || e.Topic != "orders" {
+			t.Fatalf("%s: unexpected attributes: %+v", r.body, e)
+		}
+		if !reflect.DeepEqual(e.Data, r.data) {
+			t.Fatalf("%s: expected data %v, got: %v", r.body, r.data, e.Data)
+		}
+	}
+
+	// CloudEvent delivered to raw subscription is used as is
+	e, err := deliverHTTP(t, c, "application/cloudevents+json", `{"id":"1","source":"s","specversion":"1.0","type":"t"}`)
+	if err != nil || e.ID != "1" {
+		t.Fatalf("expected CloudEvent as is, got: %+v, %v", e, err)
+	}
+
+	// non-raw subscription still drops raw payloads
+	if _, err := deliverHTTP(t, testConfig(t, false), "application/json", `{"amount":150}`); err == nil {
+		t.Fatal("expected invalid event")
+	}
+}
+
+func TestRawPayloadRedeliveryKeepsEventID(t *testing.T) {
+	c := testConfig(t, true)
+	first, err := deliverHTTP(t, c, "application/json", `{"amount":150}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := deliverHTTP(t, c, "application/json", `{"amount":150}`)
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("expected redelivery to keep ID %s, got: %+v, %v", first.ID, again, err)
+	}
+	other, err := deliverHTTP(t, c, "application/json", `{"amount":151}`)
+	if err != nil || other.ID == first.ID {
+		t.Fatalf("expected different payload to get different ID, got: %+v, %v", other, err)
+	}
+
+	// same payload delivered over gRPC gets the same ID, unless the runtime provides one
+	in := &pb.TopicEventRequest{PubsubName: "events", Topic: "orders", Data: []byte(`{"amount":150}`), DataContentType: "application/json"}
+	if e, err := deliverGRPC(t, c, in); err != nil || e.ID != first.ID {
+		t.Fatalf("expected gRPC delivery to keep ID %s, got: %+v, %v", first.ID, e, err)
+	}
+	in = &pb.TopicEventRequest{Id: "m1", PubsubName: "events", Topic: "orders", Data: []byte(`{"amount":150}`), DataContentType: "application/json"}
+	if e, err := deliverGRPC(t, c, in); err != nil || e.ID != "m1" {
+		t.Fatalf("expected runtime provided ID, got: %+v, %v", e, err)
+	}
+}
+
+func TestGRPCRawPayloadAndExtensions(t *testing.T) {
+	st, err := structpb.NewStruct(map[string]interface{}{"traceid": "abc", "nested": map[string]interface{}{}})
+	if err != nil {
+		t.Fatalf("error creating extensions: %v", err)
+	}
+	b, err := proto.Marshal(st)
+	if err != nil {
+		t.Fatalf("error serializing extensions: %v", err)
+	}
+	in := &pb.TopicEventRequest{PubsubName: "events", Topic: "orders", Data: []byte("ping"), DataContentType: "text/plain"}
+	in.ProtoReflect().SetUnknown(protowire.AppendBytes(protowire.AppendTag(nil, extensionsField, protowire.BytesType), b))
+
+	if _, err := deliverGRPC(t, testConfig(t, false), in); err == nil {
+		t.Fatal("expected raw payload of non-raw subscription to be invalid")
+	}
+	e, err := deliverGRPC(t, testConfig(t, true), in)
+	if verr, ok := err.(*ValidationError); !ok || !reflect.DeepEqual(verr.Reasons, []string{"nested:type"}) {
+		t.Fatalf("expected invalid extension, got: %v", err)
+	}
+
+	st.Fields["nested"] = structpb.NewBoolValue(true)
+	b, _ = proto.Marshal(st)
+	in = &pb.TopicEventRequest{PubsubName: "events", Topic: "orders", Data: []byte("ping"), DataContentType: "text/plain"}
+	in.ProtoReflect().SetUnknown(protowire.AppendBytes(protowire.AppendTag(nil, extensionsField, protowire.BytesType), b))
+	if e, err = deliverGRPC(t, testConfig(t, true), in); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.ID == "" || e.Type != rawEventType || e.Data != "ping" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if !reflect.DeepEqual(e.Extensions, map[string]interface{}{"traceid": "abc", "nested": true}) {
+		t.Fatalf("unexpected extensions: %v", e.Extensions)
+	}
+}
@@ -0,0 +1,168 @@
+package subscriber
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rotatedTimeFormat = "20060102T150405.000"
+)
+
+// fileSink appends the events as JSON Lines to the file, which is rotated
+// when writing would exceed its max size, or once it's older than its max age
+type fileSink struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+
+	f      sinkFile
+	size   int64
+	opened time.Time
+}
+
+// sinkFile is the file the sink appends to, *os.File outside of tests
+type sinkFile interface {
+	io.WriteCloser
+	Truncate(size int64) error
+}
+
+func newFileSink(path string, maxSize int64, maxAge time.Duration, compress bool) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating directory of %s", path)
+	}
+	s := &fileSink{path: path, maxSize: maxSize, maxAge: maxAge, compress: compress}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the file for appending, the age of the file is counted from its creation,
+// or, for the file which already existed when the sink was created, from its last modification
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", s.path)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error reading %s", s.path)
+	}
+	s.f, s.size = f, st.Size()
+	switch {
+	case s.size == 0:
+		s.opened = time.Now()
+	case s.opened.IsZero():
+		s.opened = st.ModTime()
+	}
+	return nil
+}
+
+// expired returns true when the file has content and is older than max age
+func (s *fileSink) expired() bool {
+	return s.size > 0 && time.Since(s.opened) >= s.maxAge
+}
+
+// tick rotates the expired file even when there are no events to write
+func (s *fileSink) tick() error {
+	if s.f == nil || !s.expired() {
+		return nil
+	}
+	return s.rotate()
+}
+
+func (s *fileSink) Write(ctx context.Context, events []*Event) error {
+	b, err := marshalLines(events)
+	if err != nil {
+		return err
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.expired() || (s.size > 0 && s.size+int64(len(b)) > s.maxSize) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.f.Write(b); err != nil {
+		// drop the partially written line, so that the retried batch doesn't corrupt the file
+		if terr := s.f.Truncate(s.size); terr != nil {
+			logger.Printf("error truncating %s after failed write: %v", s.path, terr)
+			s.Close() // reopened with its actual size on next write
+		}
+		return errors.Wrapf(err, "error writing %s", s.path)
+	}
+	s.size += int64(len(b))
+	return nil
+}
+
+// rotate renames the current file using the rotation time (e.g. events-20201208T150405.000.jsonl),
+// compresses it when configured, and opens new file
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return errors.Wrapf(err, "error closing %s", s.path)
+	}
+	s.f = nil
+
+	ext := filepath.Ext(s.path)
+	rotated := strings.TrimSuffix(s.path, ext) + "-" + time.Now().UTC().Format(rotatedTimeFormat) + ext
+	if err := os.Rename(s.path, rotated); err != nil {
+		return errors.Wrapf(err, "error rotating %s", s.path)
+	}
+	s.opened = time.Time{}
+	if s.compress {
+		if err := gzipFile(rotated); err != nil {
+			logger.Printf("error compressing %s: %v", rotated, err)
+		}
+	}
+	logger.Printf("rotated %s to %s", s.path, rotated)
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// gzipFile compresses the file into file with .gz suffix, and removes it
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
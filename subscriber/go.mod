@@ -0,0 +1,13 @@
+module github.com/mchmarny/dapr-demos/subscriber
+
+go 1.15
+
+require (
+	github.com/dapr/go-sdk v0.11.0
+	github.com/google/cel-go v0.6.0
+	github.com/pkg/errors v0.9.1
+	google.golang.org/genproto v0.0.0-20200917134801-bb4cff56e0d0
+	google.golang.org/grpc v1.32.0
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.3.0
+)
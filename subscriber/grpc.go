@@ -0,0 +1,91 @@
+package subscriber
+
+import (
+	"context"
+
+	pb "github.com/dapr/go-sdk/dapr/proto/runtime/v1"
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// extensionsField is the number of the extensions field (google.protobuf.Struct) of the topic
+// event request, sent by the Dapr runtimes which have it, and unknown to the SDK
+const extensionsField = 10
+
+// extensionsKey is the context key of the extensions read by TopicEventInterceptor
+type extensionsKey struct{}
+
+// NewGRPCServer returns gRPC server of the SDK service which is served through
+// TopicEventInterceptor, instead of s.Start, so that the extensions and raw payloads
+// of the config subscriptions are available to the event handlers
+func NewGRPCServer(c *Config, s common.Service) (*grpc.Server, error) {
+	cb, ok := s.(pb.AppCallbackServer)
+	if !ok {
+		return nil, errors.Errorf("service is not gRPC app callback server: %T", s)
+	}
+	gs := grpc.NewServer(grpc.UnaryInterceptor(TopicEventInterceptor(c)))
+	pb.RegisterAppCallbackServer(gs, cb)
+	return gs, nil
+}
+
+// TopicEventInterceptor reads the extensions of each topic event request, which the gRPC SDK
+// doesn't decode, and fills in the synthesized attributes of the raw payloads delivered
+// to the subscriptions with rawPayload metadata
+func TopicEventInterceptor(c *Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		in, ok := req.(*pb.TopicEventRequest)
+		if !ok {
+			return handler(ctx, req)
+		}
+		if s := c.subscription(in.PubsubName, in.Topic); s != nil && s.raw() && in.SpecVersion == "" {
+			attrs := s.rawAttributes(in.Id, in.DataContentType, in.Data)
+			in.Id, in.Source, in.SpecVersion = attrs["id"], attrs["source"], attrs["specversion"]
+			in.Type, in.DataContentType = attrs["type"], attrs["datacontenttype"]
+		}
+		ext, err := extensionsOf(in)
+		if err != nil {
+			logger.Printf("error reading extensions of event %s: %v", in.Id, err)
+		} else if len(ext) > 0 {
+			ctx = context.WithValue(ctx, extensionsKey{}, ext)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// extensionsOf decodes the extensions field from the unknown fields of the request
+func extensionsOf(in *pb.TopicEventRequest) (map[string]interface{}, error) {
+	b := in.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == extensionsField && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			var st structpb.Struct
+			if err := proto.Unmarshal(v, &st); err != nil {
+				return nil, errors.Wrap(err, "error decoding extensions")
+			}
+			return st.AsMap(), nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil, nil
+}
+
+func extensionsFrom(ctx context.Context) map[string]interface{} {
+	ext, _ := ctx.Value(extensionsKey{}).(map[string]interface{})
+	return ext
+}
@@ -0,0 +1,95 @@
+package subscriber
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	// metadata of the subscriptions which receive the published data as is
+	metaRawPayload = "rawPayload"
+
+	// type and default content type of the events synthesized around the raw payloads
+	rawEventType   = "com.dapr.event.sent"
+	rawContentType = "application/octet-stream"
+)
+
+// raw returns true when the subscription receives raw payloads instead of CloudEvents
+func (s *Subscription) raw() bool {
+	return strings.EqualFold(s.Metadata[metaRawPayload], "true")
+}
+
+// rawAttributes returns the context attributes of the event synthesized around the raw payload
+// delivered to the subscription, with the content type of the payload when known. The ID is
+// the one provided by the runtime, if any, or derived from the payload (see rawEventID).
+func (s *Subscription) rawAttributes(id, contentType string, data []byte) map[string]string {
+	if contentType == "" {
+		contentType = rawContentType
+	}
+	if id == "" {
+		id = s.rawEventID(contentType, data)
+	}
+	return map[string]string{
+		"id":              id,
+		"source":          s.PubSub + "/" + s.Topic,
+		"specversion":     SpecVersion,
+		"type":            rawEventType,
+		"datacontenttype": contentType,
+		"time":            time.Now().UTC().Format(time.RFC3339Nano),
+		attrPubsubName:    s.PubSub,
+		attrTopic:         s.Topic,
+	}
+}
+
+// rawEnvelope synthesizes the CloudEvent envelope around the raw payload, JSON payload is
+// the data as is, text one as string, and any other as data_base64 with binary content type
+func (s *Subscription) rawEnvelope(contentType string, data []byte) map[string]json.RawMessage {
+	attrs := s.rawAttributes("", contentType, data)
+	ct := attrs["datacontenttype"]
+	var key string
+	var value json.RawMessage
+	switch {
+	case len(data) == 0:
+	case isJSON(ct) && json.Valid(data):
+		key, value = "data", data
+	case isText(ct):
+		key, value = "data", mustMarshal(string(data))
+	default:
+		if isJSON(ct) {
+			attrs["datacontenttype"] = rawContentType
+		}
+		key, value = attrDataBase64, mustMarshal(base64.StdEncoding.EncodeToString(data))
+	}
+
+	env := make(map[string]json.RawMessage, len(attrs)+1)
+	for k, v := range attrs {
+		env[k] = mustMarshal(v)
+	}
+	if key != "" {
+		env[key] = value
+	}
+	return env
+}
+
+// rawEventID derives the ID of synthesized event from the pub/sub, topic, content type, and
+// payload, so that each redelivery of the payload gets the same ID and the actions keyed by
+// event ID (e.g. state) stay idempotent, identical payloads published separately share it too
+func (s *Subscription) rawEventID(contentType string, data []byte) string {
+	h := sha256.New()
+	for _, v := range []string{s.PubSub, s.Topic, contentType} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// mustMarshal serializes strings, which never fail
+func mustMarshal(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
@@ -0,0 +1,276 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/operators"
+	"github.com/pkg/errors"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+const (
+	// FallbackDrop acknowledges the unmatched events without handling them
+	FallbackDrop = "drop"
+	// FallbackRetry returns the unmatched events to Dapr for retry
+	FallbackRetry = "retry"
+	// FallbackDeadLetter publishes the unmatched events, and the ones failing evaluation, onto dead letter topic
+	FallbackDeadLetter = "deadletter"
+)
+
+// Rule routes the events matching its condition to its action
+type Rule struct {
+	// Name identifies the rule in logs and errors.
+	Name string `yaml:"name"`
+	// Condition is the CEL expression evaluated against the event attributes, including extensions
+	// (event.type, event.source, ...), and its decoded data (e.g. event.type == "order.cancelled" && data.amount > 100).
+	Condition string `yaml:"condition"`
+	// Action is the action taken on the matched events, defaults to log.
+	Action *Action `yaml:"action"`
+
+	program cel.Program
+}
+
+// Fallback defines what is done with the events not matched by any of the rules, the events
+// failing evaluation are dead-lettered with deadletter fallback, and retried with any other
+type Fallback struct {
+	// Type is the type of fallback: drop (default), retry, or deadletter.
+	Type string `yaml:"type"`
+	// PubSub and Topic are the pub/sub component and topic of the deadletter fallback.
+	PubSub string `yaml:"pubsub"`
+	Topic  string `yaml:"topic"`
+}
+
+// comparisons are the CEL operators rewritten by doubleLiterals
+var comparisons = map[string]bool{
+	operators.Equals:        true,
+	operators.NotEquals:     true,
+	operators.Less:          true,
+	operators.LessEquals:    true,
+	operators.Greater:       true,
+	operators.GreaterEquals: true,
+}
+
+// newRuleEnv returns the CEL environment of the rule conditions
+func newRuleEnv() (*cel.Env, error) {
+	return cel.NewEnv(cel.Declarations(
+		decls.NewVar("event", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("data", decls.Dyn),
+	))
+}
+
+// init validates the rule, compiles its condition, and sets its defaults
+func (r *Rule) init(env *cel.Env) error {
+	if r.Name == "" || r.Condition == "" {
+		return errors.New("rule name and condition required")
+	}
+	ast, iss := env.Compile(r.Condition)
+	if iss != nil && iss.Err() != nil {
+		return errors.Wrapf(iss.Err(), "rule %s: invalid condition", r.Name)
+	}
+	ast, err := doubleLiterals(env, ast)
+	if err != nil {
+		return errors.Wrapf(err, "rule %s: invalid condition", r.Name)
+	}
+	if t := ast.ResultType(); t.GetPrimitive() != exprpb.Type_BOOL && t.GetDyn() == nil {
+		return errors.Errorf("rule %s: condition must be boolean", r.Name)
+	}
+	p, err := env.Program(ast)
+	if err != nil {
+		return errors.Wrapf(err, "rule %s: error creating program", r.Name)
+	}
+	r.program = p
+
+	if r.Action == nil {
+		r.Action = &Action{Type: ActionLog}
+	}
+	return errors.Wrapf(r.Action.init(), "rule %s", r.Name)
+}
+
+// doubleLiterals rewrites the int literals compared with dynamic values as double literals
+// (e.g. data.amount > 100 as data.amount > 100.0), the JSON numbers of the data are doubles,
+// and CEL has no comparison of int with double
+func doubleLiterals(env *cel.Env, ast *cel.Ast) (*cel.Ast, error) {
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, err
+	}
+	rewritten := false
+	var walk func(e *exprpb.Expr)
+	walk = func(e *exprpb.Expr) {
+		if e == nil {
+			return
+		}
+		switch k := e.ExprKind.(type) {
+		case *exprpb.Expr_SelectExpr:
+			walk(k.SelectExpr.Operand)
+		case *exprpb.Expr_CallExpr:
+			walk(k.CallExpr.Target)
+			for _, a := range k.CallExpr.Args {
+				walk(a)
+			}
+			if args := k.CallExpr.Args; comparisons[k.CallExpr.Function] && len(args) == 2 {
+				for i, a := range args {
+					c, ok := a.GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+					if ok && checked.TypeMap[args[1-i].Id].GetDyn() != nil {
+						a.ExprKind = &exprpb.Expr_ConstExpr{ConstExpr: &exprpb.Constant{
+							ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: float64(c.Int64Value)},
+						}}
+						rewritten = true
+					}
+				}
+			}
+		case *exprpb.Expr_ListExpr:
+			for _, el := range k.ListExpr.Elements {
+				walk(el)
+			}
+		case *exprpb.Expr_StructExpr:
+			for _, en := range k.StructExpr.Entries {
+				walk(en.GetMapKey())
+				walk(en.Value)
+			}
+		case *exprpb.Expr_ComprehensionExpr:
+			c := k.ComprehensionExpr
+			for _, ce := range []*exprpb.Expr{c.IterRange, c.AccuInit, c.LoopCondition, c.LoopStep, c.Result} {
+				walk(ce)
+			}
+		}
+	}
+	walk(checked.Expr)
+	if !rewritten {
+		return ast, nil
+	}
+
+	ast, iss := env.Check(cel.ParsedExprToAst(&exprpb.ParsedExpr{Expr: checked.Expr, SourceInfo: checked.SourceInfo}))
+	if iss != nil && iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	return ast, nil
+}
+
+// matches evaluates the rule condition, evaluation errors (e.g. missing data field
+// not guarded with has) are returned
+func (r *Rule) matches(vars map[string]interface{}) (bool, error) {
+	out, _, err := r.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	v, ok := out.Value().(bool)
+	return ok && v, nil
+}
+
+// init validates the fallback and sets its defaults
+func (f *Fallback) init() error {
+	if f.Type == "" {
+		f.Type = FallbackDrop
+	}
+	switch f.Type {
+	case FallbackDrop, FallbackRetry:
+	case FallbackDeadLetter:
+		if f.PubSub == "" || f.Topic == "" {
+			return errors.New("deadletter fallback pubsub and topic required")
+		}
+	default:
+		return errors.Errorf("invalid fallback (drop, retry, deadletter): %s", f.Type)
+	}
+	return nil
+}
+
+// unmatched is the dead letter of the event not matched by any of the rules,
+// or failing evaluation of one of them
+type unmatched struct {
+	ID         string `json:"id"`
+	PubsubName string `json:"pubsubname"`
+	Topic      string `json:"topic"`
+	Type       string `json:"type,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Reason     string `json:"reason"`
+	Time       string `json:"time"`
+	Data       string `json:"data"`
+}
+
+// route is the rule with the handler of its action
+type route struct {
+	rule *Rule
+	fn   EventHandler
+}
+
+// router handles each event with the action of the first rule matching it,
+// or with the fallback when none does
+type router struct {
+	sub    *Subscription
+	routes []*route
+	client Client
+}
+
+func newRouter(sub *Subscription, client Client, sinks map[string]*batcher) (*router, error) {
+	if sub.Fallback.Type == FallbackDeadLetter && client == nil {
+		return nil, errors.New("client required for deadletter fallback")
+	}
+	r := &router{sub: sub, client: client}
+	for _, rule := range sub.Rules {
+		fn, err := rule.Action.handler(client, sinks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %s", rule.Name)
+		}
+		r.routes = append(r.routes, &route{rule: rule, fn: fn})
+	}
+	return r, nil
+}
+
+// handle routes the event, when evaluation of any rule fails, the event is dead-lettered
+// with deadletter fallback, or returned to Dapr for retry otherwise, as the rules after it
+// can't be evaluated without knowing whether it matched
+func (r *router) handle(ctx context.Context, e *Event) (retry bool, err error) {
+	vars := map[string]interface{}{"event": e.Attributes(), "data": e.Data}
+	for _, rt := range r.routes {
+		ok, err := rt.rule.matches(vars)
+		if err != nil {
+			err = errors.Wrapf(err, "error evaluating rule %s on event %s", rt.rule.Name, e.ID)
+			if r.sub.Fallback.Type == FallbackDeadLetter {
+				logger.Printf("%v", err)
+				return r.deadLetter(ctx, e, "error: "+err.Error())
+			}
+			return true, err
+		}
+		if ok {
+			return rt.fn(ctx, e)
+		}
+	}
+
+	switch r.sub.Fallback.Type {
+	case FallbackRetry:
+		return true, errors.Errorf("event %s not matched by any of the %s rules", e.ID, r.sub)
+	case FallbackDeadLetter:
+		return r.deadLetter(ctx, e, "unmatched")
+	default:
+		logger.Printf("unmatched event %s dropped", e.ID)
+	}
+	return false, nil
+}
+
+// deadLetter publishes the event onto the dead letter topic of the fallback
+func (r *router) deadLetter(ctx context.Context, e *Event, reason string) (retry bool, err error) {
+	b, err := json.Marshal(&unmatched{
+		ID:         e.ID,
+		PubsubName: e.PubsubName,
+		Topic:      e.Topic,
+		Type:       e.Type,
+		Source:     e.Source,
+		Reason:     reason,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Data:       e.DataString(),
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "error serializing event %s dead letter", e.ID)
+	}
+	f := r.sub.Fallback
+	if err := r.client.PublishEvent(ctx, f.PubSub, f.Topic, b); err != nil {
+		return true, errors.Wrapf(err, "error publishing event %s to %s/%s", e.ID, f.PubSub, f.Topic)
+	}
+	logger.Printf("event %s (%s) published to %s/%s", e.ID, reason, f.PubSub, f.Topic)
+	return false, nil
+}
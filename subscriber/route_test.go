@@ -0,0 +1,175 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	dapr "github.com/dapr/go-sdk/client"
+)
+
+// testClient records the published events, saved state items, and binding invocations
+type testClient struct {
+	mu        sync.Mutex
+	published []string
+	saved     []*dapr.SetStateItem
+	invoked   []*dapr.BindingInvocation
+	err       error
+}
+
+func (c *testClient) PublishEvent(ctx context.Context, component, topic string, in []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.published = append(c.published, string(in))
+	return nil
+}
+
+func (c *testClient) SaveState(ctx context.Context, store, key string, data []byte) error {
+	return c.SaveStateItems(ctx, store, &dapr.SetStateItem{Key: key, Value: data})
+}
+
+func (c *testClient) SaveStateItems(ctx context.Context, store string, items ...*dapr.SetStateItem) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.saved = append(c.saved, items...)
+	return nil
+}
+
+func (c *testClient) InvokeOutputBinding(ctx context.Context, in *dapr.BindingInvocation) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.invoked = append(c.invoked, in)
+	return nil
+}
+
+func testRouter(t *testing.T, rules string, client Client) *router {
+	t.Helper()
+	c, err := ParseConfig([]byte(rules))
+	if err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	r, err := newRouter(c.Subscriptions[0], client, nil)
+	if err != nil {
+		t.Fatalf("error creating router: %v", err)
+	}
+	return r
+}
+
+func testEvent(t *testing.T, data string) *Event {
+	t.Helper()
+	e := &Event{ID: "1", Type: "order.created", DataContentType: "application/json", RawData: []byte(data)}
+	if err := json.Unmarshal(e.RawData, &e.Data); err != nil {
+		t.Fatalf("invalid data: %v", err)
+	}
+	return e
+}
+
+func TestRuleComparesNumbersAcrossIntAndDouble(t *testing.T) {
+	env, err := newRuleEnv()
+	if err != nil {
+		t.Fatalf("error creating environment: %v", err)
+	}
+	list := []struct {
+		condition string
+		data      string
+		want      bool
+	}{
+		{"data.amount > 100", `{"amount":150}`, true},
+		{"data.amount > 100", `{"amount":50.5}`, false},
+		{"100 <= data.amount", `{"amount":100}`, true},
+		{"data.count == 2 && data.count != 3", `{"count":2}`, true},
+		{"data.amount > 100.0", `{"amount":150}`, true},
+		{"size(data.items) > 1", `{"items":[1,2]}`, true},
+		{"data.items.exists(i, i > 1)", `{"items":[1,2]}`, true},
+		{"-1 < data.amount", `{"amount":0}`, true},
+	}
+	for _, c := range list {
+		r := &Rule{Name: "test", Condition: c.condition}
+		if err := r.init(env); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.condition, err)
+		}
+		got, err := r.matches(map[string]interface{}{"event": map[string]interface{}{}, "data": testEvent(t, c.data).Data})
+		if err != nil || got != c.want {
+			t.Errorf("%s on %s: expected %v, got: %v (%v)", c.condition, c.data, c.want, got, err)
+		}
+	}
+}
+
+func TestRouterRoutesToFirstMatchingRule(t *testing.T) {
+	client := &testClient{}
+	r := testRouter(t, `
+subscriptions:
+- pubsub: orders
+  topic: created
+  rules:
+  - name: large
+    condition: data.amount > 100
+    action:
+      type: publish
+      pubsub: orders
+      topic: large
+  - name: created
+    condition: event.type == "order.created"
+  fallback:
+    type: retry
+`, client)
+
+	if retry, err := r.handle(context.Background(), testEvent(t, `{"amount":150}`)); err != nil || retry {
+		t.Fatalf("unexpected result: %v, %v", retry, err)
+	}
+	if retry, err := r.handle(context.Background(), testEvent(t, `{"amount":10}`)); err != nil || retry {
+		t.Fatalf("unexpected result: %v, %v", retry, err)
+	}
+	if len(client.published) != 1 || client.published[0] != `{"amount":150}` {
+		t.Fatalf("expected only large order published, got: %v", client.published)
+	}
+
+	e := testEvent(t, `{"amount":10}`)
+	e.Type = "order.updated"
+	if retry, err := r.handle(context.Background(), e); err == nil || !retry {
+		t.Fatalf("expected unmatched event retried, got: %v, %v", retry, err)
+	}
+}
+
+func TestRouterSurfacesEvaluationErrors(t *testing.T) {
+	rules := `
+subscriptions:
+- pubsub: orders
+  topic: created
+  rules:
+  - name: large
+    condition: data.amount > 100
+  fallback:
+    type: %s
+    pubsub: orders
+    topic: deadletters
+`
+	r := testRouter(t, strings.Replace(rules, "%s", "drop", 1), nil)
+	if retry, err := r.handle(context.Background(), testEvent(t, `{"total":150}`)); err == nil || !retry {
+		t.Fatalf("expected event failing evaluation retried, got: %v, %v", retry, err)
+	}
+
+	client := &testClient{}
+	r = testRouter(t, strings.Replace(rules, "%s", "deadletter", 1), client)
+	if retry, err := r.handle(context.Background(), testEvent(t, `{"total":150}`)); err != nil || retry {
+		t.Fatalf("unexpected result: %v, %v", retry, err)
+	}
+	var dl unmatched
+	if len(client.published) != 1 || json.Unmarshal([]byte(client.published[0]), &dl) != nil {
+		t.Fatalf("expected dead letter, got: %v", client.published)
+	}
+	if !strings.HasPrefix(dl.Reason, "error: ") || dl.Data != `{"total":150}` {
+		t.Fatalf("expected evaluation error dead letter, got: %+v", dl)
+	}
+}
@@ -0,0 +1,345 @@
+package subscriber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	dapr "github.com/dapr/go-sdk/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SinkFile writes the events into rotating JSON Lines files
+	SinkFile = "file"
+	// SinkState saves the events in state store, keyed by event ID
+	SinkState = "state"
+	// SinkBinding invokes output binding with each batch of events as JSON Lines
+	SinkBinding = "binding"
+
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultMaxPending    = 10000
+	defaultMaxSizeMB     = 100
+	defaultMaxAge        = 24 * time.Hour
+	sinkWriteTimeout     = 30 * time.Second
+)
+
+// Sink writes batches of events
+type Sink interface {
+	Write(ctx context.Context, events []*Event) error
+	Close() error
+}
+
+// SinkConfig defines single event sink
+type SinkConfig struct {
+	// Name identifies the sink in the sink actions.
+	Name string `yaml:"name"`
+	// Type is the type of sink: file, state, or binding.
+	Type string `yaml:"type"`
+	// Path is the path of the file of the file sink, rotated files are suffixed with their rotation time.
+	Path string `yaml:"path"`
+	// MaxSizeMB is the size of the file (default: 100), and MaxAge is its age (default: 24h), after which it's rotated.
+	MaxSizeMB int    `yaml:"max_size_mb"`
+	MaxAge    string `yaml:"max_age"`
+	// Compress gzips the rotated files.
+	Compress bool `yaml:"compress"`
+	// Store is the name of the state store of the state sink.
+	Store string `yaml:"store"`
+	// Binding is the name of the output binding of the binding sink.
+	Binding string `yaml:"binding"`
+	// Operation is the operation of the binding sink, defaults to create.
+	Operation string `yaml:"operation"`
+	// Metadata is the metadata of the binding sink.
+	Metadata map[string]string `yaml:"metadata"`
+	// BatchSize is the max number of events written at once (default: 100).
+	BatchSize int `yaml:"batch_size"`
+	// FlushInterval is the max time the events wait to be written (default: 1s).
+	FlushInterval string `yaml:"flush_interval"`
+	// MaxPending is the max number of events waiting to be written, the events
+	// are returned to Dapr for retry when reached (default: 10000).
+	MaxPending int `yaml:"max_pending"`
+
+	maxAge        time.Duration
+	flushInterval time.Duration
+}
+
+// init validates the sink and sets its defaults
+func (c *SinkConfig) init() (err error) {
+	switch c.Type {
+	case SinkFile:
+		if c.Path == "" {
+			return errors.New("file sink path required")
+		}
+	case SinkState:
+		if c.Store == "" {
+			return errors.New("state sink store required")
+		}
+	case SinkBinding:
+		if c.Binding == "" {
+			return errors.New("binding sink binding required")
+		}
+		if c.Operation == "" {
+			c.Operation = defaultOperation
+		}
+	default:
+		return errors.Errorf("invalid sink (file, state, binding): %s", c.Type)
+	}
+	if c.MaxSizeMB < 1 {
+		c.MaxSizeMB = defaultMaxSizeMB
+	}
+	if c.BatchSize < 1 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.MaxPending < c.BatchSize {
+		c.MaxPending = defaultMaxPending
+	}
+	if c.maxAge, err = parseDuration(c.MaxAge, defaultMaxAge); err != nil {
+		return errors.Wrap(err, "invalid max age")
+	}
+	if c.flushInterval, err = parseDuration(c.FlushInterval, defaultFlushInterval); err != nil {
+		return errors.Wrap(err, "invalid flush interval")
+	}
+	return nil
+}
+
+// open creates the sink
+func (c *SinkConfig) open(client Client) (Sink, error) {
+	if c.Type != SinkFile && client == nil {
+		return nil, errors.Errorf("client required for %s sink", c.Type)
+	}
+	switch c.Type {
+	case SinkState:
+		return &stateSink{client: client, store: c.Store}, nil
+	case SinkBinding:
+		return &bindingSink{client: client, config: c}, nil
+	default:
+		return newFileSink(c.Path, int64(c.MaxSizeMB)*1024*1024, c.maxAge, c.Compress)
+	}
+}
+
+// ticker is implemented by the sinks which have work to do periodically (e.g. time based rotation),
+// it's called from the same goroutine as Write
+type ticker interface {
+	tick() error
+}
+
+// pendingEvent is the buffered event with the result of writing its batch
+type pendingEvent struct {
+	event   *Event
+	written chan error
+}
+
+// batcher buffers the events and writes them to the sink in batches,
+// when the batch is full or when the flush interval elapses
+type batcher struct {
+	name     string
+	sink     Sink
+	size     int
+	max      int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []*pendingEvent
+	closed  bool
+
+	full    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	err     error
+}
+
+func newBatcher(c *SinkConfig, s Sink) *batcher {
+	b := &batcher{
+		name:     c.Name,
+		sink:     s,
+		size:     c.BatchSize,
+		max:      c.MaxPending,
+		interval: c.flushInterval,
+		full:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add buffers the event, fails when the sink is closed or has too many pending events,
+// the returned channel receives the result of writing the batch of the event
+func (b *batcher) add(e *Event) (<-chan error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.Errorf("sink %s closed", b.name)
+	}
+	if len(b.pending) >= b.max {
+		return nil, errors.Errorf("sink %s full (%d pending events)", b.name, len(b.pending))
+	}
+	p := &pendingEvent{event: e, written: make(chan error, 1)}
+	b.pending = append(b.pending, p)
+	if len(b.pending) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return p.written, nil
+}
+
+// write buffers the event and waits until its batch is written, so that the event
+// is acknowledged only once it's in the sink
+func (b *batcher) write(ctx context.Context, e *Event) error {
+	written, err := b.add(e)
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.stopped)
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.flush()
+			if tk, ok := b.sink.(ticker); ok {
+				if err := tk.tick(); err != nil {
+					logger.Printf("error in sink %s: %v", b.name, err)
+				}
+			}
+		case <-b.full:
+			b.flush()
+		case <-b.done:
+			b.err = b.flush()
+			return
+		}
+	}
+}
+
+// flush writes all of the pending events in batches, when one fails, its events
+// and the ones after it fail as well, so that they are all returned to Dapr for retry
+func (b *batcher) flush() error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := b.size
+		if n > len(pending) {
+			n = len(pending)
+		}
+		events := make([]*Event, n)
+		for i, p := range pending[:n] {
+			events[i] = p.event
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sinkWriteTimeout)
+		err := b.sink.Write(ctx, events)
+		cancel()
+		if err != nil {
+			err = errors.Wrapf(err, "error writing batch of %d events to sink %s", n, b.name)
+			logger.Printf("%v", err)
+			for _, p := range pending {
+				p.written <- err
+			}
+			return err
+		}
+		for _, p := range pending[:n] {
+			p.written <- nil
+		}
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// close stops accepting events, flushes the pending ones, and closes the sink
+func (b *batcher) close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	close(b.done)
+	<-b.stopped
+	if err := b.sink.Close(); err != nil && b.err == nil {
+		return errors.Wrapf(err, "error closing sink %s", b.name)
+	}
+	return b.err
+}
+
+// stateSink saves each event in state store keyed by its ID
+type stateSink struct {
+	client Client
+	store  string
+}
+
+func (s *stateSink) Write(ctx context.Context, events []*Event) error {
+	items := make([]*dapr.SetStateItem, 0, len(events))
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrapf(err, "error serializing event %s", e.ID)
+		}
+		items = append(items, &dapr.SetStateItem{Key: e.ID, Value: b})
+	}
+	return s.client.SaveStateItems(ctx, s.store, items...)
+}
+
+func (s *stateSink) Close() error {
+	return nil
+}
+
+// bindingSink invokes output binding with each batch of events as JSON Lines
+type bindingSink struct {
+	client Client
+	config *SinkConfig
+}
+
+func (s *bindingSink) Write(ctx context.Context, events []*Event) error {
+	b, err := marshalLines(events)
+	if err != nil {
+		return err
+	}
+	return s.client.InvokeOutputBinding(ctx, &dapr.BindingInvocation{
+		Name:      s.config.Binding,
+		Operation: s.config.Operation,
+		Data:      b,
+		Metadata:  s.config.Metadata,
+	})
+}
+
+func (s *bindingSink) Close() error {
+	return nil
+}
+
+// marshalLines serializes the events as JSON Lines
+func marshalLines(events []*Event) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error serializing event %s", e.ID)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func parseDuration(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		return 0, errors.Errorf("duration must be positive: %s", s)
+	}
+	return d, err
+}
@@ -0,0 +1,432 @@
+package subscriber
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testSink records the written batches and fails while down
+type testSink struct {
+	mu      sync.Mutex
+	batches [][]string
+	down    bool
+	closed  bool
+}
+
+func (s *testSink) Write(ctx context.Context, events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return errors.New("sink down")
+	}
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *testSink) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *testSink) written() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func testBatcher(t *testing.T, sink Sink, size int, interval string) *batcher {
+	t.Helper()
+	c := &SinkConfig{Name: "test", Type: SinkFile, Path: "unused", BatchSize: size, FlushInterval: interval}
+	if err := c.init(); err != nil {
+		t.Fatalf("invalid sink config: %v", err)
+	}
+	return newBatcher(c, sink)
+}
+
+// writeAll writes the events concurrently and returns their results by ID
+func writeAll(b *batcher, ids ...string) map[string]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			err := b.write(context.Background(), &Event{ID: id})
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return results
+}
+
+func TestBatcherAcknowledgesEventsOnceBatchIsWritten(t *testing.T) {
+	sink := &testSink{}
+	b := testBatcher(t, sink, 2, "1h")
+	defer b.close()
+
+	for id, err := range writeAll(b, "1", "2") {
+		if err != nil {
+			t.Fatalf("event %s: unexpected error: %v", id, err)
+		}
+	}
+	if list := sink.written(); len(list) != 1 || len(list[0]) != 2 {
+		t.Fatalf("expected single batch of 2 events, got: %v", list)
+	}
+}
+
+func TestBatcherFailsEventsOfFailedBatch(t *testing.T) {
+	sink := &testSink{down: true}
+	b := testBatcher(t, sink, 2, "10ms")
+	defer b.close()
+
+	for id, err := range writeAll(b, "1", "2", "3") {
+		if err == nil {
+			t.Fatalf("event %s: expected error while sink is down", id)
+		}
+	}
+	b.mu.Lock()
+	pending := len(b.pending)
+	b.mu.Unlock()
+	if pending != 0 {
+		t.Fatalf("expected failed events returned instead of pending, got: %d", pending)
+	}
+
+	sink.setDown(false)
+	if err := b.write(context.Background(), &Event{ID: "1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if list := sink.written(); len(list) != 1 || list[0][0] != "1" {
+		t.Fatalf("expected only retried event written, got: %v", list)
+	}
+}
+
+func TestBatcherCloseFlushesPendingEvents(t *testing.T) {
+	sink := &testSink{down: true}
+	b := testBatcher(t, sink, 10, "1h")
+	written, err := b.add(&Event{ID: "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := b.close(); err == nil || !sink.closed {
+		t.Fatalf("expected final flush error and closed sink, got: %v", err)
+	}
+	if err := <-written; err == nil {
+		t.Fatal("expected event of failed final flush to fail")
+	}
+	if _, err := b.add(&Event{ID: "2"}); err == nil {
+		t.Fatal("expected error adding to closed sink")
+	}
+}
+
+func TestBatcherWriteStopsWaitingOnContext(t *testing.T) {
+	b := testBatcher(t, &testSink{}, 10, "1h")
+	defer b.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.write(ctx, &Event{ID: "1"}); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+}
+
+func testFileSink(t *testing.T, dir string, maxAge time.Duration) *fileSink {
+	t.Helper()
+	s, err := newFileSink(filepath.Join(dir, "events.jsonl"), 1024*1024, maxAge, false)
+	if err != nil {
+		t.Fatalf("error creating file sink: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func rotatedFiles(t *testing.T, dir string) int {
+	t.Helper()
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error listing files: %v", err)
+	}
+	return len(list) - 1
+}
+
+func TestFileSinkRotatesExpiredFileWithoutWrites(t *testing.T) {
+	dir := t.TempDir()
+	s := testFileSink(t, dir, time.Hour)
+	if err := s.tick(); err != nil || rotatedFiles(t, dir) != 0 {
+		t.Fatalf("expected empty file not rotated, got: %v", err)
+	}
+	if err := s.Write(context.Background(), []*Event{{ID: "1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.tick(); err != nil || rotatedFiles(t, dir) != 0 {
+		t.Fatalf("expected new file not rotated, got: %v", err)
+	}
+
+	// closing and reopening the file keeps its age
+	opened := s.opened.Add(-2 * time.Hour)
+	s.opened = opened
+	s.Close()
+	if err := s.open(); err != nil || !s.opened.Equal(opened) {
+		t.Fatalf("expected reopened file to keep its age, got: %v, %v", s.opened, err)
+	}
+	if err := s.tick(); err != nil || rotatedFiles(t, dir) != 1 {
+		t.Fatalf("expected expired file rotated, got: %v", err)
+	}
+	if s.size != 0 || time.Since(s.opened) > time.Minute {
+		t.Fatalf("expected new file after rotation, got size %d opened %v", s.size, s.opened)
+	}
+}
+
+func TestFileSinkCountsAgeOfExistingFileFromModification(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	if err := ioutil.WriteFile(path, []byte(`{"id":"0"}`+"\n"), 0644); err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	modified := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("error changing file time: %v", err)
+	}
+
+	s := testFileSink(t, dir, time.Hour)
+	if err := s.Write(context.Background(), []*Event{{ID: "1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := rotatedFiles(t, dir); n != 1 {
+		t.Fatalf("expected existing expired file rotated before write, got: %d", n)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"id":"1"`) || strings.Contains(string(b), `"id":"0"`) {
+		t.Fatalf("expected new file with the written event, got: %s, %v", b, err)
+	}
+}
+
+func TestFileSinkRotatesFileThatWouldExceedMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	line, err := marshalLines([]*Event{{ID: "1"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := newFileSink(path, int64(2*len(line)), time.Hour, false)
+	if err != nil {
+		t.Fatalf("error creating file sink: %v", err)
+	}
+	defer s.Close()
+
+	for _, id := range []string{"1", "2"} {
+		if err := s.Write(context.Background(), []*Event{{ID: id}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := rotatedFiles(t, dir); n != 0 {
+		t.Fatalf("expected file up to max size not rotated, got: %d", n)
+	}
+	if err := s.Write(context.Background(), []*Event{{ID: "3"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := rotatedFiles(t, dir); n != 1 {
+		t.Fatalf("expected file rotated before exceeding max size, got: %d", n)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || strings.Count(string(b), "\n") != 1 || !strings.Contains(string(b), `"id":"3"`) {
+		t.Fatalf("expected new file with the last event, got: %s, %v", b, err)
+	}
+
+	// batch larger than max size is still written to empty file,
+	// the rotated files are named by the time in milliseconds
+	time.Sleep(2 * time.Millisecond)
+	if err := s.Write(context.Background(), []*Event{{ID: "4"}, {ID: "5"}, {ID: "6"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := s.Write(context.Background(), []*Event{{ID: "7"}, {ID: "8"}, {ID: "9"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := rotatedFiles(t, dir); n != 3 || s.size != int64(3*len(line)) {
+		t.Fatalf("expected each oversized batch in its own file, got: %d files, size %d", n, s.size)
+	}
+}
+
+func TestFileSinkCompressesRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileSink(filepath.Join(dir, "events.jsonl"), 1024*1024, time.Hour, true)
+	if err != nil {
+		t.Fatalf("error creating file sink: %v", err)
+	}
+	defer s.Close()
+	if err := s.Write(context.Background(), []*Event{{ID: "1"}, {ID: "2"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	if err := s.rotate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	list, err := filepath.Glob(filepath.Join(dir, "events-*"))
+	if err != nil || len(list) != 1 || !strings.HasSuffix(list[0], ".jsonl.gz") {
+		t.Fatalf("expected only compressed rotated file, got: %v, %v", list, err)
+	}
+	f, err := os.Open(list[0])
+	if err != nil {
+		t.Fatalf("error opening rotated file: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("error reading compressed file: %v", err)
+	}
+	if b, err := ioutil.ReadAll(zr); err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("expected rotated events, got: %s, %v", b, err)
+	}
+}
+
+// shortFile writes only half of the first write and fails it
+type shortFile struct {
+	*os.File
+	failed bool
+}
+
+func (f *shortFile) Write(b []byte) (int, error) {
+	if f.failed {
+		return f.File.Write(b)
+	}
+	f.failed = true
+	n, _ := f.File.Write(b[:len(b)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestFileSinkTruncatesShortWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := testFileSink(t, dir, time.Hour)
+	if err := s.Write(context.Background(), []*Event{{ID: "1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.f = &shortFile{File: s.f.(*os.File)}
+	batch := []*Event{{ID: "2"}, {ID: "3"}}
+	if err := s.Write(context.Background(), batch); err == nil {
+		t.Fatal("expected error on short write")
+	}
+	if err := s.Write(context.Background(), batch); err != nil {
+		t.Fatalf("unexpected error retrying batch: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 || int64(len(b)) != s.size {
+		t.Fatalf("expected 3 complete lines of size %d, got: %q", s.size, b)
+	}
+	for i, l := range lines {
+		var e Event
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("line %d: invalid JSON %s: %v", i, l, err)
+		}
+	}
+}
+
+func TestMarshalLines(t *testing.T) {
+	b, err := marshalLines([]*Event{
+		{ID: "1", Source: "orders", Type: "order.created", Data: "ping"},
+		{ID: "2", Source: "orders", Type: "order.created"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("expected 2 newline terminated lines, got: %q", b)
+	}
+	for i, want := range []map[string]interface{}{
+		{"id": "1", "source": "orders", "type": "order.created", "data": "ping"},
+		{"id": "2", "source": "orders", "type": "order.created"},
+	} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &m); err != nil {
+			t.Fatalf("line %d: invalid JSON: %v", i, err)
+		}
+		for k, v := range want {
+			if m[k] != v {
+				t.Fatalf("line %d: expected %s %v, got: %v", i, k, v, m)
+			}
+		}
+	}
+	if b, err := marshalLines(nil); err != nil || len(b) != 0 {
+		t.Fatalf("expected no lines, got: %q, %v", b, err)
+	}
+}
+
+func TestStateSinkSavesEventsByID(t *testing.T) {
+	c := &testClient{}
+	s := &stateSink{client: c, store: "events"}
+	if err := s.Write(context.Background(), []*Event{{ID: "1", Data: "ping"}, {ID: "2"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.saved) != 2 || c.saved[0].Key != "1" || c.saved[1].Key != "2" {
+		t.Fatalf("expected events saved by ID, got: %+v", c.saved)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(c.saved[0].Value, &m); err != nil || m["id"] != "1" || m["data"] != "ping" {
+		t.Fatalf("expected saved event as JSON, got: %s, %v", c.saved[0].Value, err)
+	}
+
+	c.err = errors.New("store unavailable")
+	if err := s.Write(context.Background(), []*Event{{ID: "3"}}); err == nil {
+		t.Fatal("expected error when state store fails")
+	}
+}
+
+func TestBindingSinkInvokesBindingWithBatch(t *testing.T) {
+	c := &testClient{}
+	config := &SinkConfig{Name: "archive", Type: SinkBinding, Binding: "blob", Metadata: map[string]string{"blobName": "events"}}
+	if err := config.init(); err != nil {
+		t.Fatalf("invalid sink config: %v", err)
+	}
+	sink, err := config.open(c)
+	if err != nil {
+		t.Fatalf("error opening sink: %v", err)
+	}
+	events := []*Event{{ID: "1"}, {ID: "2"}}
+	if err := sink.Write(context.Background(), events); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := marshalLines(events)
+	if len(c.invoked) != 1 {
+		t.Fatalf("expected single invocation, got: %d", len(c.invoked))
+	}
+	in := c.invoked[0]
+	if in.Name != "blob" || in.Operation != defaultOperation || in.Metadata["blobName"] != "events" || !bytes.Equal(in.Data, want) {
+		t.Fatalf("unexpected invocation: %+v", in)
+	}
+
+	c.err = errors.New("binding unavailable")
+	if err := sink.Write(context.Background(), events); err == nil {
+		t.Fatal("expected error when binding fails")
+	}
+}
@@ -0,0 +1,79 @@
+package subscriber
+
+import (
+	"context"
+
+	"github.com/dapr/go-sdk/service/common"
+	"github.com/pkg/errors"
+)
+
+// Subscriber handles the events of all of the subscriptions,
+// and writes the events of the sink actions to their sinks
+type Subscriber struct {
+	config *Config
+	client Client
+	sinks  map[string]*batcher
+}
+
+// New opens the sinks of the config, client can be nil when none of the actions,
+// fallbacks, or sinks needs it (see Config.NeedsClient)
+func New(c *Config, client Client) (*Subscriber, error) {
+	s := &Subscriber{config: c, client: client, sinks: make(map[string]*batcher)}
+	for _, sc := range c.Sinks {
+		sink, err := sc.open(client)
+		if err != nil {
+			s.Close()
+			return nil, errors.Wrapf(err, "sink %s", sc.Name)
+		}
+		s.sinks[sc.Name] = newBatcher(sc, sink)
+		logger.Printf("opened %s sink %s (batch: %d, flush: %v)", sc.Type, sc.Name, sc.BatchSize, sc.flushInterval)
+	}
+	return s, nil
+}
+
+// Register adds the handler of each subscription to the service
+func (s *Subscriber) Register(svc common.Service) error {
+	for _, sub := range s.config.Subscriptions {
+		h, err := sub.handler(s.client, s.sinks)
+		if err != nil {
+			return errors.Wrapf(err, "subscription %s", sub)
+		}
+		fn := normalized(h)
+		if err := svc.AddTopicEventHandler(&common.Subscription{
+			PubsubName: sub.PubSub,
+			Topic:      sub.Topic,
+			Route:      sub.Route,
+			Metadata:   sub.Metadata,
+		}, fn); err != nil {
+			return errors.Wrapf(err, "error adding subscription %s", sub)
+		}
+		logger.Printf("subscribed to %s (route: %s, %s)", sub, sub.Route, sub.handling())
+	}
+	return nil
+}
+
+// Close flushes the pending events of all sinks and closes them,
+// events handled after Close are returned to Dapr for retry
+func (s *Subscriber) Close() error {
+	var err error
+	for name, b := range s.sinks {
+		if e := b.close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.sinks, name)
+	}
+	return err
+}
+
+// normalized validates and normalizes each topic event before handling it,
+// invalid events are dropped as they would never become valid on retry
+func normalized(fn EventHandler) func(ctx context.Context, te *common.TopicEvent) (retry bool, err error) {
+	return func(ctx context.Context, te *common.TopicEvent) (retry bool, err error) {
+		e, err := NewEvent(ctx, te)
+		if err != nil {
+			logger.Printf("dropping event: %v", err)
+			return false, err
+		}
+		return fn(ctx, e)
+	}
+}
@@ -0,0 +1,232 @@
+// Package subscriber provides the declarative topic subscriptions shared by the event
+// subscribers, each one with its own route, metadata, and handler action.
+package subscriber
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the list of subscriptions, and of the sinks their actions write to
+type Config struct {
+	Subscriptions []*Subscription `yaml:"subscriptions"`
+	Sinks         []*SinkConfig   `yaml:"sinks"`
+}
+
+// Subscription defines single pub/sub topic subscription
+type Subscription struct {
+	// PubSub is the name of the pub/sub component.
+	PubSub string `yaml:"pubsub"`
+	// Topic is the name of the topic.
+	Topic string `yaml:"topic"`
+	// Route is the HTTP route the events are delivered to, defaults to /<topic> (not used in gRPC).
+	Route string `yaml:"route"`
+	// Metadata is the subscription metadata (e.g. rawPayload: "true").
+	Metadata map[string]string `yaml:"metadata"`
+	// Action is the action taken on each event, defaults to log, not used with rules.
+	Action *Action `yaml:"action"`
+	// Rules route each event to the action of the first rule matching it.
+	Rules []*Rule `yaml:"rules"`
+	// Fallback defines what is done with the events not matched by any of the rules.
+	Fallback *Fallback `yaml:"fallback"`
+}
+
+// LoadConfig loads subscriptions from YAML file
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading subscriptions file: %s", path)
+	}
+	return ParseConfig(b)
+}
+
+// ParseConfig parses and validates YAML subscriptions
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, errors.Wrap(err, "error parsing subscriptions")
+	}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DefaultConfig returns the config with single subscription logging the events of the topic
+func DefaultConfig(pubsub, topic string) (*Config, error) {
+	c := &Config{Subscriptions: []*Subscription{{PubSub: pubsub, Topic: topic}}}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NeedsClient returns true when any of the subscription actions, fallbacks, or sinks uses Dapr client
+func (c *Config) NeedsClient() bool {
+	for _, s := range c.Sinks {
+		if s.Type != SinkFile {
+			return true
+		}
+	}
+	for _, s := range c.Subscriptions {
+		for _, a := range s.actions() {
+			if a.Type != ActionLog && a.Type != ActionSink {
+				return true
+			}
+		}
+		if len(s.Rules) > 0 && s.Fallback.Type == FallbackDeadLetter {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription returns the subscription of the pub/sub topic, or nil when there is none
+func (c *Config) subscription(pubsub, topic string) *Subscription {
+	k := topicKey{pubsub: pubsub, topic: topic}
+	for _, s := range c.Subscriptions {
+		if s.key() == k {
+			return s
+		}
+	}
+	return nil
+}
+
+// init validates the subscriptions and sets their defaults
+func (c *Config) init() error {
+	if len(c.Subscriptions) == 0 {
+		return errors.New("at least one subscription required")
+	}
+	sinks := make(map[string]bool)
+	for i, s := range c.Sinks {
+		if s.Name == "" {
+			return errors.Errorf("sink %d: name required", i)
+		}
+		if sinks[s.Name] {
+			return errors.Errorf("sink %s: duplicate name", s.Name)
+		}
+		sinks[s.Name] = true
+		if err := s.init(); err != nil {
+			return errors.Wrapf(err, "sink %s", s.Name)
+		}
+	}
+
+	env, err := newRuleEnv()
+	if err != nil {
+		return errors.Wrap(err, "error creating rule environment")
+	}
+	topics := make(map[topicKey]bool)
+	routes := make(map[string]bool)
+	for i, s := range c.Subscriptions {
+		if s.PubSub == "" || s.Topic == "" {
+			return errors.Errorf("subscription %d: pubsub and topic required", i)
+		}
+		if topics[s.key()] {
+			return errors.Errorf("subscription %s: duplicate pubsub and topic", s)
+		}
+		topics[s.key()] = true
+
+		if s.Route == "" {
+			s.Route = s.Topic
+		}
+		if !strings.HasPrefix(s.Route, "/") {
+			s.Route = "/" + s.Route
+		}
+		if routes[s.Route] {
+			return errors.Errorf("subscription %s: duplicate route %s, set unique route", s, s.Route)
+		}
+		routes[s.Route] = true
+
+		if err := s.initHandling(env); err != nil {
+			return errors.Wrapf(err, "subscription %s", s)
+		}
+		for _, a := range s.actions() {
+			if a.Type == ActionSink && !sinks[a.Sink] {
+				return errors.Errorf("subscription %s: sink not configured: %s", s, a.Sink)
+			}
+		}
+	}
+	return nil
+}
+
+// initHandling validates either the action or the rules with their fallback, and sets their defaults
+func (s *Subscription) initHandling(env *cel.Env) error {
+	if len(s.Rules) == 0 {
+		if s.Fallback != nil {
+			return errors.New("fallback requires rules")
+		}
+		if s.Action == nil {
+			s.Action = &Action{Type: ActionLog}
+		}
+		return s.Action.init()
+	}
+
+	if s.Action != nil {
+		return errors.New("action and rules are exclusive, set action of each rule")
+	}
+	names := make(map[string]bool)
+	for _, r := range s.Rules {
+		if err := r.init(env); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return errors.Errorf("rule %s: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+	}
+	if s.Fallback == nil {
+		s.Fallback = &Fallback{}
+	}
+	return s.Fallback.init()
+}
+
+// actions returns the subscription action, or the actions of its rules
+func (s *Subscription) actions() []*Action {
+	if len(s.Rules) == 0 {
+		return []*Action{s.Action}
+	}
+	list := make([]*Action, 0, len(s.Rules))
+	for _, r := range s.Rules {
+		list = append(list, r.Action)
+	}
+	return list
+}
+
+// handler returns the event handler of the subscription action, or of its rules
+func (s *Subscription) handler(client Client, sinks map[string]*batcher) (EventHandler, error) {
+	if len(s.Rules) == 0 {
+		return s.Action.handler(client, sinks)
+	}
+	r, err := newRouter(s, client, sinks)
+	if err != nil {
+		return nil, err
+	}
+	return r.handle, nil
+}
+
+// handling describes the subscription action, or its rules
+func (s *Subscription) handling() string {
+	if len(s.Rules) == 0 {
+		return "action: " + s.Action.Type
+	}
+	return fmt.Sprintf("rules: %d, fallback: %s", len(s.Rules), s.Fallback.Type)
+}
+
+// topicKey identifies the subscription by its pub/sub and topic
+type topicKey struct {
+	pubsub string
+	topic  string
+}
+
+func (s *Subscription) key() topicKey {
+	return topicKey{pubsub: s.PubSub, topic: s.Topic}
+}
+
+func (s *Subscription) String() string {
+	return fmt.Sprintf("%s/%s", s.PubSub, s.Topic)
+}
@@ -0,0 +1,107 @@
+package subscriber
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigRejectsOnlyDuplicatePubSubAndTopic(t *testing.T) {
+	// a-b/c and a/b-c would have the same key joined with dash
+	if _, err := ParseConfig([]byte(`
+subscriptions:
+- pubsub: a-b
+  topic: c
+- pubsub: a
+  topic: b-c
+`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := ParseConfig([]byte(`
+subscriptions:
+- pubsub: a
+  topic: b-c
+- pubsub: a
+  topic: b-c
+  route: other
+`))
+	if err == nil || !strings.Contains(err.Error(), "duplicate pubsub and topic") {
+		t.Fatalf("expected duplicate error, got: %v", err)
+	}
+}
+
+func TestConfigNeedsClient(t *testing.T) {
+	list := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{"log action", `
+subscriptions:
+- pubsub: p
+  topic: t
+`, false},
+		{"state action", `
+subscriptions:
+- pubsub: p
+  topic: t
+  action:
+    type: state
+    store: s
+`, true},
+		{"file sink", `
+subscriptions:
+- pubsub: p
+  topic: t
+  action:
+    type: sink
+    sink: f
+sinks:
+- name: f
+  type: file
+  path: events
+`, false},
+		{"binding sink", `
+subscriptions:
+- pubsub: p
+  topic: t
+sinks:
+- name: b
+  type: binding
+  binding: b
+`, true},
+		{"publish rule", `
+subscriptions:
+- pubsub: p
+  topic: t
+  rules:
+  - name: big
+    condition: data.amount > 100
+    action:
+      type: publish
+      pubsub: p
+      topic: big
+`, true},
+		{"deadletter fallback", `
+subscriptions:
+- pubsub: p
+  topic: t
+  rules:
+  - name: big
+    condition: data.amount > 100
+  fallback:
+    type: deadletter
+    pubsub: p
+    topic: dead
+`, true},
+	}
+	for _, tt := range list {
+		c, err := ParseConfig([]byte(tt.config))
+		if err != nil {
+			t.Fatalf("%s: invalid config: %v", tt.name, err)
+		}
+		if got := c.NeedsClient(); got != tt.want {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.want, got)
+		}
+	}
+}